@@ -0,0 +1,40 @@
+// Command admin grants or revokes the admin role of an existing account.
+// Run it once the account's owner has been confirmed:
+//
+//	go run ./cmd/admin -email ops@example.com
+//	go run ./cmd/admin -email ops@example.com -revoke
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/database"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the account to change")
+	revoke := flag.Bool("revoke", false, "make the account a regular user again")
+	flag.Parse()
+	if *email == "" {
+		flag.Usage()
+		log.Fatal("-email is required")
+	}
+
+	cfg := config.Load()
+	db := database.NewDatabase(cfg)
+	users := repository.NewUserRepository(db.DB)
+
+	role := models.RoleAdmin
+	if *revoke {
+		role = models.RoleUser
+	}
+	user, err := users.SetRole(*email, role)
+	if err != nil {
+		log.Fatalf("failed to update %s: %v", *email, err)
+	}
+	log.Printf("user %d (%s) is now %s", user.ID, user.Email, role)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"time"
 
 	"github.com/example/solo_journey/internal/config"
 	"github.com/example/solo_journey/internal/database"
@@ -12,28 +13,141 @@ import (
 
 func main() {
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
 
 	db := database.NewDatabase(cfg)
 
 	userRepo := repository.NewUserRepository(db.DB)
 	tripRepo := repository.NewTripRepository(db.DB)
 	rewardRepo := repository.NewRewardRepository(db.DB)
+	badgeRepo := repository.NewBadgeRepository(db.DB)
+	referralRepo := repository.NewReferralRepository(db.DB)
+	voucherRepo := repository.NewVoucherRepository(db.DB)
+	idempotencyRepo := repository.NewIdempotencyRepository(db.DB)
+	webhookRepo := repository.NewWebhookRepository(db.DB)
+	wishlistRepo := repository.NewWishlistRepository(db.DB)
+	notificationRepo := repository.NewNotificationRepository(db.DB)
+	dropRepo := repository.NewDropRepository(db.DB)
+	leaderboardRepo := repository.NewLeaderboardRepository(db.DB)
+	followRepo := repository.NewFollowRepository(db.DB)
+	tokenRepo := repository.NewTokenRepository(db.DB)
 
 	var leaderboard service.Leaderboard
+	var resilientLeaderboard *service.ResilientLeaderboard
 	if lb := service.NewRedisLeaderboard(cfg.RedisAddr); lb != nil {
-		leaderboard = lb
-		log.Printf("using redis leaderboard at %s", cfg.RedisAddr)
+		resilientLeaderboard = service.NewResilientLeaderboard(lb, cfg)
+		leaderboard = resilientLeaderboard
+		if resilientLeaderboard.Health().Degraded() {
+			log.Printf("redis leaderboard at %s is unreachable, starting on the in-memory fallback", cfg.RedisAddr)
+		} else {
+			log.Printf("using redis leaderboard at %s", cfg.RedisAddr)
+		}
+		go resilientLeaderboard.Run(time.Second)
 	} else {
 		leaderboard = service.NewMemoryLeaderboard()
 		log.Printf("using in-memory leaderboard")
 	}
+	leaderboardStream := service.NewLeaderboardStream(leaderboard, userRepo, cfg)
+	leaderboard = leaderboardStream
+	go leaderboardStream.Run()
+
+	leaderboardSync := service.NewLeaderboardSync(userRepo, tripRepo, leaderboard)
+	if report, err := leaderboardSync.Reconcile(); err != nil {
+		log.Printf("failed to warm up leaderboard: %v", err)
+	} else {
+		log.Printf("leaderboard warmed up: %d users, %d scores written, %d removed", report.Users, report.Added+report.Updated, report.Removed)
+	}
+	if regions, err := leaderboardSync.RebuildRegions(); err != nil {
+		log.Printf("failed to warm up regional leaderboards: %v", err)
+	} else {
+		log.Printf("regional leaderboards warmed up: %d regions", regions)
+	}
+	go leaderboardSync.Run(cfg.LeaderboardCheckInterval)
+
+	periodLeaderboards := service.NewPeriodLeaderboardService(userRepo, leaderboardRepo, leaderboard)
+	if err := periodLeaderboards.Rollover(time.Now()); err != nil {
+		log.Printf("failed to roll over leaderboards: %v", err)
+	}
+	if err := periodLeaderboards.Rebuild(time.Now()); err != nil {
+		log.Printf("failed to rebuild windowed leaderboards: %v", err)
+	}
+	go periodLeaderboards.Run(time.Minute)
 
-	authService := service.NewAuthService(userRepo, cfg)
-	tripService := service.NewTripService(tripRepo, userRepo, leaderboard)
+	authService := service.NewAuthService(userRepo, tokenRepo, cfg)
+	if err := authService.LoadRevocations(); err != nil {
+		log.Fatalf("failed to load revoked tokens: %v", err)
+	}
+	if _, err := authService.BackfillSessions(); err != nil {
+		log.Fatalf("failed to backfill sessions: %v", err)
+	}
+	tripService := service.NewTripService(tripRepo, userRepo, leaderboard, cfg)
 	rewardService := service.NewRewardService(rewardRepo, userRepo)
-	userService := service.NewUserService(userRepo, tripRepo, rewardRepo)
+	userService := service.NewUserService(userRepo, tripRepo, rewardRepo, badgeRepo, wishlistRepo)
+	streakService := service.NewStreakService(tripRepo, userRepo, leaderboard)
+	badgeService := service.NewBadgeService(badgeRepo, tripRepo, rewardRepo, streakService)
+	adjustmentService := service.NewAdjustmentService(userRepo, leaderboard)
+	referralService := service.NewReferralService(referralRepo, userRepo, leaderboard)
+	catalogService := service.NewCatalogService(rewardRepo, cfg)
+	voucherService := service.NewVoucherService(voucherRepo, rewardRepo, cfg)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, cfg)
+	webhookService := service.NewWebhookService(webhookRepo, rewardRepo, cfg)
+	wishlistService := service.NewWishlistService(wishlistRepo, notificationRepo, userRepo, rewardRepo)
+	dropService := service.NewDropService(dropRepo, rewardRepo, userRepo, rewardService)
+	followService := service.NewFollowService(followRepo, userRepo, leaderboard)
+
+	if err := badgeService.SeedDefinitions(); err != nil {
+		log.Fatalf("failed to seed badge definitions: %v", err)
+	}
+	tripService.AddListener(streakService)
+	tripService.AddListener(badgeService)
+	tripService.AddListener(referralService)
+	tripService.AddListener(wishlistService)
+	rewardService.AddListener(badgeService)
+	rewardService.AddListener(webhookService)
+	rewardService.AddListener(wishlistService)
 
-	router := httptransport.NewRouter(authService, tripService, rewardService, userService)
+	go webhookService.Run(time.Minute)
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := dropService.DrawDue(); err != nil {
+				log.Printf("failed to draw flash drops: %v", err)
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := rewardService.ExpireStale(cfg.RedemptionTTL); err != nil {
+				log.Printf("failed to expire redemptions: %v", err)
+			} else if n > 0 {
+				log.Printf("expired %d redemptions", n)
+			}
+			if _, err := idempotencyService.PurgeExpired(); err != nil {
+				log.Printf("failed to purge idempotency records: %v", err)
+			}
+			if _, err := authService.PurgeExpiredTokens(); err != nil {
+				log.Printf("failed to purge expired tokens: %v", err)
+			}
+			if err := wishlistService.CheckAll(); err != nil {
+				log.Printf("failed to check wishlists: %v", err)
+			}
+			if err := periodLeaderboards.Rebuild(time.Now()); err != nil {
+				log.Printf("failed to rebuild windowed leaderboards: %v", err)
+			}
+		}
+	}()
+
+	router := httptransport.NewRouter(authService, tripService, rewardService, userService, badgeService, streakService, adjustmentService, referralService, catalogService, voucherService, idempotencyService, webhookService, wishlistService, dropService, leaderboardSync, periodLeaderboards, resilientLeaderboard, leaderboardStream, followService)
+	if err := router.Engine.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	log.Printf("starting server on :%s", cfg.ServerPort)
 	if err := router.Engine.Run(":" + cfg.ServerPort); err != nil {
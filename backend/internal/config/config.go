@@ -1,8 +1,11 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,8 +13,65 @@ type Config struct {
 	DatabasePath string
 	RedisAddr    string
 	JWTSecret    string
+	VoucherKey   string
 	ServerPort   string
-	TokenExpiry  time.Duration
+	UploadDir    string
+
+	// DatabaseMaxOpenConns sizes the connection pool of drivers that allow
+	// concurrent writers; SQLite always uses a single connection.
+	DatabaseMaxOpenConns int
+
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For header is believed. With none, the client IP is the
+	// address of the connection.
+	TrustedProxies []string
+
+	// Access tokens are short-lived JWTs. TokenExpiry is the lifetime of
+	// the refresh tokens used to obtain new ones, so a session lasts that
+	// long without use.
+	AccessTokenExpiry time.Duration
+	TokenExpiry       time.Duration
+
+	// Limits applied to points awarded for new trips. Zero disables a limit.
+	PointsDailyCap  int64
+	PointsWeeklyCap int64
+	AwardCooldown   time.Duration
+
+	// RedemptionTTL is how long a redemption may stay pending or approved
+	// before it expires and is refunded.
+	RedemptionTTL time.Duration
+
+	// IdempotencyTTL is how long responses are kept for replay to requests
+	// retried with the same Idempotency-Key.
+	IdempotencyTTL time.Duration
+
+	// Fulfillment webhooks. WebhookURL is the default endpoint for rewards
+	// without their own; deliveries failing WebhookMaxAttempts times are
+	// dead-lettered. Retries back off exponentially from WebhookBackoff.
+	WebhookURL         string
+	WebhookSecret      string
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+
+	// LeaderboardCheckInterval is how often the leaderboard is reconciled
+	// with the points stored in the database.
+	LeaderboardCheckInterval time.Duration
+
+	// Redis leaderboard circuit breaker: after LeaderboardBreakerFailures
+	// consecutive errors the in-memory fallback serves the leaderboard and
+	// Redis is probed again after LeaderboardBreakerCooldown. Up to
+	// LeaderboardReplayQueue missed updates are replayed on recovery.
+	LeaderboardBreakerFailures int
+	LeaderboardBreakerCooldown time.Duration
+	LeaderboardReplayQueue     int
+
+	// The live leaderboard stream pushes the top LeaderboardStreamSize
+	// entries, checking for changes at most once per
+	// LeaderboardStreamInterval, to at most
+	// LeaderboardStreamMaxSubscribers clients at once.
+	LeaderboardStreamSize           int
+	LeaderboardStreamInterval       time.Duration
+	LeaderboardStreamMaxSubscribers int
 }
 
 func Load() Config {
@@ -20,7 +80,56 @@ func Load() Config {
 		RedisAddr:    os.Getenv("REDIS_ADDR"),
 		JWTSecret:    getEnv("JWT_SECRET", "super-secret-key"),
 		ServerPort:   getEnv("SERVER_PORT", "8080"),
-		TokenExpiry:  time.Hour * 24 * 7,
+		UploadDir:    getEnv("UPLOAD_DIR", "uploads"),
+
+		DatabaseMaxOpenConns: 20,
+
+		AccessTokenExpiry: 15 * time.Minute,
+		TokenExpiry:       time.Hour * 24 * 7,
+
+		PointsDailyCap:  300,
+		PointsWeeklyCap: 1500,
+		AwardCooldown:   10 * time.Minute,
+
+		RedemptionTTL:  30 * 24 * time.Hour,
+		IdempotencyTTL: 24 * time.Hour,
+
+		WebhookURL:         os.Getenv("FULFILLMENT_WEBHOOK_URL"),
+		WebhookSecret:      os.Getenv("FULFILLMENT_WEBHOOK_SECRET"),
+		WebhookMaxAttempts: 6,
+		WebhookBackoff:     30 * time.Second,
+
+		LeaderboardCheckInterval: 15 * time.Minute,
+
+		LeaderboardBreakerFailures: 3,
+		LeaderboardBreakerCooldown: 30 * time.Second,
+		LeaderboardReplayQueue:     10000,
+
+		LeaderboardStreamSize:           10,
+		LeaderboardStreamInterval:       time.Second,
+		LeaderboardStreamMaxSubscribers: 1000,
+	}
+
+	// Signing up with an address proves nothing about owning it, so admins
+	// are no longer granted by email.
+	if os.Getenv("ADMIN_EMAILS") != "" {
+		log.Printf("ADMIN_EMAILS is ignored; grant the admin role with go run ./cmd/admin -email <address>")
+	}
+
+	cfg.VoucherKey = os.Getenv("VOUCHER_ENCRYPTION_KEY")
+
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			cfg.TrustedProxies = append(cfg.TrustedProxies, proxy)
+		}
+	}
+
+	if v := os.Getenv("DATABASE_MAX_OPEN_CONNS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.DatabaseMaxOpenConns = n
+		} else {
+			log.Printf("invalid DATABASE_MAX_OPEN_CONNS value: %q", v)
+		}
 	}
 
 	if v := os.Getenv("TOKEN_EXPIRY_HOURS"); v != "" {
@@ -31,9 +140,140 @@ func Load() Config {
 		}
 	}
 
+	if v := os.Getenv("ACCESS_TOKEN_TTL_MINUTES"); v != "" {
+		if d, err := time.ParseDuration(v + "m"); err == nil && d > 0 {
+			cfg.AccessTokenExpiry = d
+		} else {
+			log.Printf("invalid ACCESS_TOKEN_TTL_MINUTES value: %q", v)
+		}
+	}
+
+	if v := os.Getenv("POINTS_DAILY_CAP"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.PointsDailyCap = n
+		} else {
+			log.Printf("invalid POINTS_DAILY_CAP value: %v", err)
+		}
+	}
+
+	if v := os.Getenv("POINTS_WEEKLY_CAP"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.PointsWeeklyCap = n
+		} else {
+			log.Printf("invalid POINTS_WEEKLY_CAP value: %v", err)
+		}
+	}
+
+	if v := os.Getenv("POINTS_COOLDOWN_MINUTES"); v != "" {
+		if d, err := time.ParseDuration(v + "m"); err == nil {
+			cfg.AwardCooldown = d
+		} else {
+			log.Printf("invalid POINTS_COOLDOWN_MINUTES value: %v", err)
+		}
+	}
+
+	if v := os.Getenv("REDEMPTION_TTL_HOURS"); v != "" {
+		if d, err := time.ParseDuration(v + "h"); err == nil {
+			cfg.RedemptionTTL = d
+		} else {
+			log.Printf("invalid REDEMPTION_TTL_HOURS value: %v", err)
+		}
+	}
+
+	if v := os.Getenv("IDEMPOTENCY_TTL_HOURS"); v != "" {
+		if d, err := time.ParseDuration(v + "h"); err == nil {
+			cfg.IdempotencyTTL = d
+		} else {
+			log.Printf("invalid IDEMPOTENCY_TTL_HOURS value: %v", err)
+		}
+	}
+
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.WebhookMaxAttempts = n
+		} else {
+			log.Printf("invalid WEBHOOK_MAX_ATTEMPTS value: %v", err)
+		}
+	}
+
+	if v := os.Getenv("WEBHOOK_BACKOFF_SECONDS"); v != "" {
+		if d, err := time.ParseDuration(v + "s"); err == nil {
+			cfg.WebhookBackoff = d
+		} else {
+			log.Printf("invalid WEBHOOK_BACKOFF_SECONDS value: %v", err)
+		}
+	}
+
+	if v := os.Getenv("LEADERBOARD_CHECK_MINUTES"); v != "" {
+		if d, err := time.ParseDuration(v + "m"); err == nil && d > 0 {
+			cfg.LeaderboardCheckInterval = d
+		} else {
+			log.Printf("invalid LEADERBOARD_CHECK_MINUTES value: %q", v)
+		}
+	}
+
+	if v := os.Getenv("LEADERBOARD_BREAKER_FAILURES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.LeaderboardBreakerFailures = n
+		} else {
+			log.Printf("invalid LEADERBOARD_BREAKER_FAILURES value: %q", v)
+		}
+	}
+
+	if v := os.Getenv("LEADERBOARD_BREAKER_COOLDOWN_SECONDS"); v != "" {
+		if d, err := time.ParseDuration(v + "s"); err == nil && d > 0 {
+			cfg.LeaderboardBreakerCooldown = d
+		} else {
+			log.Printf("invalid LEADERBOARD_BREAKER_COOLDOWN_SECONDS value: %q", v)
+		}
+	}
+
+	if v := os.Getenv("LEADERBOARD_REPLAY_QUEUE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.LeaderboardReplayQueue = n
+		} else {
+			log.Printf("invalid LEADERBOARD_REPLAY_QUEUE value: %q", v)
+		}
+	}
+
+	if v := os.Getenv("LEADERBOARD_STREAM_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.LeaderboardStreamSize = n
+		} else {
+			log.Printf("invalid LEADERBOARD_STREAM_SIZE value: %q", v)
+		}
+	}
+
+	if v := os.Getenv("LEADERBOARD_STREAM_MAX_SUBSCRIBERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cfg.LeaderboardStreamMaxSubscribers = n
+		} else {
+			log.Printf("invalid LEADERBOARD_STREAM_MAX_SUBSCRIBERS value: %q", v)
+		}
+	}
+
+	if v := os.Getenv("LEADERBOARD_STREAM_INTERVAL_MS"); v != "" {
+		if d, err := time.ParseDuration(v + "ms"); err == nil && d >= 0 {
+			cfg.LeaderboardStreamInterval = d
+		} else {
+			log.Printf("invalid LEADERBOARD_STREAM_INTERVAL_MS value: %q", v)
+		}
+	}
+
 	return cfg
 }
 
+// Validate reports settings the server must not start with.
+func (c Config) Validate() error {
+	if c.VoucherKey == "" {
+		return errors.New("VOUCHER_ENCRYPTION_KEY must be set")
+	}
+	if c.VoucherKey == c.JWTSecret {
+		return errors.New("VOUCHER_ENCRYPTION_KEY must differ from JWT_SECRET")
+	}
+	return nil
+}
+
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
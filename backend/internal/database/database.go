@@ -19,9 +19,89 @@ func NewDatabase(cfg config.Config) *Database {
 		log.Fatalf("failed to connect database: %v", err)
 	}
 
-	if err := db.AutoMigrate(&models.User{}, &models.TripPost{}, &models.Media{}, &models.Reward{}, &models.Redemption{}, &models.PointsHistory{}); err != nil {
+	if err := backfill(db); err != nil {
+		log.Fatalf("failed to backfill database: %v", err)
+	}
+	if err := dropStaleIndexes(db); err != nil {
+		log.Fatalf("failed to drop stale indexes: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.TripPost{}, &models.Media{}, &models.Reward{}, &models.RewardStockEvent{}, &models.Redemption{}, &models.RedemptionEvent{}, &models.PointsHistory{}, &models.Badge{}, &models.UserBadge{}, &models.PointsAdjustment{}, &models.Referral{}, &models.VoucherCode{}, &models.IdempotencyRecord{}, &models.WebhookDelivery{}, &models.WishlistItem{}, &models.Notification{}, &models.Drop{}, &models.DropEntry{}, &models.LeaderboardStanding{}, &models.Follow{}, &models.RefreshToken{}, &models.RevokedTokenFamily{}, &models.Session{}); err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
 
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("failed to access database handle: %v", err)
+	}
+	if db.Dialector.Name() == "sqlite" {
+		// SQLite allows a single writer at a time. Funnelling every query
+		// through one connection lets concurrent transactions queue up
+		// instead of failing with "database is locked".
+		sqlDB.SetMaxOpenConns(1)
+	} else {
+		sqlDB.SetMaxOpenConns(cfg.DatabaseMaxOpenConns)
+		sqlDB.SetMaxIdleConns(cfg.DatabaseMaxOpenConns)
+	}
+
 	return &Database{DB: db}
 }
+
+// backfills fill columns that earlier versions added without a default, so
+// they hold NULL in rows created before. They run before AutoMigrate makes
+// the columns NOT NULL, which on SQLite copies the table and would fail on
+// the NULLs.
+var backfills = []struct {
+	model  interface{}
+	column string
+	stmt   string
+}{
+	{&models.Reward{}, "in_drop", "UPDATE rewards SET in_drop = false WHERE in_drop IS NULL"},
+	{&models.Reward{}, "hidden", "UPDATE rewards SET hidden = false WHERE hidden IS NULL"},
+	// A trip's award is the first "activity" entry its author earned after
+	// posting it and before posting the next one; trips without one earned
+	// nothing.
+	{&models.TripPost{}, "awarded_points", `UPDATE trip_posts SET awarded_points = COALESCE((
+		SELECT h.delta FROM points_histories h
+		WHERE h.user_id = trip_posts.user_id AND h.reason = 'activity' AND h.delta > 0
+		AND h.created_at >= trip_posts.created_at
+		AND NOT EXISTS (SELECT 1 FROM trip_posts n WHERE n.user_id = trip_posts.user_id AND n.id <> trip_posts.id AND n.created_at > trip_posts.created_at AND n.created_at <= h.created_at)
+		ORDER BY h.created_at, h.id LIMIT 1), 0)
+		WHERE awarded_points IS NULL`},
+}
+
+// backfill runs the backfills whose column exists. Each statement only
+// touches rows that still need it, so running them on every start is cheap.
+func backfill(db *gorm.DB) error {
+	for _, b := range backfills {
+		if !db.Migrator().HasColumn(b.model, b.column) {
+			continue
+		}
+		if err := db.Exec(b.stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// staleIndexes are indexes earlier versions created that the models no longer
+// declare. AutoMigrate only adds indexes, so these are dropped explicitly.
+var staleIndexes = []struct {
+	model interface{}
+	name  string
+}{
+	// Ranks used to be unique per period; shared ranks need the uniqueness
+	// on the user instead, which idx_standing_user provides.
+	{&models.LeaderboardStanding{}, "idx_standing"},
+}
+
+func dropStaleIndexes(db *gorm.DB) error {
+	for _, idx := range staleIndexes {
+		if !db.Migrator().HasIndex(idx.model, idx.name) {
+			continue
+		}
+		if err := db.Migrator().DropIndex(idx.model, idx.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
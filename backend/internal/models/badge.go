@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type Badge struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Code        string    `gorm:"uniqueIndex" json:"code"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Metric      string    `json:"metric"`
+	Threshold   int64     `json:"threshold"`
+}
+
+type UserBadge struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"uniqueIndex:idx_user_badge" json:"user_id"`
+	BadgeID   uint      `gorm:"uniqueIndex:idx_user_badge" json:"badge_id"`
+	Badge     Badge     `json:"badge"`
+}
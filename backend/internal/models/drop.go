@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+const (
+	// DropOpen drops accept entries between OpensAt and ClosesAt and wait
+	// for their draw afterwards.
+	DropOpen  = "open"
+	DropDrawn = "drawn"
+)
+
+// Drop is a limited-time flash drop of a reward. Users enter during the
+// window and a lottery seeded with Seed allocates the inventory when it
+// closes. SeedHash is published up front so the seed revealed after the draw
+// can be checked against it.
+type Drop struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	RewardID  uint       `gorm:"index" json:"reward_id"`
+	Reward    Reward     `json:"reward"`
+	OpensAt   time.Time  `json:"opens_at"`
+	ClosesAt  time.Time  `gorm:"index" json:"closes_at"`
+	Status    string     `gorm:"index" json:"status"`
+	SeedHash  string     `json:"seed_hash"`
+	Seed      string     `json:"seed,omitempty"`
+	Entries   int        `json:"entries"`
+	Winners   int        `json:"winners"`
+	DrawnAt   *time.Time `json:"drawn_at,omitempty"`
+}
+
+const (
+	DropEntryPending    = "pending"
+	DropEntryWon        = "won"
+	DropEntryLost       = "lost"
+	DropEntryIneligible = "ineligible"
+)
+
+// DropEntry is one user's entry into a drop. Ticket and Position record the
+// entry's place in the lottery order once drawn.
+type DropEntry struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	DropID       uint      `gorm:"uniqueIndex:idx_drop_user" json:"drop_id"`
+	UserID       uint      `gorm:"uniqueIndex:idx_drop_user" json:"user_id"`
+	Ticket       string    `json:"ticket,omitempty"`
+	Position     int       `json:"position,omitempty"`
+	Result       string    `json:"result"`
+	Reason       string    `json:"reason,omitempty"`
+	RedemptionID *uint     `json:"redemption_id,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// Follow is a one-way connection: FollowerID follows FolloweeID.
+type Follow struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	FollowerID uint      `gorm:"uniqueIndex:idx_follow" json:"follower_id"`
+	FolloweeID uint      `gorm:"uniqueIndex:idx_follow;index" json:"followee_id"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// IdempotencyRecord remembers the response to the first request a user sent
+// with a given Idempotency-Key so retries can be answered without running the
+// handler again. A zero StatusCode means the first request is still running.
+type IdempotencyRecord struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UserID      uint      `gorm:"uniqueIndex:idx_user_idempotency_key" json:"user_id"`
+	Key         string    `gorm:"column:idempotency_key;uniqueIndex:idx_user_idempotency_key" json:"key"`
+	RequestHash string    `json:"-"`
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"-"`
+	ExpiresAt   time.Time `gorm:"index" json:"expires_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// LeaderboardStanding is one row of the final standings of a closed
+// leaderboard period, e.g. period "week" and key "2026-W41". Users with equal
+// points share a rank.
+type LeaderboardStanding struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"archived_at"`
+	Period    string    `gorm:"uniqueIndex:idx_standing_user" json:"period"`
+	PeriodKey string    `gorm:"uniqueIndex:idx_standing_user" json:"period_key"`
+	Rank      int       `json:"rank"`
+	UserID    uint      `gorm:"uniqueIndex:idx_standing_user" json:"user_id"`
+	Points    int64     `json:"points"`
+}
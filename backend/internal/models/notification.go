@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const (
+	NotificationGoalAffordable = "goal_affordable"
+	NotificationLowStock       = "low_stock"
+)
+
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	Kind      string     `json:"kind"`
+	RewardID  uint       `json:"reward_id,omitempty"`
+	Message   string     `json:"message"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	ReferralPending   = "pending"
+	ReferralCompleted = "completed"
+	ReferralRejected  = "rejected"
+)
+
+// Referral links an invitee to the user whose invite code they registered
+// with. Bonuses are granted once the invitee posts a verified trip.
+type Referral struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	InviterID    uint       `gorm:"index" json:"inviter_id"`
+	InviteeID    uint       `gorm:"uniqueIndex" json:"invitee_id"`
+	Invitee      User       `json:"invitee"`
+	Code         string     `json:"code"`
+	Status       string     `gorm:"index" json:"status"`
+	RejectReason string     `json:"reject_reason,omitempty"`
+	InviterBonus int64      `json:"inviter_bonus"`
+	InviteeBonus int64      `json:"invitee_bonus"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
@@ -10,13 +10,82 @@ type Reward struct {
 	Description string    `json:"description"`
 	PointsCost  int64     `json:"points_cost"`
 	Inventory   int       `json:"inventory"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	Category    string    `gorm:"index" json:"category,omitempty"`
+	// Tags is a comma separated list of lower-case tags, e.g. "food,tokyo".
+	Tags string `json:"tags,omitempty"`
+	// RedemptionCount is only filled in by catalog queries that rank by
+	// popularity; it is not a stored column.
+	RedemptionCount int64 `gorm:"->;-:migration" json:"redemption_count,omitempty"`
+	// UsesCodes marks rewards backed by a voucher code pool. Their inventory
+	// always equals the number of unassigned codes.
+	UsesCodes bool `json:"uses_codes"`
+	// InDrop reserves the inventory for an undrawn flash drop; the reward
+	// cannot be redeemed directly meanwhile.
+	InDrop bool `gorm:"default:false;not null" json:"in_drop"`
+	// Hidden rewards are drafts or unpublished rewards that only admins see.
+	Hidden bool `gorm:"default:false;not null" json:"hidden"`
+	// ArchivedAt retires a reward without deleting it so past redemptions
+	// keep pointing at it.
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+
+	// Optional eligibility rules. Zero values mean no restriction.
+	MinLevel   int        `json:"min_level"`
+	MaxPerUser int        `json:"max_per_user"`
+	StartsAt   *time.Time `json:"starts_at,omitempty"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+	// Regions is a comma separated list of region codes, e.g. "JP,KR".
+	Regions string `json:"regions,omitempty"`
+
+	// WebhookURL receives fulfillment webhooks for this reward instead of the
+	// global endpoint. WebhookSecret signs them; when empty the global secret
+	// is used. Both are private to the partner and only admins see the URL.
+	WebhookURL    string `json:"-"`
+	WebhookSecret string `json:"-"`
+}
+
+// RewardStockEvent audits every change made to a reward's inventory by an
+// administrator.
+type RewardStockEvent struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	RewardID       uint      `gorm:"index" json:"reward_id"`
+	ActorID        uint      `json:"actor_id"`
+	Delta          int       `json:"delta"`
+	InventoryAfter int       `json:"inventory_after"`
+	Reason         string    `json:"reason"`
 }
 
+const (
+	RedemptionPending   = "pending"
+	RedemptionApproved  = "approved"
+	RedemptionFulfilled = "fulfilled"
+	RedemptionRejected  = "rejected"
+	RedemptionCancelled = "cancelled"
+	RedemptionExpired   = "expired"
+)
+
 type Redemption struct {
-        ID        uint      `gorm:"primaryKey" json:"id"`
-        CreatedAt time.Time `json:"created_at"`
-        UserID    uint      `json:"user_id"`
-        RewardID  uint      `json:"reward_id"`
-        Status    string    `json:"status"`
-        Reward    Reward    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"reward"`
+        ID         uint      `gorm:"primaryKey" json:"id"`
+        CreatedAt  time.Time `json:"created_at"`
+        UpdatedAt  time.Time `json:"updated_at"`
+        UserID     uint      `json:"user_id"`
+        RewardID   uint      `json:"reward_id"`
+        Status     string    `gorm:"index" json:"status"`
+        PointsCost int64     `json:"points_cost"`
+        Reward     Reward    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"reward"`
+        History    []RedemptionEvent `json:"history,omitempty"`
+}
+
+// RedemptionEvent is one entry in the status timeline of a redemption.
+// ActorRole is "user", "admin" or "system".
+type RedemptionEvent struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	RedemptionID uint      `gorm:"index" json:"redemption_id"`
+	FromStatus   string    `json:"from_status"`
+	ToStatus     string    `json:"to_status"`
+	ActorID      uint      `json:"actor_id,omitempty"`
+	ActorRole    string    `json:"actor_role"`
+	Note         string    `json:"note,omitempty"`
 }
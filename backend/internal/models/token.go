@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// RefreshToken is a long-lived token that can be exchanged once for a new
+// access and refresh token pair. Tokens issued by rotation share the FamilyID
+// of the login that started the chain. Only a hash of the token is stored.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	FamilyID  string     `gorm:"index" json:"family_id"`
+	TokenHash string     `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// RevokedTokenFamily marks a token family as signed out. Access tokens of the
+// family are rejected until ExpiresAt, after which none of them can still be
+// valid and the entry is purged.
+type RevokedTokenFamily struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	FamilyID  string    `gorm:"uniqueIndex" json:"family_id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Reason    string    `json:"reason"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+}
+
+// Session is a signed-in device: one per login and token family. It ends when
+// the family is revoked or its refresh token expires unused.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `gorm:"index" json:"-"`
+	FamilyID   string     `gorm:"uniqueIndex" json:"-"`
+	DeviceName string     `json:"device_name"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	Current    bool       `gorm:"-" json:"current"`
+}
+
+// Reasons for revoking a token family.
+const (
+	RevokeLogout  = "logout"
+	RevokeReuse   = "reuse"
+	RevokeSession = "session_revoked"
+)
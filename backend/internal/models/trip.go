@@ -10,11 +10,25 @@ type TripPost struct {
         Title       string    `json:"title"`
         Description string    `json:"description"`
         Location    string    `json:"location"`
+        Country     string    `gorm:"index" json:"country"`
         VisitedAt   time.Time `json:"visited_at"`
         User        User      `json:"user"`
         Media       []Media   `gorm:"constraint:OnDelete:CASCADE;" json:"media"`
         Score       float64   `json:"score"`
         Verified    bool      `json:"verified"`
+        // AwardedPoints is what the trip earned, kept to rebuild the
+        // regional leaderboards.
+        AwardedPoints int64   `gorm:"default:0;not null" json:"awarded_points"`
+        Award       *PointsAward `gorm:"-" json:"award,omitempty"`
+}
+
+// PointsAward explains how many points a new trip earned and which limits
+// reduced the award.
+type PointsAward struct {
+	Base           int64    `json:"base"`
+	Awarded        int64    `json:"awarded"`
+	LocationFactor float64  `json:"location_factor"`
+	Limits         []string `json:"limits,omitempty"`
 }
 
 type Media struct {
@@ -13,8 +13,25 @@ type User struct {
 	Password  string    `json:"-"`
 	Points    int64     `json:"points"`
 	Level     int       `json:"level"`
+	Timezone  string    `json:"timezone"`
+	Region    string    `json:"region"`
+	AvatarURL string    `json:"avatar_url"`
+	Role      string    `gorm:"default:user" json:"role"`
+
+	InviteCode     string `gorm:"index" json:"-"`
+	RegistrationIP string `json:"-"`
+	DeviceID       string `json:"-"`
 }
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	// RoleSystem marks changes made by background jobs rather than a person.
+	RoleSystem = "system"
+	// RolePartner marks changes reported by a fulfillment partner's callback.
+	RolePartner = "partner"
+)
+
 type PointsHistory struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -22,3 +39,16 @@ type PointsHistory struct {
 	Delta     int64     `json:"delta"`
 	Reason    string    `json:"reason"`
 }
+
+// PointsAdjustment records a manual change to a user's points made by an
+// administrator, together with the points history entry it produced.
+type PointsAdjustment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	ActorID   uint      `gorm:"index" json:"actor_id"`
+	Delta     int64     `json:"delta"`
+	Reason    string    `json:"reason"`
+	Ticket    string    `gorm:"index" json:"ticket,omitempty"`
+	HistoryID uint      `json:"history_id"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// VoucherCode is one code of a reward's code pool. The code itself is only
+// stored encrypted; CodeHash is a keyed hash used to reject duplicates on
+// import.
+type VoucherCode struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RewardID     uint       `gorm:"uniqueIndex:idx_reward_code" json:"reward_id"`
+	CodeHash     string     `gorm:"uniqueIndex:idx_reward_code" json:"-"`
+	Ciphertext   string     `json:"-"`
+	RedemptionID *uint      `gorm:"index" json:"redemption_id,omitempty"`
+	AssignedAt   *time.Time `json:"assigned_at,omitempty"`
+	RevealedAt   *time.Time `json:"revealed_at,omitempty"`
+}
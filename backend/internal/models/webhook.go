@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	// WebhookDead deliveries exhausted their retries and wait for an
+	// administrator to retry them.
+	WebhookDead = "dead"
+)
+
+// WebhookDelivery is one outbound fulfillment webhook and its retry state.
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	RedemptionID   uint       `gorm:"index" json:"redemption_id"`
+	RewardID       uint       `json:"reward_id"`
+	Event          string     `json:"event"`
+	URL            string     `json:"url"`
+	Payload        string     `json:"payload"`
+	Status         string     `gorm:"index" json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index" json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
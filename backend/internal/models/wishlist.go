@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// WishlistItem pins a reward a user is interested in. At most one item per
+// user is the goal they are saving toward.
+type WishlistItem struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `gorm:"uniqueIndex:idx_user_wish" json:"user_id"`
+	RewardID  uint      `gorm:"uniqueIndex:idx_user_wish" json:"reward_id"`
+	Reward    Reward    `json:"reward"`
+	IsGoal    bool      `gorm:"index" json:"is_goal"`
+
+	// Set once the matching notification was sent and cleared when the
+	// condition no longer holds, so each crossing notifies once.
+	AffordableNotified bool `json:"-"`
+	LowStockNotified   bool `json:"-"`
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+)
+
+type BadgeRepository struct {
+	db *gorm.DB
+}
+
+func NewBadgeRepository(db *gorm.DB) *BadgeRepository {
+	return &BadgeRepository{db: db}
+}
+
+func (r *BadgeRepository) List() ([]models.Badge, error) {
+	var badges []models.Badge
+	if err := r.db.Order("id asc").Find(&badges).Error; err != nil {
+		return nil, err
+	}
+	return badges, nil
+}
+
+// EnsureDefinition inserts the badge when no badge with the same code exists.
+// Existing definitions are left untouched so edits made in the database
+// survive restarts.
+func (r *BadgeRepository) EnsureDefinition(badge *models.Badge) error {
+	var existing []models.Badge
+	if err := r.db.Where("code = ?", badge.Code).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		*badge = existing[0]
+		return nil
+	}
+	return r.db.Create(badge).Error
+}
+
+func (r *BadgeRepository) ListByUser(userID uint) ([]models.UserBadge, error) {
+	var badges []models.UserBadge
+	if err := r.db.Preload("Badge").Where("user_id = ?", userID).Order("created_at asc").Find(&badges).Error; err != nil {
+		return nil, err
+	}
+	return badges, nil
+}
+
+func (r *BadgeRepository) Award(userID, badgeID uint) (*models.UserBadge, error) {
+	award := models.UserBadge{UserID: userID, BadgeID: badgeID}
+	if err := r.db.Create(&award).Error; err != nil {
+		return nil, err
+	}
+	return &award, nil
+}
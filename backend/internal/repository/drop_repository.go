@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrDropActive     = errors.New("reward already has an undrawn drop")
+	ErrAlreadyEntered = errors.New("already entered this drop")
+	ErrDropDrawn      = errors.New("drop was already drawn")
+)
+
+type DropRepository struct {
+	db *gorm.DB
+}
+
+func NewDropRepository(db *gorm.DB) *DropRepository {
+	return &DropRepository{db: db}
+}
+
+// Create stores the drop and reserves its reward so the inventory can only
+// be allocated by the drop's lottery.
+func (r *DropRepository) Create(drop *models.Drop) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Reward{}).
+			Where("id = ? AND in_drop = ? AND archived_at IS NULL", drop.RewardID, false).
+			Update("in_drop", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDropActive
+		}
+		return tx.Omit("Reward").Create(drop).Error
+	})
+}
+
+func (r *DropRepository) FindByID(id uint) (*models.Drop, error) {
+	var drop models.Drop
+	if err := r.db.Preload("Reward").First(&drop, id).Error; err != nil {
+		return nil, err
+	}
+	return &drop, nil
+}
+
+// List returns the most recent drops, newest first.
+func (r *DropRepository) List(limit int) ([]models.Drop, error) {
+	var drops []models.Drop
+	if err := r.db.Preload("Reward").Order("opens_at desc, id desc").Limit(limit).Find(&drops).Error; err != nil {
+		return nil, err
+	}
+	return drops, nil
+}
+
+// ListDue returns open drops whose entry window closed before now.
+func (r *DropRepository) ListDue(now time.Time) ([]models.Drop, error) {
+	var drops []models.Drop
+	err := r.db.Preload("Reward").
+		Where("status = ? AND closes_at <= ?", models.DropOpen, now).
+		Order("closes_at asc").
+		Find(&drops).Error
+	if err != nil {
+		return nil, err
+	}
+	return drops, nil
+}
+
+// AddEntry stores the entry and counts it on the drop in one transaction.
+func (r *DropRepository) AddEntry(entry *models.DropEntry) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(entry)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAlreadyEntered
+		}
+		return tx.Model(&models.Drop{}).Where("id = ?", entry.DropID).
+			UpdateColumn("entries", gorm.Expr("entries + 1")).Error
+	})
+}
+
+// FindEntry returns the user's entry into the drop, or nil when they did not
+// enter.
+func (r *DropRepository) FindEntry(dropID, userID uint) (*models.DropEntry, error) {
+	var entries []models.DropEntry
+	if err := r.db.Where("drop_id = ? AND user_id = ?", dropID, userID).Limit(1).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return &entries[0], nil
+}
+
+// Entries returns every entry of the drop, in lottery order once drawn.
+func (r *DropRepository) Entries(dropID uint) ([]models.DropEntry, error) {
+	var entries []models.DropEntry
+	if err := r.db.Where("drop_id = ?", dropID).Order("position asc, user_id asc").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DrawResult is one redemption created by a drop's lottery.
+type DrawResult struct {
+	User       *models.User
+	Redemption *models.Redemption
+}
+
+// Draw walks the entries in the given lottery order and redeems the reward
+// for each in turn until the inventory runs out. Entries whose redemption
+// fails the eligibility check or the balance check are marked ineligible and
+// skipped; everyone after the last unit is marked lost. The drop is marked
+// drawn and its reward released in the same transaction, so a drop is drawn
+// at most once.
+func (r *DropRepository) Draw(drop *models.Drop, seed string, ordered []models.DropEntry, check EligibilityCheck) ([]DrawResult, error) {
+	var results []DrawResult
+	guarded := func(reward *models.Reward, user *models.User, active int64) error {
+		if check == nil {
+			return nil
+		}
+		if err := check(reward, user, active); err != nil {
+			return ineligibleError{err}
+		}
+		return nil
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.Drop{}).
+			Where("id = ? AND status = ?", drop.ID, models.DropOpen).
+			Updates(map[string]interface{}{"status": models.DropDrawn, "seed": seed, "drawn_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDropDrawn
+		}
+
+		soldOut := false
+		for i := range ordered {
+			entry := &ordered[i]
+			entry.Result = models.DropEntryLost
+			entry.Reason = ""
+			if !soldOut {
+				var result DrawResult
+				err := tx.Transaction(func(inner *gorm.DB) error {
+					var err error
+					result.Redemption, result.User, err = redeem(inner, entry.UserID, drop.RewardID, guarded, drop)
+					return err
+				})
+				var ineligible ineligibleError
+				switch {
+				case err == nil:
+					entry.Result = models.DropEntryWon
+					entry.RedemptionID = &result.Redemption.ID
+					results = append(results, result)
+				case errors.Is(err, ErrRewardUnavailable):
+					soldOut = true
+				case errors.Is(err, ErrInsufficientPoints), errors.As(err, &ineligible):
+					entry.Result = models.DropEntryIneligible
+					entry.Reason = err.Error()
+				default:
+					return err
+				}
+			}
+			if err := tx.Model(entry).Select("ticket", "position", "result", "reason", "redemption_id").Updates(entry).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.Reward{}).Where("id = ?", drop.RewardID).Update("in_drop", false).Error; err != nil {
+			return err
+		}
+		drop.Status = models.DropDrawn
+		drop.Seed = seed
+		drop.DrawnAt = &now
+		drop.Winners = len(results)
+		return tx.Model(drop).Update("winners", drop.Winners).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ineligibleError marks a failed eligibility check during a draw so it can be
+// told apart from database errors.
+type ineligibleError struct {
+	err error
+}
+
+func (e ineligibleError) Error() string { return e.err.Error() }
+
+func (e ineligibleError) Unwrap() error { return e.err }
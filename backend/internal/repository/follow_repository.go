@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNotFollowing = errors.New("not following this user")
+
+type FollowRepository struct {
+	db *gorm.DB
+}
+
+func NewFollowRepository(db *gorm.DB) *FollowRepository {
+	return &FollowRepository{db: db}
+}
+
+// Follow records that followerID follows followeeID. Following a user twice
+// is a no-op.
+func (r *FollowRepository) Follow(followerID, followeeID uint) error {
+	follow := models.Follow{FollowerID: followerID, FolloweeID: followeeID}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow).Error
+}
+
+func (r *FollowRepository) Unfollow(followerID, followeeID uint) error {
+	res := r.db.Where("follower_id = ? AND followee_id = ?", followerID, followeeID).Delete(&models.Follow{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFollowing
+	}
+	return nil
+}
+
+func (r *FollowRepository) CountFollowing(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Follow{}).Where("follower_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// Following returns whom the user follows, most recent first.
+func (r *FollowRepository) Following(userID uint) ([]models.Follow, error) {
+	var follows []models.Follow
+	if err := r.db.Where("follower_id = ?", userID).Order("created_at desc, id desc").Find(&follows).Error; err != nil {
+		return nil, err
+	}
+	return follows, nil
+}
+
+// Followers returns who follows the user, most recent first.
+func (r *FollowRepository) Followers(userID uint) ([]models.Follow, error) {
+	var follows []models.Follow
+	if err := r.db.Where("followee_id = ?", userID).Order("created_at desc, id desc").Find(&follows).Error; err != nil {
+		return nil, err
+	}
+	return follows, nil
+}
+
+// FollowingIDs returns the IDs of the users the user follows.
+func (r *FollowRepository) FollowingIDs(userID uint) ([]uint, error) {
+	var ids []uint
+	if err := r.db.Model(&models.Follow{}).Where("follower_id = ?", userID).Pluck("followee_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
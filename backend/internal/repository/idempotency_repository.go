@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Reserve stores record unless the user already has a live record for the
+// same key. Expired records are replaced. It returns the existing record, or
+// nil when record was stored.
+func (r *IdempotencyRepository) Reserve(record *models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	var existing *models.IdempotencyRecord
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND idempotency_key = ? AND expires_at <= ?", record.UserID, record.Key, time.Now()).
+			Delete(&models.IdempotencyRecord{}).Error; err != nil {
+			return err
+		}
+
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			return nil
+		}
+
+		var found models.IdempotencyRecord
+		if err := tx.Where("user_id = ? AND idempotency_key = ?", record.UserID, record.Key).First(&found).Error; err != nil {
+			return err
+		}
+		existing = &found
+		return nil
+	})
+	return existing, err
+}
+
+func (r *IdempotencyRepository) Complete(record *models.IdempotencyRecord) error {
+	return r.db.Model(record).Select("status_code", "content_type", "body").Updates(record).Error
+}
+
+func (r *IdempotencyRepository) Delete(record *models.IdempotencyRecord) error {
+	return r.db.Delete(record).Error
+}
+
+// PurgeExpired removes records whose TTL has passed and returns how many were
+// deleted.
+func (r *IdempotencyRepository) PurgeExpired(now time.Time) (int64, error) {
+	res := r.db.Where("expires_at <= ?", now).Delete(&models.IdempotencyRecord{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+)
+
+type LeaderboardRepository struct {
+	db *gorm.DB
+}
+
+func NewLeaderboardRepository(db *gorm.DB) *LeaderboardRepository {
+	return &LeaderboardRepository{db: db}
+}
+
+// Archived reports whether final standings were stored for the period.
+func (r *LeaderboardRepository) Archived(period, key string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.LeaderboardStanding{}).
+		Where("period = ? AND period_key = ?", period, key).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *LeaderboardRepository) Archive(standings []models.LeaderboardStanding) error {
+	if len(standings) == 0 {
+		return nil
+	}
+	return r.db.Create(&standings).Error
+}
+
+func (r *LeaderboardRepository) Standings(period, key string, limit int) ([]models.LeaderboardStanding, error) {
+	var standings []models.LeaderboardStanding
+	err := r.db.Where("period = ? AND period_key = ?", period, key).
+		Order("rank asc, id asc").
+		Limit(limit).
+		Find(&standings).Error
+	if err != nil {
+		return nil, err
+	}
+	return standings, nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+)
+
+type ReferralRepository struct {
+	db *gorm.DB
+}
+
+func NewReferralRepository(db *gorm.DB) *ReferralRepository {
+	return &ReferralRepository{db: db}
+}
+
+func (r *ReferralRepository) Create(referral *models.Referral) error {
+	return r.db.Create(referral).Error
+}
+
+// FindPendingByInvitee returns the pending referral of the invitee, or nil
+// when there is none.
+func (r *ReferralRepository) FindPendingByInvitee(inviteeID uint) (*models.Referral, error) {
+	var referrals []models.Referral
+	err := r.db.Where("invitee_id = ? AND status = ?", inviteeID, models.ReferralPending).Limit(1).Find(&referrals).Error
+	if err != nil || len(referrals) == 0 {
+		return nil, err
+	}
+	return &referrals[0], nil
+}
+
+func (r *ReferralRepository) ListByInviter(inviterID uint) ([]models.Referral, error) {
+	var referrals []models.Referral
+	if err := r.db.Preload("Invitee").Where("inviter_id = ?", inviterID).Order("created_at desc").Find(&referrals).Error; err != nil {
+		return nil, err
+	}
+	return referrals, nil
+}
+
+// Complete grants both referral bonuses and marks the referral completed in a
+// single transaction.
+func (r *ReferralRepository) Complete(referral *models.Referral) (inviter, invitee *models.User, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(referral).Where("status = ?", models.ReferralPending).Updates(map[string]interface{}{
+			"status":       models.ReferralCompleted,
+			"completed_at": referral.CompletedAt,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if inviter, _, err = addPoints(tx, referral.InviterID, referral.InviterBonus, "referral_bonus"); err != nil {
+			return err
+		}
+		invitee, _, err = addPoints(tx, referral.InviteeID, referral.InviteeBonus, "referral_bonus")
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	referral.Status = models.ReferralCompleted
+	return inviter, invitee, nil
+}
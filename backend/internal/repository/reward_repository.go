@@ -1,6 +1,11 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/example/solo_journey/internal/models"
 	"gorm.io/gorm"
 )
@@ -13,9 +18,134 @@ func NewRewardRepository(db *gorm.DB) *RewardRepository {
 	return &RewardRepository{db: db}
 }
 
+// List returns the rewards shown in the public catalog: published and not
+// archived.
 func (r *RewardRepository) List() ([]models.Reward, error) {
 	var rewards []models.Reward
-	if err := r.db.Find(&rewards).Error; err != nil {
+	if err := r.db.Where("hidden = ? AND archived_at IS NULL", false).Find(&rewards).Error; err != nil {
+		return nil, err
+	}
+	return rewards, nil
+}
+
+// Catalog sort orders accepted by RewardQuery.Sort.
+const (
+	RewardSortCostAsc    = "cost_asc"
+	RewardSortCostDesc   = "cost_desc"
+	RewardSortPopularity = "popularity"
+	RewardSortNewest     = "newest"
+)
+
+// RewardQuery filters and pages the public catalog. Zero values and a nil
+// MaxCost disable a filter.
+type RewardQuery struct {
+	Category string
+	Tag      string
+	Search   string
+	MaxCost  *int64
+	Sort     string
+	Limit    int
+	Offset   int
+}
+
+// likeEscaper makes user input match literally in a LIKE pattern declared
+// with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// ListCatalog returns one page of published rewards matching q together with
+// the total number of matches. RedemptionCount is filled in from the
+// redemptions that were not refunded.
+func (r *RewardRepository) ListCatalog(q RewardQuery) ([]models.Reward, int64, error) {
+	counts := r.db.Model(&models.Redemption{}).
+		Select("reward_id, count(*) as redemption_count").
+		Where("status NOT IN ?", refundedStatuses).
+		Group("reward_id")
+
+	filtered := func() *gorm.DB {
+		query := r.db.Model(&models.Reward{}).
+			Where("hidden = ? AND archived_at IS NULL", false)
+		if q.Category != "" {
+			query = query.Where("category = ?", q.Category)
+		}
+		if q.Tag != "" {
+			query = query.Where(`(',' || tags || ',') LIKE ? ESCAPE '\'`, "%,"+escapeLike(q.Tag)+",%")
+		}
+		if q.Search != "" {
+			like := "%" + escapeLike(strings.ToLower(q.Search)) + "%"
+			query = query.Where(`(lower(name) LIKE ? ESCAPE '\' OR lower(description) LIKE ? ESCAPE '\')`, like, like)
+		}
+		if q.MaxCost != nil {
+			query = query.Where("points_cost <= ?", *q.MaxCost)
+		}
+		return query
+	}
+
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query := filtered()
+
+	switch q.Sort {
+	case RewardSortCostAsc:
+		query = query.Order("points_cost asc")
+	case RewardSortCostDesc:
+		query = query.Order("points_cost desc")
+	case RewardSortPopularity:
+		query = query.Order("redemption_count desc")
+	case RewardSortNewest:
+		query = query.Order("rewards.created_at desc")
+	}
+
+	var rewards []models.Reward
+	err := query.
+		Select("rewards.*, coalesce(rc.redemption_count, 0) as redemption_count").
+		Joins("LEFT JOIN (?) AS rc ON rc.reward_id = rewards.id", counts).
+		Order("rewards.id asc").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Find(&rewards).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return rewards, total, nil
+}
+
+// Categories returns the categories used by published rewards with how many
+// rewards each holds.
+func (r *RewardRepository) Categories() ([]CategoryCount, error) {
+	var categories []CategoryCount
+	err := r.db.Model(&models.Reward{}).
+		Select("category, count(*) as rewards").
+		Where("hidden = ? AND archived_at IS NULL AND category <> ''", false).
+		Group("category").
+		Order("category asc").
+		Scan(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+type CategoryCount struct {
+	Category string `json:"category"`
+	Rewards  int64  `json:"rewards"`
+}
+
+// ListAll returns every reward for administrators, optionally including
+// archived ones.
+func (r *RewardRepository) ListAll(includeArchived bool) ([]models.Reward, error) {
+	var rewards []models.Reward
+	query := r.db.Order("id asc")
+	if !includeArchived {
+		query = query.Where("archived_at IS NULL")
+	}
+	if err := query.Find(&rewards).Error; err != nil {
 		return nil, err
 	}
 	return rewards, nil
@@ -25,6 +155,68 @@ func (r *RewardRepository) Create(reward *models.Reward) error {
 	return r.db.Create(reward).Error
 }
 
+// CreateWithStock stores a new reward and audits its initial inventory.
+func (r *RewardRepository) CreateWithStock(reward *models.Reward, actorID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(reward).Error; err != nil {
+			return err
+		}
+		event := models.RewardStockEvent{
+			RewardID:       reward.ID,
+			ActorID:        actorID,
+			Delta:          reward.Inventory,
+			InventoryAfter: reward.Inventory,
+			Reason:         "initial stock",
+		}
+		return tx.Create(&event).Error
+	})
+}
+
+// Restock adds delta units to the reward's inventory and records the change.
+// Negative deltas remove stock but never below zero.
+func (r *RewardRepository) Restock(rewardID, actorID uint, delta int, reason string) (*models.Reward, *models.RewardStockEvent, error) {
+	var reward models.Reward
+	var event models.RewardStockEvent
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Reward{}).
+			Where("id = ? AND inventory + ? >= 0", rewardID, delta).
+			UpdateColumn("inventory", gorm.Expr("inventory + ?", delta))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			if err := tx.First(&reward, rewardID).Error; err != nil {
+				return err
+			}
+			return ErrInsufficientStock
+		}
+		if err := tx.First(&reward, rewardID).Error; err != nil {
+			return err
+		}
+
+		event = models.RewardStockEvent{
+			RewardID:       rewardID,
+			ActorID:        actorID,
+			Delta:          delta,
+			InventoryAfter: reward.Inventory,
+			Reason:         reason,
+		}
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &reward, &event, nil
+}
+
+func (r *RewardRepository) ListStockEvents(rewardID uint) ([]models.RewardStockEvent, error) {
+	var events []models.RewardStockEvent
+	if err := r.db.Where("reward_id = ?", rewardID).Order("created_at desc, id desc").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
 func (r *RewardRepository) FindByID(id uint) (*models.Reward, error) {
 	var reward models.Reward
 	if err := r.db.First(&reward, id).Error; err != nil {
@@ -37,13 +229,280 @@ func (r *RewardRepository) Update(reward *models.Reward) error {
 	return r.db.Save(reward).Error
 }
 
+// UpdateColumns updates only the given columns of the reward, leaving the
+// inventory to the conditional updates used by redemptions and restocks.
+func (r *RewardRepository) UpdateColumns(id uint, values map[string]interface{}) (*models.Reward, error) {
+	res := r.db.Model(&models.Reward{}).Where("id = ?", id).Updates(values)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.FindByID(id)
+}
+
+var (
+	ErrRewardUnavailable = errors.New("reward unavailable")
+	ErrInsufficientStock = errors.New("inventory cannot go below zero")
+	ErrRedemptionChanged = errors.New("redemption status changed concurrently")
+	// ErrVoucherRevealed is returned when refunding a redemption whose
+	// voucher code its owner has already seen.
+	ErrVoucherRevealed = errors.New("voucher code was already revealed")
+)
+
+// EligibilityCheck decides inside the redemption transaction whether the user
+// may redeem the reward. active is the number of redemptions of the reward
+// the user already holds that were not cancelled, rejected or expired.
+type EligibilityCheck func(reward *models.Reward, user *models.User, active int64) error
+
+// Redeem atomically takes one unit of the reward's inventory, deducts its cost
+// from the user and records the redemption. Eligibility, inventory and balance
+// are all checked inside a single transaction, the latter two by conditional
+// updates, so concurrent redemptions can neither oversell the reward nor
+// charge a user for a redemption that was not created.
+func (r *RewardRepository) Redeem(userID, rewardID uint, check EligibilityCheck) (*models.Redemption, *models.User, error) {
+	var redemption *models.Redemption
+	var user *models.User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		redemption, user, err = redeem(tx, userID, rewardID, check, nil)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return redemption, user, nil
+}
+
+// redeem performs a redemption inside tx. Without a drop the reward must not
+// be reserved for one; with a drop the unit is taken from its reservation and
+// the redemption is recorded as allocated by the drop's lottery.
+func redeem(tx *gorm.DB, userID, rewardID uint, check EligibilityCheck, drop *models.Drop) (*models.Redemption, *models.User, error) {
+	var reward models.Reward
+	var user models.User
+	if err := tx.First(&reward, rewardID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if check != nil {
+		if err := tx.First(&user, userID).Error; err != nil {
+			return nil, nil, err
+		}
+		var active int64
+		err := tx.Model(&models.Redemption{}).
+			Where("user_id = ? AND reward_id = ? AND status NOT IN ?", userID, rewardID, refundedStatuses).
+			Count(&active).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := check(&reward, &user, active); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	res := tx.Model(&models.Reward{}).
+		Where("id = ? AND inventory > 0 AND hidden = ? AND archived_at IS NULL AND in_drop = ?", rewardID, false, drop != nil).
+		UpdateColumn("inventory", gorm.Expr("inventory - 1"))
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil, ErrRewardUnavailable
+	}
+
+	res = tx.Model(&models.User{}).
+		Where("id = ? AND points >= ?", userID, reward.PointsCost).
+		UpdateColumn("points", gorm.Expr("points - ?", reward.PointsCost))
+	if res.Error != nil {
+		return nil, nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil, ErrInsufficientPoints
+	}
+
+	if err := tx.First(&user, userID).Error; err != nil {
+		return nil, nil, err
+	}
+	user.Level = calculateLevel(user.Points)
+	if err := tx.Model(&user).UpdateColumn("level", user.Level).Error; err != nil {
+		return nil, nil, err
+	}
+
+	history := models.PointsHistory{UserID: userID, Delta: -reward.PointsCost, Reason: "redeem"}
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, nil, err
+	}
+
+	reward.Inventory--
+	redemption := &models.Redemption{
+		UserID:     userID,
+		RewardID:   reward.ID,
+		Status:     models.RedemptionPending,
+		PointsCost: reward.PointsCost,
+		Reward:     reward,
+	}
+	if err := tx.Omit("Reward").Create(redemption).Error; err != nil {
+		return nil, nil, err
+	}
+
+	if reward.UsesCodes {
+		if err := assignVoucherCode(tx, reward.ID, redemption.ID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	event := models.RedemptionEvent{
+		RedemptionID: redemption.ID,
+		ToStatus:     models.RedemptionPending,
+		ActorID:      userID,
+		ActorRole:    models.RoleUser,
+	}
+	if drop != nil {
+		event.ActorID = 0
+		event.ActorRole = models.RoleSystem
+		event.Note = fmt.Sprintf("won flash drop %d", drop.ID)
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return nil, nil, err
+	}
+	redemption.History = []models.RedemptionEvent{event}
+	return redemption, &user, nil
+}
+
 func (r *RewardRepository) CreateRedemption(redemption *models.Redemption) error {
 	return r.db.Create(redemption).Error
 }
 
+func (r *RewardRepository) FindRedemption(id uint) (*models.Redemption, error) {
+	var redemption models.Redemption
+	if err := r.db.Preload("Reward").Preload("History", orderHistory).First(&redemption, id).Error; err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// TransitionRedemption moves the redemption from its current status to
+// event.ToStatus and appends event to its history. When refund is set the
+// points paid are returned to the user and the unit goes back into the
+// reward's inventory. The update only applies if the status has not changed
+// since the redemption was loaded, so concurrent transitions cannot both
+// succeed.
+func (r *RewardRepository) TransitionRedemption(redemption *models.Redemption, event models.RedemptionEvent, refund bool) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Redemption{}).
+			Where("id = ? AND status = ?", redemption.ID, redemption.Status).
+			Update("status", event.ToStatus)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRedemptionChanged
+		}
+
+		if refund {
+			cost := redemption.PointsCost
+			if cost == 0 {
+				cost = redemption.Reward.PointsCost
+			}
+			if _, _, err := addPoints(tx, redemption.UserID, cost, "refund"); err != nil {
+				return err
+			}
+			restore := true
+			if redemption.Reward.UsesCodes {
+				released, err := releaseVoucherCode(tx, redemption.ID)
+				if err != nil {
+					return err
+				}
+				if !released {
+					var revealed int64
+					if err := tx.Model(&models.VoucherCode{}).
+						Where("redemption_id = ? AND revealed_at IS NOT NULL", redemption.ID).
+						Count(&revealed).Error; err != nil {
+						return err
+					}
+					if revealed > 0 {
+						return ErrVoucherRevealed
+					}
+				}
+				restore = released
+			}
+			if restore {
+				err := tx.Model(&models.Reward{}).
+					Where("id = ?", redemption.RewardID).
+					UpdateColumn("inventory", gorm.Expr("inventory + 1")).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		event.RedemptionID = redemption.ID
+		event.FromStatus = redemption.Status
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+		redemption.History = append(redemption.History, event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	redemption.Status = event.ToStatus
+	return nil
+}
+
+// VoucherRevealed reports whether the voucher code assigned to the redemption
+// has been shown to its owner.
+func (r *RewardRepository) VoucherRevealed(redemptionID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.VoucherCode{}).
+		Where("redemption_id = ? AND revealed_at IS NOT NULL", redemptionID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListRedemptions returns redemptions, newest first, optionally filtered by
+// status.
+func (r *RewardRepository) ListRedemptions(status string, limit int) ([]models.Redemption, error) {
+	var redemptions []models.Redemption
+	query := r.db.Preload("Reward").Preload("History", orderHistory).Order("created_at desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&redemptions).Error; err != nil {
+		return nil, err
+	}
+	return redemptions, nil
+}
+
+// ListOpenRedemptionsBefore returns pending or approved redemptions created
+// before the given time.
+func (r *RewardRepository) ListOpenRedemptionsBefore(before time.Time) ([]models.Redemption, error) {
+	var redemptions []models.Redemption
+	err := r.db.Preload("Reward").
+		Where("status IN ? AND created_at < ?", []string{models.RedemptionPending, models.RedemptionApproved}, before).
+		Find(&redemptions).Error
+	if err != nil {
+		return nil, err
+	}
+	return redemptions, nil
+}
+
+// refundedStatuses are the final redemption statuses that gave the points
+// back and no longer count against per-user limits.
+var refundedStatuses = []string{models.RedemptionRejected, models.RedemptionCancelled, models.RedemptionExpired}
+
+func orderHistory(db *gorm.DB) *gorm.DB {
+	return db.Order("created_at asc, id asc")
+}
+
 func (r *RewardRepository) ListRedemptionsByUser(userID uint, limit int) ([]models.Redemption, error) {
 	var redemptions []models.Redemption
-	query := r.db.Preload("Reward").Where("user_id = ?", userID).Order("created_at desc")
+	query := r.db.Preload("Reward").Preload("History", orderHistory).Where("user_id = ?", userID).Order("created_at desc")
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
@@ -53,6 +512,28 @@ func (r *RewardRepository) ListRedemptionsByUser(userID uint, limit int) ([]mode
 	return redemptions, nil
 }
 
+// ActiveRedemptionCounts returns, per reward, how many redemptions the user
+// holds that were not refunded.
+func (r *RewardRepository) ActiveRedemptionCounts(userID uint) (map[uint]int64, error) {
+	var rows []struct {
+		RewardID uint
+		Count    int64
+	}
+	err := r.db.Model(&models.Redemption{}).
+		Select("reward_id, count(*) as count").
+		Where("user_id = ? AND status NOT IN ?", userID, refundedStatuses).
+		Group("reward_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.RewardID] = row.Count
+	}
+	return counts, nil
+}
+
 func (r *RewardRepository) CountRedemptionsByUser(userID uint) (int64, error) {
 	var count int64
 	if err := r.db.Model(&models.Redemption{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
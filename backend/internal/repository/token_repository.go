@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrRefreshTokenUsed is returned when a refresh token was already
+	// exchanged.
+	ErrRefreshTokenUsed = errors.New("refresh token already used")
+	ErrSessionNotFound  = errors.New("session not found")
+)
+
+// TokenRepository stores refresh tokens, the sessions they belong to and the
+// revocation list.
+type TokenRepository struct {
+	db *gorm.DB
+}
+
+func NewTokenRepository(db *gorm.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+// CreateSession stores a new session together with the first refresh token
+// of its family.
+func (r *TokenRepository) CreateSession(session *models.Session, token *models.RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// CreateMissingSessions adds a session for every live token family without
+// one, as left by logins made before sessions were recorded. The device
+// details of those logins are unknown. It returns how many were added.
+func (r *TokenRepository) CreateMissingSessions(now time.Time) (int64, error) {
+	res := r.db.Exec(`INSERT INTO sessions (created_at, user_id, family_id, device_name, ip, user_agent, last_seen_at, expires_at)
+		SELECT MIN(created_at), user_id, family_id, '', '', '', MAX(created_at), MAX(expires_at)
+		FROM refresh_tokens
+		WHERE family_id IN (SELECT family_id FROM refresh_tokens WHERE used_at IS NULL AND revoked_at IS NULL AND expires_at > ?)
+		AND family_id NOT IN (SELECT family_id FROM sessions)
+		GROUP BY user_id, family_id`, now)
+	return res.RowsAffected, res.Error
+}
+
+func (r *TokenRepository) FindByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := r.db.Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Rotate marks old as used and stores next in its place. Only one of several
+// concurrent rotations of the same token succeeds; the others get
+// ErrRefreshTokenUsed.
+func (r *TokenRepository) Rotate(old, next *models.RefreshToken, now time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", old.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRefreshTokenUsed
+		}
+		if err := tx.Model(&models.Session{}).Where("family_id = ?", old.FamilyID).
+			Updates(map[string]interface{}{"last_seen_at": now, "expires_at": next.ExpiresAt}).Error; err != nil {
+			return err
+		}
+		return tx.Create(next).Error
+	})
+}
+
+// ActiveSessions returns the user's sessions that are neither revoked nor
+// expired, most recently seen first.
+func (r *TokenRepository) ActiveSessions(userID uint, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at desc, id desc").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// FindActiveSession returns one of the user's active sessions.
+func (r *TokenRepository) FindActiveSession(userID, id uint, now time.Time) (*models.Session, error) {
+	var session models.Session
+	err := r.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, now).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// TouchSession records activity of the session of a token family.
+func (r *TokenRepository) TouchSession(familyID, ip string, at time.Time) error {
+	return r.db.Model(&models.Session{}).Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"last_seen_at": at, "ip": ip}).Error
+}
+
+// RevokeFamily revokes every refresh token of the family, ends its session
+// and adds it to the revocation list until the given time. Revoking a family
+// twice keeps the first entry.
+func (r *TokenRepository) RevokeFamily(revocation *models.RevokedTokenFamily) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.RefreshToken{}, &models.Session{}} {
+			if err := tx.Model(model).
+				Where("family_id = ? AND revoked_at IS NULL", revocation.FamilyID).
+				Update("revoked_at", revocation.CreatedAt).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(revocation).Error
+	})
+}
+
+// RevokedFamilies returns the revocation list entries still in force.
+func (r *TokenRepository) RevokedFamilies(now time.Time) ([]models.RevokedTokenFamily, error) {
+	var revoked []models.RevokedTokenFamily
+	if err := r.db.Where("expires_at > ?", now).Find(&revoked).Error; err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// FindRevocation returns the revocation list entry of a family if it is still
+// in force.
+func (r *TokenRepository) FindRevocation(familyID string, now time.Time) (*models.RevokedTokenFamily, error) {
+	var revocation models.RevokedTokenFamily
+	if err := r.db.Where("family_id = ? AND expires_at > ?", familyID, now).First(&revocation).Error; err != nil {
+		return nil, err
+	}
+	return &revocation, nil
+}
+
+// PurgeExpired removes expired refresh tokens, sessions and revocation list
+// entries and returns how many rows were deleted. Revoked sessions are kept
+// until their tokens would have expired.
+func (r *TokenRepository) PurgeExpired(now time.Time) (int64, error) {
+	var purged int64
+	for _, model := range []interface{}{&models.RefreshToken{}, &models.Session{}, &models.RevokedTokenFamily{}} {
+		res := r.db.Where("expires_at <= ?", now).Delete(model)
+		if res.Error != nil {
+			return purged, res.Error
+		}
+		purged += res.RowsAffected
+	}
+	return purged, nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/example/solo_journey/internal/models"
 	"gorm.io/gorm"
@@ -19,6 +20,50 @@ func (r *TripRepository) Create(trip *models.TripPost) error {
 	return r.db.Create(trip).Error
 }
 
+// AwardLimit decides inside the award transaction how many points a new trip
+// earns, reading earlier trips and awards through the repositories it is
+// given.
+type AwardLimit func(trips *TripRepository, users *UserRepository) (int64, error)
+
+// CreateAwarded stores the trip and grants the points decided by limit in one
+// transaction. The user row is written first, so concurrent posts by the
+// same user wait for each other and each limit sees the awards before it.
+func (r *TripRepository) CreateAwarded(trip *models.TripPost, limit AwardLimit) (*models.User, error) {
+	var user *models.User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).Where("id = ?", trip.UserID).Update("updated_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		awarded, err := limit(&TripRepository{db: tx}, &UserRepository{db: tx})
+		if err != nil {
+			return err
+		}
+		trip.AwardedPoints = awarded
+		if err := tx.Create(trip).Error; err != nil {
+			return err
+		}
+		if awarded <= 0 {
+			var current models.User
+			if err := tx.First(&current, trip.UserID).Error; err != nil {
+				return err
+			}
+			user = &current
+			return nil
+		}
+		user, _, err = addPoints(tx, trip.UserID, awarded, "activity")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 func (r *TripRepository) List(limit int) ([]models.TripPost, error) {
 	var trips []models.TripPost
 	if err := r.db.Preload("Media").Preload("User").Order("created_at desc").Limit(limit).Find(&trips).Error; err != nil {
@@ -55,6 +100,66 @@ func (r *TripRepository) CountByUser(userID uint) (int64, error) {
 	return count, nil
 }
 
+func (r *TripRepository) CountVerifiedByUser(userID uint) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.TripPost{}).Where("user_id = ? AND verified = ?", userID, true).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *TripRepository) CountCountriesByUser(userID uint) (int64, error) {
+	var count int64
+	if err := r.db.Model(&models.TripPost{}).Where("user_id = ? AND country <> ''", userID).Distinct("country").Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *TripRepository) CountByLocationSince(userID uint, location string, since time.Time) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.TripPost{}).
+		Where("user_id = ? AND lower(location) = lower(?) AND created_at >= ?", userID, location, since).
+		Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// VerifiedPostTimes returns the creation time of every verified trip of the
+// user in ascending order.
+func (r *TripRepository) VerifiedPostTimes(userID uint) ([]time.Time, error) {
+	var times []time.Time
+	if err := r.db.Model(&models.TripPost{}).Where("user_id = ? AND verified = ?", userID, true).Order("created_at asc").Pluck("created_at", &times).Error; err != nil {
+		return nil, err
+	}
+	return times, nil
+}
+
+// TripActivity is the subset of a trip needed to build activity calendars.
+type TripActivity struct {
+	CreatedAt time.Time
+	VisitedAt time.Time
+	Verified  bool
+}
+
+// ActivityByUser returns the trips of the user that were either posted or
+// visited within [from, to).
+func (r *TripRepository) ActivityByUser(userID uint, from, to time.Time) ([]TripActivity, error) {
+	var activity []TripActivity
+	err := r.db.Model(&models.TripPost{}).
+		Select("created_at, visited_at, verified").
+		Where("user_id = ?", userID).
+		Where("(created_at >= ? AND created_at < ?) OR (visited_at >= ? AND visited_at < ?)", from, to, from, to).
+		Order("created_at asc").
+		Scan(&activity).Error
+	if err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
 func (r *TripRepository) AverageScoreByUser(userID uint) (float64, error) {
 	var avg sql.NullFloat64
 	if err := r.db.Model(&models.TripPost{}).Where("user_id = ?", userID).Select("avg(score)").Scan(&avg).Error; err != nil {
@@ -65,3 +170,47 @@ func (r *TripRepository) AverageScoreByUser(userID uint) (float64, error) {
 	}
 	return 0, nil
 }
+
+// CountryScore is the points a user's trips earned in one country. ReachedAt
+// is when the latest of those trips was posted.
+type CountryScore struct {
+	Country   string
+	UserID    uint
+	Points    int64
+	ReachedAt time.Time
+}
+
+// PointsByCountry sums the awarded points of all trips per country and user.
+func (r *TripRepository) PointsByCountry() ([]CountryScore, error) {
+	awarded := func() *gorm.DB {
+		return r.db.Model(&models.TripPost{}).Where("country <> '' AND awarded_points > 0")
+	}
+	var scores []CountryScore
+	err := awarded().
+		Select("country, user_id, sum(awarded_points) as points").
+		Group("country, user_id").
+		Scan(&scores).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var latest []models.TripPost
+	err = r.db.Select("user_id, country, created_at").
+		Where("id IN (?)", awarded().Select("max(id)").Group("country, user_id")).
+		Find(&latest).Error
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		country string
+		userID  uint
+	}
+	reached := make(map[key]time.Time, len(latest))
+	for _, t := range latest {
+		reached[key{t.Country, t.UserID}] = t.CreatedAt
+	}
+	for i := range scores {
+		scores[i].ReachedAt = reached[key{scores[i].Country, scores[i].UserID}]
+	}
+	return scores, nil
+}
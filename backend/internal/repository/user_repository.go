@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/example/solo_journey/internal/models"
 	"gorm.io/gorm"
@@ -27,6 +29,24 @@ func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
+// FindByInviteCode returns the user owning the invite code, matched
+// case-insensitively.
+func (r *UserRepository) FindByInviteCode(code string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("upper(invite_code) = upper(?)", code).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepository) InviteCodeExists(code string) (bool, error) {
+	var count int64
+	if err := r.db.Model(&models.User{}).Where("upper(invite_code) = upper(?)", code).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func (r *UserRepository) FindByID(id uint) (*models.User, error) {
 	var user models.User
 	if err := r.db.First(&user, id).Error; err != nil {
@@ -35,29 +55,117 @@ func (r *UserRepository) FindByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
+// SetRole changes the role of the user with the given email, ignoring case.
+func (r *UserRepository) SetRole(email, role string) (*models.User, error) {
+	var user models.User
+	if err := r.db.Where("lower(email) = lower(?)", email).First(&user).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.Model(&user).Update("role", role).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (r *UserRepository) Update(user *models.User) error {
 	return r.db.Save(user).Error
 }
 
 func (r *UserRepository) IncrementPoints(userID uint, delta int64) (*models.User, error) {
+	return r.AddPoints(userID, delta, "activity")
+}
+
+// AddPoints applies delta to the user's balance and records it in the points
+// history under the given reason.
+func (r *UserRepository) AddPoints(userID uint, delta int64, reason string) (*models.User, error) {
+	user, _, err := addPoints(r.db, userID, delta, reason)
+	return user, err
+}
+
+func addPoints(db *gorm.DB, userID uint, delta int64, reason string) (*models.User, *models.PointsHistory, error) {
 	var user models.User
-	if err := r.db.First(&user, userID).Error; err != nil {
-		return nil, err
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, nil, err
 	}
 
 	user.Points += delta
 	user.Level = calculateLevel(user.Points)
 
-	if err := r.db.Save(&user).Error; err != nil {
-		return nil, err
+	if err := db.Save(&user).Error; err != nil {
+		return nil, nil, err
+	}
+
+	history := models.PointsHistory{UserID: user.ID, Delta: delta, Reason: reason}
+	if err := db.Create(&history).Error; err != nil {
+		return nil, nil, err
 	}
 
-	history := models.PointsHistory{UserID: user.ID, Delta: delta, Reason: "activity"}
-	if err := r.db.Create(&history).Error; err != nil {
+	return &user, &history, nil
+}
+
+// AdjustPoints applies a manual adjustment to the user's balance, writing the
+// points history entry and the adjustment record in one transaction.
+// Deductions larger than the current balance fail with ErrInsufficientPoints.
+func (r *UserRepository) AdjustPoints(adjustment *models.PointsAdjustment) (*models.User, error) {
+	var user *models.User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var current models.User
+		if err := tx.First(&current, adjustment.UserID).Error; err != nil {
+			return err
+		}
+		if current.Points+adjustment.Delta < 0 {
+			return ErrInsufficientPoints
+		}
+
+		updated, history, err := addPoints(tx, adjustment.UserID, adjustment.Delta, "admin_adjustment")
+		if err != nil {
+			return err
+		}
+		adjustment.HistoryID = history.ID
+		user = updated
+		return tx.Create(adjustment).Error
+	})
+	if err != nil {
 		return nil, err
 	}
+	return user, nil
+}
 
-	return &user, nil
+// AdjustmentFilter narrows ListAdjustments. Zero values are ignored.
+type AdjustmentFilter struct {
+	UserID  uint
+	ActorID uint
+	Ticket  string
+	From    time.Time
+	To      time.Time
+	Limit   int
+}
+
+func (r *UserRepository) ListAdjustments(filter AdjustmentFilter) ([]models.PointsAdjustment, error) {
+	var adjustments []models.PointsAdjustment
+	query := r.db.Order("created_at desc")
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Ticket != "" {
+		query = query.Where("ticket = ?", filter.Ticket)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if err := query.Find(&adjustments).Error; err != nil {
+		return nil, err
+	}
+	return adjustments, nil
 }
 
 var levelThresholds = []int64{0, 100, 500, 1000, 2000, 5000}
@@ -102,25 +210,32 @@ func LevelThreshold(level int) int64 {
 
 var ErrInsufficientPoints = errors.New("insufficient points")
 
-func (r *UserRepository) RedeemPoints(userID uint, cost int64) (*models.User, error) {
-	var user models.User
-	if err := r.db.First(&user, userID).Error; err != nil {
-		return nil, err
-	}
-
-	if user.Points < cost {
-		return nil, ErrInsufficientPoints
+// EarnedSince sums the positive points the user earned for the given reason
+// since the given time.
+func (r *UserRepository) EarnedSince(userID uint, reason string, since time.Time) (int64, error) {
+	var total sql.NullInt64
+	err := r.db.Model(&models.PointsHistory{}).
+		Where("user_id = ? AND reason = ? AND delta > 0 AND created_at >= ?", userID, reason, since).
+		Select("sum(delta)").
+		Scan(&total).Error
+	if err != nil {
+		return 0, err
 	}
+	return total.Int64, nil
+}
 
-	user.Points -= cost
-	user.Level = calculateLevel(user.Points)
-
-	if err := r.db.Save(&user).Error; err != nil {
-		return nil, err
+// LastEarnedAt returns when the user last earned points for the given reason,
+// or the zero time when they never did.
+func (r *UserRepository) LastEarnedAt(userID uint, reason string) (time.Time, error) {
+	var history []models.PointsHistory
+	err := r.db.Where("user_id = ? AND reason = ? AND delta > 0", userID, reason).
+		Order("created_at desc").
+		Limit(1).
+		Find(&history).Error
+	if err != nil || len(history) == 0 {
+		return time.Time{}, err
 	}
-
-	history := models.PointsHistory{UserID: user.ID, Delta: -cost, Reason: "redeem"}
-	return &user, r.db.Create(&history).Error
+	return history[0].CreatedAt, nil
 }
 
 func (r *UserRepository) PointsHistory(userID uint, limit int) ([]models.PointsHistory, error) {
@@ -134,3 +249,87 @@ func (r *UserRepository) PointsHistory(userID uint, limit int) ([]models.PointsH
 	}
 	return history, nil
 }
+
+// UserScore is a user's current point total. ReachedAt is when the total was
+// reached: the time of the user's latest points history entry, or the sign
+// up time for users without one.
+type UserScore struct {
+	ID        uint
+	Points    int64
+	ReachedAt time.Time
+}
+
+// Scores returns the point total of every user.
+func (r *UserRepository) Scores() ([]UserScore, error) {
+	var scores []UserScore
+	if err := r.db.Model(&models.User{}).Select("id, points, created_at as reached_at").Order("id asc").Scan(&scores).Error; err != nil {
+		return nil, err
+	}
+
+	if err := r.stampReachedAt(scores, r.db.Model(&models.PointsHistory{})); err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+// stampReachedAt sets the ReachedAt of every score to the time of the user's
+// latest points history entry matched by entries. Scores without one keep
+// their time.
+func (r *UserRepository) stampReachedAt(scores []UserScore, entries *gorm.DB) error {
+	var latest []models.PointsHistory
+	err := r.db.Select("user_id, created_at").
+		Where("id IN (?)", entries.Select("max(id)").Group("user_id")).
+		Find(&latest).Error
+	if err != nil {
+		return err
+	}
+	reached := make(map[uint]time.Time, len(latest))
+	for _, h := range latest {
+		reached[h.UserID] = h.CreatedAt
+	}
+	for i := range scores {
+		if at, ok := reached[scores[i].ID]; ok {
+			scores[i].ReachedAt = at
+		}
+	}
+	return nil
+}
+
+// FindByIDs loads the given users in one query. Unknown IDs are skipped.
+func (r *UserRepository) FindByIDs(ids []uint) ([]models.User, error) {
+	var users []models.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	if err := r.db.Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// nonEarningReasons are ledger entries that move points without earning
+// them and are left out of windowed leaderboards.
+var nonEarningReasons = []string{"redeem", "refund"}
+
+// EarnedBetween returns the points each user earned in [from, to), skipping
+// users who earned nothing. ReachedAt is the time of the user's last earning
+// in the window.
+func (r *UserRepository) EarnedBetween(from, to time.Time) ([]UserScore, error) {
+	var scores []UserScore
+	err := r.db.Model(&models.PointsHistory{}).
+		Select("user_id as id, sum(delta) as points").
+		Where("created_at >= ? AND created_at < ? AND reason NOT IN ?", from, to, nonEarningReasons).
+		Group("user_id").
+		Having("sum(delta) <> 0").
+		Order("user_id asc").
+		Scan(&scores).Error
+	if err != nil {
+		return nil, err
+	}
+	window := r.db.Model(&models.PointsHistory{}).
+		Where("created_at >= ? AND created_at < ? AND reason NOT IN ?", from, to, nonEarningReasons)
+	if err := r.stampReachedAt(scores, window); err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
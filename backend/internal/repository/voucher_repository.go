@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type VoucherRepository struct {
+	db *gorm.DB
+}
+
+func NewVoucherRepository(db *gorm.DB) *VoucherRepository {
+	return &VoucherRepository{db: db}
+}
+
+type VoucherStats struct {
+	Total     int64 `json:"total"`
+	Available int64 `json:"available"`
+	Assigned  int64 `json:"assigned"`
+	Revealed  int64 `json:"revealed"`
+}
+
+// Import adds the codes to the reward's pool, skipping codes whose hash is
+// already present, switches the reward to code-backed inventory and syncs its
+// inventory with the number of available codes. It returns how many codes
+// were added.
+func (r *VoucherRepository) Import(rewardID uint, codes []models.VoucherCode) (int, *models.Reward, error) {
+	var reward models.Reward
+	imported := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&reward, rewardID).Error; err != nil {
+			return err
+		}
+		for i := range codes {
+			codes[i].RewardID = rewardID
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&codes[i])
+			if res.Error != nil {
+				return res.Error
+			}
+			imported += int(res.RowsAffected)
+		}
+
+		available, err := countAvailable(tx, rewardID)
+		if err != nil {
+			return err
+		}
+		reward.UsesCodes = true
+		reward.Inventory = int(available)
+		return tx.Model(&reward).Select("uses_codes", "inventory").Updates(&reward).Error
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return imported, &reward, nil
+}
+
+func (r *VoucherRepository) Stats(rewardID uint) (*VoucherStats, error) {
+	var stats VoucherStats
+	err := r.db.Model(&models.VoucherCode{}).
+		Select("count(*) as total, "+
+			"coalesce(sum(case when redemption_id is null then 1 else 0 end), 0) as available, "+
+			"coalesce(sum(case when redemption_id is not null then 1 else 0 end), 0) as assigned, "+
+			"coalesce(sum(case when revealed_at is not null then 1 else 0 end), 0) as revealed").
+		Where("reward_id = ?", rewardID).
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// FindByRedemption returns the code assigned to the redemption, or nil when
+// none is.
+func (r *VoucherRepository) FindByRedemption(redemptionID uint) (*models.VoucherCode, error) {
+	var codes []models.VoucherCode
+	if err := r.db.Where("redemption_id = ?", redemptionID).Limit(1).Find(&codes).Error; err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	return &codes[0], nil
+}
+
+// Reveal records the first time the owner looked at the code. Once seen the
+// code cannot be taken back, so a pending or approved redemption is moved to
+// fulfilled in the same transaction and can no longer be refunded.
+func (r *VoucherRepository) Reveal(code *models.VoucherCode, redemption *models.Redemption) error {
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if code.RevealedAt == nil {
+			res := tx.Model(&models.VoucherCode{}).
+				Where("id = ? AND redemption_id = ?", code.ID, redemption.ID).
+				Update("revealed_at", gorm.Expr("coalesce(revealed_at, ?)", now))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrRedemptionChanged
+			}
+		}
+
+		if redemption.Status != models.RedemptionPending && redemption.Status != models.RedemptionApproved {
+			return nil
+		}
+		res := tx.Model(&models.Redemption{}).
+			Where("id = ? AND status = ?", redemption.ID, redemption.Status).
+			Update("status", models.RedemptionFulfilled)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRedemptionChanged
+		}
+		return tx.Create(&models.RedemptionEvent{
+			RedemptionID: redemption.ID,
+			FromStatus:   redemption.Status,
+			ToStatus:     models.RedemptionFulfilled,
+			ActorID:      redemption.UserID,
+			ActorRole:    models.RoleSystem,
+			Note:         "voucher code revealed",
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if code.RevealedAt == nil {
+		code.RevealedAt = &now
+	}
+	if redemption.Status == models.RedemptionPending || redemption.Status == models.RedemptionApproved {
+		redemption.Status = models.RedemptionFulfilled
+	}
+	return nil
+}
+
+func countAvailable(tx *gorm.DB, rewardID uint) (int64, error) {
+	var count int64
+	err := tx.Model(&models.VoucherCode{}).Where("reward_id = ? AND redemption_id IS NULL", rewardID).Count(&count).Error
+	return count, err
+}
+
+// assignVoucherCode hands the oldest unassigned code of the reward to the
+// redemption. The update is conditional on the code still being free.
+func assignVoucherCode(tx *gorm.DB, rewardID, redemptionID uint) error {
+	var free []models.VoucherCode
+	if err := tx.Where("reward_id = ? AND redemption_id IS NULL", rewardID).Order("id asc").Limit(1).Find(&free).Error; err != nil {
+		return err
+	}
+	if len(free) == 0 {
+		return ErrRewardUnavailable
+	}
+	res := tx.Model(&models.VoucherCode{}).
+		Where("id = ? AND redemption_id IS NULL", free[0].ID).
+		Updates(map[string]interface{}{"redemption_id": redemptionID, "assigned_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRewardUnavailable
+	}
+	return nil
+}
+
+// releaseVoucherCode returns the redemption's code to the pool unless the
+// owner has already seen it. It reports whether a code was released.
+func releaseVoucherCode(tx *gorm.DB, redemptionID uint) (bool, error) {
+	res := tx.Model(&models.VoucherCode{}).
+		Where("redemption_id = ? AND revealed_at IS NULL", redemptionID).
+		Updates(map[string]interface{}{"redemption_id": nil, "assigned_at": nil})
+	return res.RowsAffected > 0, res.Error
+}
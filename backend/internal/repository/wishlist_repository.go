@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/example/solo_journey/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrWishlistItemNotFound = errors.New("reward is not on the wishlist")
+
+type WishlistRepository struct {
+	db *gorm.DB
+}
+
+func NewWishlistRepository(db *gorm.DB) *WishlistRepository {
+	return &WishlistRepository{db: db}
+}
+
+// Add puts the reward on the user's wishlist. Adding a reward twice is a
+// no-op.
+func (r *WishlistRepository) Add(userID, rewardID uint) error {
+	item := models.WishlistItem{UserID: userID, RewardID: rewardID}
+	return r.db.Omit("Reward").Clauses(clause.OnConflict{DoNothing: true}).Create(&item).Error
+}
+
+func (r *WishlistRepository) Remove(userID, rewardID uint) error {
+	res := r.db.Where("user_id = ? AND reward_id = ?", userID, rewardID).Delete(&models.WishlistItem{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrWishlistItemNotFound
+	}
+	return nil
+}
+
+// ListByUser returns the user's wishlist with the goal first.
+func (r *WishlistRepository) ListByUser(userID uint) ([]models.WishlistItem, error) {
+	var items []models.WishlistItem
+	err := r.db.Preload("Reward").Where("user_id = ?", userID).Order("is_goal desc, created_at asc").Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListByReward returns every wishlist entry for the reward.
+func (r *WishlistRepository) ListByReward(rewardID uint) ([]models.WishlistItem, error) {
+	var items []models.WishlistItem
+	if err := r.db.Preload("Reward").Where("reward_id = ?", rewardID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// FindGoal returns the user's active goal, or nil when there is none.
+func (r *WishlistRepository) FindGoal(userID uint) (*models.WishlistItem, error) {
+	var items []models.WishlistItem
+	if err := r.db.Preload("Reward").Where("user_id = ? AND is_goal = ?", userID, true).Limit(1).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return &items[0], nil
+}
+
+// SetGoal makes the reward the user's only goal, adding it to the wishlist
+// when needed.
+func (r *WishlistRepository) SetGoal(userID, rewardID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.WishlistItem{}).
+			Where("user_id = ? AND is_goal = ?", userID, true).
+			Updates(map[string]interface{}{"is_goal": false, "affordable_notified": false}).Error; err != nil {
+			return err
+		}
+		item := models.WishlistItem{UserID: userID, RewardID: rewardID}
+		if err := tx.Omit("Reward").Clauses(clause.OnConflict{DoNothing: true}).Create(&item).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WishlistItem{}).
+			Where("user_id = ? AND reward_id = ?", userID, rewardID).
+			Update("is_goal", true).Error
+	})
+}
+
+func (r *WishlistRepository) ClearGoal(userID uint) error {
+	return r.db.Model(&models.WishlistItem{}).
+		Where("user_id = ? AND is_goal = ?", userID, true).
+		Updates(map[string]interface{}{"is_goal": false, "affordable_notified": false}).Error
+}
+
+// UserIDs returns every user with at least one wishlist entry.
+func (r *WishlistRepository) UserIDs() ([]uint, error) {
+	var ids []uint
+	if err := r.db.Model(&models.WishlistItem{}).Distinct("user_id").Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Notify flips the item's notified flag and stores the notification in one
+// transaction. Nothing is stored when the flag was already set, so concurrent
+// checks notify at most once.
+func (r *WishlistRepository) Notify(item *models.WishlistItem, flag string, notification *models.Notification) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.WishlistItem{}).
+			Where("id = ? AND "+flag+" = ?", item.ID, false).
+			Update(flag, true)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Create(notification).Error
+	})
+}
+
+// ResetFlag clears a notified flag once its condition no longer holds.
+func (r *WishlistRepository) ResetFlag(item *models.WishlistItem, flag string) error {
+	return r.db.Model(&models.WishlistItem{}).Where("id = ?", item.ID).Update(flag, false).Error
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+type AdjustmentService struct {
+	users       *repository.UserRepository
+	leaderboard Leaderboard
+}
+
+type AdjustPointsInput struct {
+	UserID  uint   `json:"user_id"`
+	ActorID uint   `json:"actor_id"`
+	Delta   int64  `json:"delta"`
+	Reason  string `json:"reason"`
+	Ticket  string `json:"ticket"`
+}
+
+func NewAdjustmentService(users *repository.UserRepository, lb Leaderboard) *AdjustmentService {
+	return &AdjustmentService{users: users, leaderboard: lb}
+}
+
+// Adjust grants (positive delta) or deducts (negative delta) points on behalf
+// of an administrator and records who did it and why.
+func (s *AdjustmentService) Adjust(input AdjustPointsInput) (*models.PointsAdjustment, *models.User, error) {
+	if input.Delta == 0 {
+		return nil, nil, errors.New("delta must not be zero")
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		return nil, nil, errors.New("reason is required")
+	}
+	if input.ActorID == 0 {
+		return nil, nil, errors.New("actor is required")
+	}
+
+	adjustment := &models.PointsAdjustment{
+		UserID:  input.UserID,
+		ActorID: input.ActorID,
+		Delta:   input.Delta,
+		Reason:  reason,
+		Ticket:  strings.TrimSpace(input.Ticket),
+	}
+	user, err := s.users.AdjustPoints(adjustment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.leaderboard != nil {
+		if err := s.leaderboard.AddScore(user.ID, user.Points); err != nil {
+			return adjustment, user, err
+		}
+		if err := recordEarned(s.leaderboard, user.ID, adjustment.Delta, time.Now()); err != nil {
+			return adjustment, user, err
+		}
+	}
+	return adjustment, user, nil
+}
+
+func (s *AdjustmentService) List(filter repository.AdjustmentFilter) ([]models.PointsAdjustment, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	return s.users.ListAdjustments(filter)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestAdjustPointsWritesLedgerAndLeaderboard(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	lb := NewMemoryLeaderboard()
+	service := NewAdjustmentService(userRepo, lb)
+
+	admin := &models.User{Username: "support", Email: "support@example.com", Password: "secret", Role: models.RoleAdmin}
+	user := &models.User{Username: "frank", Email: "frank@example.com", Password: "secret", Points: 50}
+	for _, u := range []*models.User{admin, user} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	adjustment, updated, err := service.Adjust(AdjustPointsInput{UserID: user.ID, ActorID: admin.ID, Delta: 30, Reason: "lost trip", Ticket: "SUP-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Points != 80 {
+		t.Fatalf("expected 80 points, got %d", updated.Points)
+	}
+	if adjustment.HistoryID == 0 {
+		t.Fatalf("expected adjustment to reference the points history entry")
+	}
+
+	if _, _, err := service.Adjust(AdjustPointsInput{UserID: user.ID, ActorID: admin.ID, Delta: -100, Reason: "abuse"}); !errors.Is(err, repository.ErrInsufficientPoints) {
+		t.Fatalf("expected insufficient points error, got %v", err)
+	}
+	if _, _, err := service.Adjust(AdjustPointsInput{UserID: user.ID, ActorID: admin.ID, Delta: -10}); err == nil {
+		t.Fatalf("expected missing reason to be rejected")
+	}
+	if _, _, err := service.Adjust(AdjustPointsInput{UserID: user.ID, ActorID: admin.ID, Delta: -20, Reason: "duplicate post"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	history, err := userRepo.PointsHistory(user.ID, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 2 || history[0].Reason != "admin_adjustment" {
+		t.Fatalf("expected two admin_adjustment history entries, got %+v", history)
+	}
+
+	entries, err := lb.Top(1)
+	if err != nil {
+		t.Fatalf("leaderboard error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].UserID != user.ID || entries[0].Points != 60 {
+		t.Fatalf("expected leaderboard to reflect adjusted points, got %+v", entries)
+	}
+
+	byTicket, err := service.List(repository.AdjustmentFilter{Ticket: "SUP-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(byTicket) != 1 || byTicket[0].ActorID != admin.ID {
+		t.Fatalf("expected one adjustment for ticket, got %+v", byTicket)
+	}
+
+	byUser, err := service.List(repository.AdjustmentFilter{UserID: user.ID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(byUser) != 2 {
+		t.Fatalf("expected two adjustments for user, got %d", len(byUser))
+	}
+}
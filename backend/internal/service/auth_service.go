@@ -1,7 +1,13 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/example/solo_journey/internal/config"
@@ -9,63 +15,406 @@ import (
 	"github.com/example/solo_journey/internal/repository"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, please log in again")
+	ErrTokenRevoked        = errors.New("token has been revoked")
 )
 
 type AuthService struct {
-	users  *repository.UserRepository
-	jwtKey []byte
-	expiry time.Duration
+	users         *repository.UserRepository
+	tokens        *repository.TokenRepository
+	jwtKey        []byte
+	accessExpiry  time.Duration
+	refreshExpiry time.Duration
+
+	// revoked is the revocation list: token families whose access tokens
+	// are rejected, with the time after which the entry can be dropped.
+	// checked holds when a family was last found not to be revoked in the
+	// database, and seen when each session's last activity was written.
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+	checked map[string]time.Time
+	seen    map[string]time.Time
 }
 
-func NewAuthService(repo *repository.UserRepository, cfg config.Config) *AuthService {
-	return &AuthService{users: repo, jwtKey: []byte(cfg.JWTSecret), expiry: cfg.TokenExpiry}
+// sessionTouchInterval limits how often the last activity of a session is
+// written, since every authenticated request reports it.
+const sessionTouchInterval = 5 * time.Minute
+
+// revocationCheckInterval is how long a family found not revoked is trusted
+// before the database is asked again. Revocations made by another instance
+// take effect here within this interval.
+const revocationCheckInterval = 30 * time.Second
+
+// maxSessionField caps client supplied session details.
+const maxSessionField = 255
+
+func NewAuthService(repo *repository.UserRepository, tokens *repository.TokenRepository, cfg config.Config) *AuthService {
+	s := &AuthService{
+		users:         repo,
+		tokens:        tokens,
+		jwtKey:        []byte(cfg.JWTSecret),
+		accessExpiry:  cfg.AccessTokenExpiry,
+		refreshExpiry: cfg.TokenExpiry,
+		revoked:       make(map[string]time.Time),
+		checked:       make(map[string]time.Time),
+		seen:          make(map[string]time.Time),
+	}
+	if s.accessExpiry <= 0 {
+		s.accessExpiry = 15 * time.Minute
+	}
+	if s.refreshExpiry <= 0 {
+		s.refreshExpiry = 7 * 24 * time.Hour
+	}
+	return s
 }
 
+// Claims are the claims of an access token. FamilyID names the refresh token
+// family the token was issued for; tokens issued before refresh tokens
+// existed have none and stay valid until they expire.
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID   uint   `json:"user_id"`
+	FamilyID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func (s *AuthService) Register(username, email, password string) (*models.User, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// TokenPair is a short-lived access token together with the refresh token
+// that obtains the next pair.
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type RegisterInput struct {
+	Username string
+	Email    string
+	Password string
+	IP       string
+	DeviceID string
+}
+
+func (s *AuthService) Register(input RegisterInput) (*models.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := newInviteCode(s.users)
 	if err != nil {
 		return nil, err
 	}
 
-	user := &models.User{Username: username, Email: email, Password: string(hash)}
+	user := &models.User{
+		Username:       input.Username,
+		Email:          input.Email,
+		Password:       string(hash),
+		Role:           models.RoleUser,
+		InviteCode:     code,
+		RegistrationIP: input.IP,
+		DeviceID:       input.DeviceID,
+	}
 	if err := s.users.Create(user); err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (s *AuthService) Login(email, password string) (string, *models.User, error) {
-	user, err := s.users.FindByEmail(email)
+type LoginInput struct {
+	Email      string
+	Password   string
+	DeviceName string
+	IP         string
+	UserAgent  string
+}
+
+// Login checks the credentials and starts a new session with its own token
+// family.
+func (s *AuthService) Login(input LoginInput) (*TokenPair, *models.User, error) {
+	user, err := s.users.FindByEmail(input.Email)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", nil, errors.New("invalid credentials")
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		return nil, nil, errors.New("invalid credentials")
 	}
 
-	expires := time.Now().Add(s.expiry)
+	family, err := randomToken(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	refresh, record, err := s.newRefreshToken(user.ID, family, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	session := &models.Session{
+		UserID:     user.ID,
+		FamilyID:   family,
+		DeviceName: truncate(strings.TrimSpace(input.DeviceName), maxSessionField),
+		IP:         input.IP,
+		UserAgent:  truncate(input.UserAgent, maxSessionField),
+		LastSeenAt: now,
+		ExpiresAt:  record.ExpiresAt,
+	}
+	if err := s.tokens.CreateSession(session, record); err != nil {
+		return nil, nil, err
+	}
+	pair, err := s.tokenPair(user.ID, family, refresh, record.ExpiresAt, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+// Refresh exchanges a refresh token for a new pair of the same family. Every
+// refresh token can be used once: presenting a used one means it was copied,
+// so the whole family is revoked and its holder has to log in again.
+func (s *AuthService) Refresh(refreshToken string) (*TokenPair, error) {
+	now := time.Now()
+	current, err := s.findRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if current.RevokedAt != nil || !now.Before(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if current.UsedAt != nil {
+		return nil, s.revokeReused(current)
+	}
+
+	refresh, next, err := s.newRefreshToken(current.UserID, current.FamilyID, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokens.Rotate(current, next, now); err != nil {
+		if !errors.Is(err, repository.ErrRefreshTokenUsed) {
+			return nil, err
+		}
+		// The token changed since it was read. If it was revoked, a logout
+		// won the race and this is not a reuse.
+		latest, err := s.tokens.FindByHash(current.TokenHash)
+		if err != nil {
+			return nil, err
+		}
+		if latest.RevokedAt != nil {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, s.revokeReused(latest)
+	}
+	return s.tokenPair(current.UserID, current.FamilyID, refresh, next.ExpiresAt, now)
+}
+
+// Logout revokes the family of refreshToken, signing out the device it was
+// issued to. Logging out twice is not an error.
+func (s *AuthService) Logout(refreshToken string) error {
+	current, err := s.findRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	return s.RevokeFamily(current.UserID, current.FamilyID, models.RevokeLogout)
+}
+
+// RevokeFamily revokes the refresh tokens of a family and puts it on the
+// revocation list until its last access token has expired.
+func (s *AuthService) RevokeFamily(userID uint, familyID, reason string) error {
+	now := time.Now()
+	revocation := &models.RevokedTokenFamily{
+		CreatedAt: now,
+		FamilyID:  familyID,
+		UserID:    userID,
+		Reason:    reason,
+		ExpiresAt: now.Add(s.accessExpiry),
+	}
+	if err := s.tokens.RevokeFamily(revocation); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if _, ok := s.revoked[familyID]; !ok {
+		s.revoked[familyID] = revocation.ExpiresAt
+	}
+	delete(s.checked, familyID)
+	s.mu.Unlock()
+	return nil
+}
+
+// Sessions lists the user's active sessions. The one of currentFamily, the
+// family of the caller's access token, is marked as current.
+func (s *AuthService) Sessions(userID uint, currentFamily string) ([]models.Session, error) {
+	sessions, err := s.tokens.ActiveSessions(userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = currentFamily != "" && sessions[i].FamilyID == currentFamily
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs out one of the user's sessions. Its access tokens are
+// rejected from then on and its refresh token can no longer be used.
+func (s *AuthService) RevokeSession(userID, sessionID uint) error {
+	session, err := s.tokens.FindActiveSession(userID, sessionID, time.Now())
+	if err != nil {
+		return err
+	}
+	return s.RevokeFamily(userID, session.FamilyID, models.RevokeSession)
+}
+
+// Touch records activity of the session an access token belongs to. Writes
+// are throttled to one per sessionTouchInterval and session.
+func (s *AuthService) Touch(claims *Claims, ip string) error {
+	if claims.FamilyID == "" {
+		return nil
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if last, ok := s.seen[claims.FamilyID]; ok && now.Sub(last) < sessionTouchInterval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.seen[claims.FamilyID] = now
+	s.mu.Unlock()
+	return s.tokens.TouchSession(claims.FamilyID, ip, now)
+}
+
+func (s *AuthService) revokeReused(token *models.RefreshToken) error {
+	if err := s.RevokeFamily(token.UserID, token.FamilyID, models.RevokeReuse); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// LoadRevocations fills the revocation list from the database, so access
+// tokens revoked before a restart stay rejected.
+func (s *AuthService) LoadRevocations() error {
+	revoked, err := s.tokens.RevokedFamilies(time.Now())
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range revoked {
+		s.revoked[r.FamilyID] = r.ExpiresAt
+	}
+	return nil
+}
+
+// BackfillSessions creates the sessions of devices that signed in before
+// sessions were recorded, so they can be listed and signed out.
+func (s *AuthService) BackfillSessions() (int64, error) {
+	return s.tokens.CreateMissingSessions(time.Now())
+}
+
+// PurgeExpiredTokens deletes expired refresh tokens and revocation list
+// entries and returns how many rows were removed.
+func (s *AuthService) PurgeExpiredTokens() (int64, error) {
+	now := time.Now()
+	s.mu.Lock()
+	for family, until := range s.revoked {
+		if !now.Before(until) {
+			delete(s.revoked, family)
+		}
+	}
+	for family, at := range s.checked {
+		if now.Sub(at) >= revocationCheckInterval {
+			delete(s.checked, family)
+		}
+	}
+	for family, last := range s.seen {
+		if now.Sub(last) >= sessionTouchInterval {
+			delete(s.seen, family)
+		}
+	}
+	s.mu.Unlock()
+	return s.tokens.PurgeExpired(now)
+}
+
+// isRevoked reports whether a family is on the revocation list. Families not
+// in the local list are looked up in the database at most once per
+// revocationCheckInterval, so revocations made by other instances are seen.
+func (s *AuthService) isRevoked(familyID string) (bool, error) {
+	now := time.Now()
+	s.mu.RLock()
+	_, revoked := s.revoked[familyID]
+	at, checked := s.checked[familyID]
+	s.mu.RUnlock()
+	if revoked {
+		return true, nil
+	}
+	if checked && now.Sub(at) < revocationCheckInterval {
+		return false, nil
+	}
+
+	revocation, err := s.tokens.FindRevocation(familyID, now)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if revocation != nil {
+		s.revoked[familyID] = revocation.ExpiresAt
+		delete(s.checked, familyID)
+		return true, nil
+	}
+	s.checked[familyID] = now
+	return false, nil
+}
+
+func (s *AuthService) findRefreshToken(refreshToken string) (*models.RefreshToken, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	token, err := s.tokens.FindByHash(hashRefreshToken(refreshToken))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	return token, err
+}
+
+// newRefreshToken returns a random refresh token and the record storing its
+// hash.
+func (s *AuthService) newRefreshToken(userID uint, familyID string, now time.Time) (string, *models.RefreshToken, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	record := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: now.Add(s.refreshExpiry),
+	}
+	return token, record, nil
+}
+
+func (s *AuthService) tokenPair(userID uint, familyID, refresh string, refreshExpires, now time.Time) (*TokenPair, error) {
+	expires := now.Add(s.accessExpiry)
 	claims := &Claims{
-		UserID: user.ID,
+		UserID:   userID,
+		FamilyID: familyID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expires),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signed, err := token.SignedString(s.jwtKey)
 	if err != nil {
-		return "", nil, err
+		return nil, err
 	}
-	return signed, user, nil
+	return &TokenPair{AccessToken: signed, ExpiresAt: expires, RefreshToken: refresh, RefreshExpiresAt: refreshExpires}, nil
 }
 
+// ParseToken validates an access token and rejects tokens of revoked
+// families.
 func (s *AuthService) ParseToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return s.jwtKey, nil
@@ -78,6 +427,38 @@ func (s *AuthService) ParseToken(tokenString string) (*Claims, error) {
 	if !ok || !token.Valid {
 		return nil, errors.New("invalid token")
 	}
+	if claims.FamilyID != "" {
+		revoked, err := s.isRevoked(claims.FamilyID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
 
 	return claims, nil
 }
+
+// randomToken returns n random bytes encoded for use in URLs and headers.
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashRefreshToken returns the form a refresh token is stored in.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
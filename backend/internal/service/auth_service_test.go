@@ -0,0 +1,234 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestRefreshTokenRotationAndReuse(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	auth := NewAuthService(userRepo, tokenRepo, config.Config{JWTSecret: "test"})
+
+	if _, err := auth.Register(RegisterInput{Username: "rotor", Email: "rotor@example.com", Password: "password"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	first, user, err := auth.Login(LoginInput{Email: "rotor@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	claims, err := auth.ParseToken(first.AccessToken)
+	if err != nil || claims.UserID != user.ID || claims.FamilyID == "" {
+		t.Fatalf("unexpected access token claims: %+v, %v", claims, err)
+	}
+
+	second, err := auth.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected the refresh token to rotate")
+	}
+	secondClaims, err := auth.ParseToken(second.AccessToken)
+	if err != nil || secondClaims.FamilyID != claims.FamilyID {
+		t.Fatalf("expected the refreshed token in the same family, got %+v, %v", secondClaims, err)
+	}
+
+	// Presenting the first token again revokes the whole family.
+	if _, err := auth.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := auth.Refresh(second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected the successor to be revoked, got %v", err)
+	}
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		if _, err := auth.ParseToken(token); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("expected access tokens of the family to be revoked, got %v", err)
+		}
+	}
+
+	// A new login is a new family and is not affected.
+	third, _, err := auth.Login(LoginInput{Email: "rotor@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if _, err := auth.ParseToken(third.AccessToken); err != nil {
+		t.Fatalf("expected a new login to work, got %v", err)
+	}
+	if _, err := auth.Refresh("not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestLogoutRevokesAccessTokens(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	auth := NewAuthService(userRepo, tokenRepo, config.Config{JWTSecret: "test"})
+
+	if _, err := auth.Register(RegisterInput{Username: "leaver", Email: "leaver@example.com", Password: "password"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	phone, _, err := auth.Login(LoginInput{Email: "leaver@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	laptop, _, err := auth.Login(LoginInput{Email: "leaver@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	// Another instance sharing the database has seen the phone's token.
+	other := NewAuthService(userRepo, tokenRepo, config.Config{JWTSecret: "test"})
+	phoneClaims, err := other.ParseToken(phone.AccessToken)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if err := auth.Logout(phone.RefreshToken); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if err := auth.Logout(phone.RefreshToken); err != nil {
+		t.Fatalf("expected a second logout to succeed, got %v", err)
+	}
+	if _, err := auth.ParseToken(phone.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected the access token to be revoked, got %v", err)
+	}
+	if _, err := auth.Refresh(phone.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected the refresh token to be revoked, got %v", err)
+	}
+	if _, err := auth.ParseToken(laptop.AccessToken); err != nil {
+		t.Fatalf("expected the other device to stay signed in, got %v", err)
+	}
+
+	// The other instance picks the revocation up once its check is stale.
+	other.mu.Lock()
+	other.checked[phoneClaims.FamilyID] = time.Now().Add(-revocationCheckInterval)
+	other.mu.Unlock()
+	if _, err := other.ParseToken(phone.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected the revocation to reach the other instance, got %v", err)
+	}
+
+	// The revocation list survives a restart.
+	restarted := NewAuthService(userRepo, tokenRepo, config.Config{JWTSecret: "test"})
+	if err := restarted.LoadRevocations(); err != nil {
+		t.Fatalf("load revocations failed: %v", err)
+	}
+	if _, err := restarted.ParseToken(phone.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected the access token to stay revoked after a restart, got %v", err)
+	}
+}
+
+func TestSessionsListAndRevoke(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	auth := NewAuthService(userRepo, repository.NewTokenRepository(db), config.Config{JWTSecret: "test"})
+
+	if _, err := auth.Register(RegisterInput{Username: "nomad", Email: "nomad@example.com", Password: "password"}); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	phone, user, err := auth.Login(LoginInput{Email: "nomad@example.com", Password: "password", DeviceName: "Pixel 8", IP: "10.0.0.1", UserAgent: "SoloJourney/1.0 (Android)"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	laptop, _, err := auth.Login(LoginInput{Email: "nomad@example.com", Password: "password", DeviceName: "MacBook", IP: "10.0.0.2", UserAgent: "Mozilla/5.0"})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	phoneClaims, err := auth.ParseToken(phone.AccessToken)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	sessions, err := auth.Sessions(user.ID, phoneClaims.FamilyID)
+	if err != nil {
+		t.Fatalf("sessions failed: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+	var laptopSession uint
+	for _, s := range sessions {
+		switch s.DeviceName {
+		case "Pixel 8":
+			if !s.Current || s.IP != "10.0.0.1" || s.UserAgent != "SoloJourney/1.0 (Android)" {
+				t.Fatalf("unexpected phone session: %+v", s)
+			}
+		case "MacBook":
+			if s.Current {
+				t.Fatalf("expected only the phone session to be current: %+v", s)
+			}
+			laptopSession = s.ID
+		default:
+			t.Fatalf("unexpected session: %+v", s)
+		}
+	}
+
+	// Another user cannot sign the laptop out.
+	if err := auth.RevokeSession(user.ID+1000, laptopSession); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+	if err := auth.RevokeSession(user.ID, laptopSession); err != nil {
+		t.Fatalf("revoke session failed: %v", err)
+	}
+	if _, err := auth.ParseToken(laptop.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("expected the laptop's access token to be revoked, got %v", err)
+	}
+	if _, err := auth.Refresh(laptop.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected the laptop's refresh token to be revoked, got %v", err)
+	}
+	if err := auth.RevokeSession(user.ID, laptopSession); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Fatalf("expected a revoked session to be gone, got %v", err)
+	}
+
+	// Refreshing keeps the phone's session.
+	if _, err := auth.Refresh(phone.RefreshToken); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	sessions, err = auth.Sessions(user.ID, phoneClaims.FamilyID)
+	if err != nil || len(sessions) != 1 || sessions[0].DeviceName != "Pixel 8" {
+		t.Fatalf("expected only the phone session to remain, got %+v, %v", sessions, err)
+	}
+}
+
+func TestBackfillSessionsForEarlierLogins(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tokenRepo := repository.NewTokenRepository(db)
+	auth := NewAuthService(userRepo, tokenRepo, config.Config{JWTSecret: "test"})
+
+	user, err := auth.Register(RegisterInput{Username: "early-bird", Email: "early-bird@example.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	// A login from before sessions were recorded left only a refresh token.
+	now := time.Now()
+	refresh, token, err := auth.newRefreshToken(user.ID, "legacy-family", now)
+	if err != nil {
+		t.Fatalf("failed to issue refresh token: %v", err)
+	}
+	if err := db.Create(token).Error; err != nil {
+		t.Fatalf("failed to store refresh token: %v", err)
+	}
+
+	if n, err := auth.BackfillSessions(); err != nil || n != 1 {
+		t.Fatalf("expected one session to be backfilled, got %d, %v", n, err)
+	}
+	if n, err := auth.BackfillSessions(); err != nil || n != 0 {
+		t.Fatalf("expected the backfill to be done once, got %d, %v", n, err)
+	}
+	sessions, err := auth.Sessions(user.ID, "legacy-family")
+	if err != nil || len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("expected the earlier login to be listed, got %+v, %v", sessions, err)
+	}
+	if err := auth.RevokeSession(user.ID, sessions[0].ID); err != nil {
+		t.Fatalf("revoke session failed: %v", err)
+	}
+	if _, err := auth.Refresh(refresh); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expected the earlier login to be signed out, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+// Badge metrics understood by the evaluator. Definitions referencing any other
+// metric are ignored.
+const (
+	MetricTrips         = "trips"
+	MetricVerifiedTrips = "verified_trips"
+	MetricCountries     = "countries"
+	MetricStreakDays    = "streak_days"
+	MetricRedemptions   = "redemptions"
+)
+
+//go:embed badge_definitions.json
+var defaultBadgeDefinitions []byte
+
+type BadgeService struct {
+	badges  *repository.BadgeRepository
+	trips   *repository.TripRepository
+	rewards *repository.RewardRepository
+	streaks *StreakService
+}
+
+func NewBadgeService(badges *repository.BadgeRepository, trips *repository.TripRepository, rewards *repository.RewardRepository, streaks *StreakService) *BadgeService {
+	return &BadgeService{badges: badges, trips: trips, rewards: rewards, streaks: streaks}
+}
+
+// SeedDefinitions stores the bundled badge definitions that are not yet
+// present in the database.
+func (s *BadgeService) SeedDefinitions() error {
+	var definitions []models.Badge
+	if err := json.Unmarshal(defaultBadgeDefinitions, &definitions); err != nil {
+		return fmt.Errorf("invalid badge definitions: %w", err)
+	}
+	for i := range definitions {
+		if err := s.badges.EnsureDefinition(&definitions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BadgeService) UserBadges(userID uint) ([]models.UserBadge, error) {
+	return s.badges.ListByUser(userID)
+}
+
+// Evaluate awards every badge whose threshold the user has reached and returns
+// the badges that were newly earned.
+func (s *BadgeService) Evaluate(userID uint) ([]models.UserBadge, error) {
+	definitions, err := s.badges.List()
+	if err != nil {
+		return nil, err
+	}
+
+	owned, err := s.badges.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	earned := make(map[uint]bool, len(owned))
+	for _, b := range owned {
+		earned[b.BadgeID] = true
+	}
+
+	metrics := make(map[string]int64)
+	var awarded []models.UserBadge
+	for _, badge := range definitions {
+		if earned[badge.ID] {
+			continue
+		}
+
+		value, ok := metrics[badge.Metric]
+		if !ok {
+			value, err = s.metric(userID, badge.Metric)
+			if err != nil {
+				return nil, err
+			}
+			metrics[badge.Metric] = value
+		}
+		if value < 0 || value < badge.Threshold {
+			continue
+		}
+
+		award, err := s.badges.Award(userID, badge.ID)
+		if err != nil {
+			return nil, err
+		}
+		award.Badge = badge
+		awarded = append(awarded, *award)
+	}
+	return awarded, nil
+}
+
+func (s *BadgeService) TripCreated(user *models.User, _ *models.TripPost) error {
+	_, err := s.Evaluate(user.ID)
+	return err
+}
+
+func (s *BadgeService) RedemptionCreated(user *models.User, _ *models.Redemption) error {
+	_, err := s.Evaluate(user.ID)
+	return err
+}
+
+// metric returns the current value of the named metric, or -1 when the metric
+// is unknown.
+func (s *BadgeService) metric(userID uint, name string) (int64, error) {
+	switch name {
+	case MetricTrips:
+		return s.trips.CountByUser(userID)
+	case MetricVerifiedTrips:
+		return s.trips.CountVerifiedByUser(userID)
+	case MetricCountries:
+		return s.trips.CountCountriesByUser(userID)
+	case MetricStreakDays:
+		summary, err := s.streaks.Summary(userID)
+		if err != nil {
+			return 0, err
+		}
+		return int64(summary.Longest), nil
+	case MetricRedemptions:
+		return s.rewards.CountRedemptionsByUser(userID)
+	default:
+		return -1, nil
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func verifiedTripInput(userID uint, country string, visitedAt time.Time) CreateTripInput {
+	meta, _ := json.Marshal(map[string]interface{}{
+		"captured_at": visitedAt,
+		"latitude":    35.0,
+		"longitude":   135.7,
+		"device":      "sony-a7",
+		"signature":   "trusted-source",
+	})
+	return CreateTripInput{
+		UserID:      userID,
+		Title:       "Trip",
+		Description: "Verified trip",
+		Location:    "Somewhere, " + country,
+		VisitedAt:   visitedAt,
+		Media: []models.Media{{
+			Type:        "image",
+			URL:         "https://example.com/image.jpg",
+			MetadataRaw: string(meta),
+		}},
+	}
+}
+
+func TestBadgesAwardedOnTripAndRedemption(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tripRepo := repository.NewTripRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	streaks := NewStreakService(tripRepo, userRepo, nil)
+	badges := NewBadgeService(repository.NewBadgeRepository(db), tripRepo, rewardRepo, streaks)
+	if err := badges.SeedDefinitions(); err != nil {
+		t.Fatalf("failed to seed badges: %v", err)
+	}
+
+	trips := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard(), config.Config{})
+	trips.AddListener(badges)
+	rewards := NewRewardService(rewardRepo, userRepo)
+	rewards.AddListener(badges)
+
+	user := &models.User{Username: "badger", Email: "badger@example.com", Password: "secret"}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if _, err := trips.CreateTrip(verifiedTripInput(user.ID, "Japan", time.Now())); err != nil {
+		t.Fatalf("failed to create trip: %v", err)
+	}
+
+	owned, err := badges.UserBadges(user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(owned) != 1 || owned[0].Badge.Code != "first_trip" {
+		t.Fatalf("expected first_trip badge, got %+v", owned)
+	}
+
+	reward := &models.Reward{Name: "Sticker", PointsCost: 10, Inventory: 1}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+	if _, _, err := rewards.Redeem(user.ID, reward.ID); err != nil {
+		t.Fatalf("failed to redeem: %v", err)
+	}
+
+	owned, err = badges.UserBadges(user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(owned) != 2 || owned[1].Badge.Code != "first_redemption" {
+		t.Fatalf("expected first_redemption badge, got %+v", owned)
+	}
+
+	again, err := badges.Evaluate(user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(again) != 0 {
+		t.Fatalf("expected badges to be awarded only once, got %+v", again)
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+const maxRewardImageSize = 5 << 20
+
+var rewardImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+var (
+	ErrRewardArchived = errors.New("reward is archived")
+	ErrCodePoolStock  = errors.New("inventory of code pool rewards follows their voucher codes")
+)
+
+// CatalogService implements the administrator side of the reward catalog.
+type CatalogService struct {
+	rewards   *repository.RewardRepository
+	uploadDir string
+}
+
+type RewardInput struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	PointsCost  int64      `json:"points_cost"`
+	Inventory   int        `json:"inventory"`
+	Publish     bool       `json:"publish"`
+	MinLevel    int        `json:"min_level"`
+	MaxPerUser  int        `json:"max_per_user"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	Regions     string     `json:"regions"`
+	Category    string     `json:"category"`
+	Tags        string     `json:"tags"`
+	// WebhookSecret is write-only; leaving it empty on update keeps the
+	// current secret.
+	WebhookURL    string `json:"webhook_url"`
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+func NewCatalogService(rewards *repository.RewardRepository, cfg config.Config) *CatalogService {
+	return &CatalogService{rewards: rewards, uploadDir: cfg.UploadDir}
+}
+
+// UploadDir is the directory uploaded files are written to and served from.
+func (s *CatalogService) UploadDir() string {
+	return s.uploadDir
+}
+
+func (s *CatalogService) List(includeArchived bool) ([]models.Reward, error) {
+	return s.rewards.ListAll(includeArchived)
+}
+
+func (s *CatalogService) Get(id uint) (*models.Reward, error) {
+	return s.rewards.FindByID(id)
+}
+
+// Create adds a reward to the catalog. Rewards stay hidden until published
+// unless input.Publish is set.
+func (s *CatalogService) Create(actorID uint, input RewardInput) (*models.Reward, error) {
+	if err := validateRewardInput(input); err != nil {
+		return nil, err
+	}
+	if input.Inventory < 0 {
+		return nil, errors.New("inventory must not be negative")
+	}
+
+	reward := &models.Reward{
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		PointsCost:  input.PointsCost,
+		Inventory:   input.Inventory,
+		Hidden:      !input.Publish,
+		MinLevel:    input.MinLevel,
+		MaxPerUser:  input.MaxPerUser,
+		StartsAt:    input.StartsAt,
+		EndsAt:      input.EndsAt,
+		Regions:     normalizeRegions(input.Regions),
+		Category:    normalizeCategory(input.Category),
+		Tags:        normalizeTags(input.Tags),
+
+		WebhookURL:    strings.TrimSpace(input.WebhookURL),
+		WebhookSecret: input.WebhookSecret,
+	}
+	if err := s.rewards.CreateWithStock(reward, actorID); err != nil {
+		return nil, err
+	}
+	return reward, nil
+}
+
+// Update changes the descriptive fields and price of a reward. Inventory is
+// only changed through Restock so every change is audited.
+func (s *CatalogService) Update(id uint, input RewardInput) (*models.Reward, error) {
+	if err := validateRewardInput(input); err != nil {
+		return nil, err
+	}
+	columns := map[string]interface{}{
+		"name":         strings.TrimSpace(input.Name),
+		"description":  strings.TrimSpace(input.Description),
+		"points_cost":  input.PointsCost,
+		"min_level":    input.MinLevel,
+		"max_per_user": input.MaxPerUser,
+		"starts_at":    input.StartsAt,
+		"ends_at":      input.EndsAt,
+		"regions":      normalizeRegions(input.Regions),
+		"category":     normalizeCategory(input.Category),
+		"tags":         normalizeTags(input.Tags),
+		"webhook_url":  strings.TrimSpace(input.WebhookURL),
+	}
+	if input.WebhookSecret != "" {
+		columns["webhook_secret"] = input.WebhookSecret
+	}
+	return s.rewards.UpdateColumns(id, columns)
+}
+
+func (s *CatalogService) SetPublished(id uint, published bool) (*models.Reward, error) {
+	reward, err := s.rewards.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if published && reward.ArchivedAt != nil {
+		return nil, ErrRewardArchived
+	}
+	return s.rewards.UpdateColumns(id, map[string]interface{}{"hidden": !published})
+}
+
+// Archive retires a reward from the catalog. The row is kept so existing
+// redemptions still resolve their reward.
+func (s *CatalogService) Archive(id uint) (*models.Reward, error) {
+	return s.rewards.UpdateColumns(id, map[string]interface{}{"archived_at": time.Now()})
+}
+
+// Restock changes the inventory by quantity units and records who did it and
+// why.
+func (s *CatalogService) Restock(actorID, id uint, quantity int, reason string) (*models.Reward, *models.RewardStockEvent, error) {
+	if quantity == 0 {
+		return nil, nil, errors.New("quantity must not be zero")
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, nil, errors.New("reason is required")
+	}
+	reward, err := s.rewards.FindByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reward.UsesCodes {
+		return nil, nil, ErrCodePoolStock
+	}
+	return s.rewards.Restock(id, actorID, quantity, reason)
+}
+
+func (s *CatalogService) StockHistory(id uint) ([]models.RewardStockEvent, error) {
+	return s.rewards.ListStockEvents(id)
+}
+
+// SaveImage stores an uploaded reward image below the upload directory and
+// points the reward at it. Only JPEG, PNG, WebP and GIF images up to 5 MiB
+// are accepted; the type is sniffed from the content, not the file name.
+func (s *CatalogService) SaveImage(id uint, src io.Reader) (*models.Reward, error) {
+	if _, err := s.rewards.FindByID(id); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(src, maxRewardImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRewardImageSize {
+		return nil, errors.New("image must not exceed 5 MiB")
+	}
+	ext, ok := rewardImageTypes[http.DetectContentType(data)]
+	if !ok {
+		return nil, errors.New("image must be a JPEG, PNG, WebP or GIF file")
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%d-%s%s", id, hex.EncodeToString(suffix), ext)
+	dir := filepath.Join(s.uploadDir, "rewards")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		return nil, err
+	}
+
+	return s.rewards.UpdateColumns(id, map[string]interface{}{"image_url": "/uploads/rewards/" + name})
+}
+
+func normalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// normalizeTags lower-cases and de-duplicates a comma separated tag list.
+func normalizeTags(tags string) string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range strings.Split(tags, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return strings.Join(out, ",")
+}
+
+func validateRewardInput(input RewardInput) error {
+	if strings.TrimSpace(input.Name) == "" {
+		return errors.New("name is required")
+	}
+	if input.PointsCost <= 0 {
+		return errors.New("points_cost must be positive")
+	}
+	if input.MinLevel < 0 || input.MaxPerUser < 0 {
+		return errors.New("min_level and max_per_user must not be negative")
+	}
+	if input.StartsAt != nil && input.EndsAt != nil && !input.EndsAt.After(*input.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if u := strings.TrimSpace(input.WebhookURL); u != "" {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return errors.New("webhook_url must be an http or https URL")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func containsReward(rewards []models.Reward, id uint) bool {
+	for _, r := range rewards {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCatalogLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	catalog := NewCatalogService(rewardRepo, config.Config{UploadDir: t.TempDir()})
+	rewards := NewRewardService(rewardRepo, userRepo)
+
+	user := &models.User{Username: "kate", Email: "kate@example.com", Password: "secret", Points: 1000}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if _, err := catalog.Create(1, RewardInput{Name: " ", PointsCost: 10}); err == nil {
+		t.Fatalf("expected missing name to be rejected")
+	}
+	reward, err := catalog.Create(1, RewardInput{Name: "Tote Bag", PointsCost: 200, Inventory: 1})
+	if err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+
+	public, _ := rewards.ListRewards()
+	if containsReward(public, reward.ID) {
+		t.Fatalf("expected unpublished reward to be hidden")
+	}
+	if _, _, err := rewards.Redeem(user.ID, reward.ID); !errors.Is(err, repository.ErrRewardUnavailable) {
+		t.Fatalf("expected hidden reward to be unavailable, got %v", err)
+	}
+
+	if _, err := catalog.SetPublished(reward.ID, true); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	public, _ = rewards.ListRewards()
+	if !containsReward(public, reward.ID) {
+		t.Fatalf("expected published reward to be listed")
+	}
+
+	restocked, _, err := catalog.Restock(1, reward.ID, 4, "spring shipment")
+	if err != nil {
+		t.Fatalf("failed to restock: %v", err)
+	}
+	if restocked.Inventory != 5 {
+		t.Fatalf("expected inventory 5, got %d", restocked.Inventory)
+	}
+	if _, _, err := catalog.Restock(1, reward.ID, -10, "shrinkage"); !errors.Is(err, repository.ErrInsufficientStock) {
+		t.Fatalf("expected negative inventory to be rejected, got %v", err)
+	}
+	events, err := catalog.StockHistory(reward.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 2 || events[0].Reason != "spring shipment" || events[0].InventoryAfter != 5 {
+		t.Fatalf("unexpected stock history %+v", events)
+	}
+
+	redemption, _, err := rewards.Redeem(user.ID, reward.ID)
+	if err != nil {
+		t.Fatalf("failed to redeem: %v", err)
+	}
+
+	if _, err := catalog.Update(reward.ID, RewardInput{Name: "Canvas Tote", PointsCost: 250}); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if _, err := catalog.Archive(reward.ID); err != nil {
+		t.Fatalf("failed to archive: %v", err)
+	}
+	public, _ = rewards.ListRewards()
+	if containsReward(public, reward.ID) {
+		t.Fatalf("expected archived reward to be hidden")
+	}
+	if _, err := catalog.SetPublished(reward.ID, true); !errors.Is(err, ErrRewardArchived) {
+		t.Fatalf("expected archived reward not to be publishable, got %v", err)
+	}
+
+	history, err := rewards.ListRedemptions("", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, h := range history {
+		if h.ID == redemption.ID && (h.Reward.Name != "Canvas Tote" || h.Reward.ArchivedAt == nil || h.Reward.Inventory != 4) {
+			t.Fatalf("expected redemption to keep its archived reward, got %+v", h.Reward)
+		}
+	}
+}
+
+func TestCatalogSaveImage(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	catalog := NewCatalogService(repository.NewRewardRepository(db), config.Config{UploadDir: dir})
+
+	reward, err := catalog.Create(1, RewardInput{Name: "Postcard", PointsCost: 10, Inventory: 3, Publish: true})
+	if err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+
+	if _, err := catalog.SaveImage(reward.ID, strings.NewReader("not an image")); err == nil {
+		t.Fatalf("expected non-image upload to be rejected")
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	updated, err := catalog.SaveImage(reward.ID, &buf)
+	if err != nil {
+		t.Fatalf("failed to save image: %v", err)
+	}
+	if !strings.HasPrefix(updated.ImageURL, "/uploads/rewards/") || !strings.HasSuffix(updated.ImageURL, ".png") {
+		t.Fatalf("unexpected image url %q", updated.ImageURL)
+	}
+	if _, err := os.Stat(filepath.Join(dir, strings.TrimPrefix(updated.ImageURL, "/uploads/"))); err != nil {
+		t.Fatalf("expected image to be written: %v", err)
+	}
+}
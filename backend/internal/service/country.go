@@ -0,0 +1,292 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnknownCountry = errors.New("region must be an ISO 3166-1 country code or name")
+
+// countries lists the ISO 3166-1 alpha-2 codes with the names and common
+// aliases travellers write them as. Trips and regional leaderboards are keyed
+// by the code, so "Japan", "jp" and "日本" all count towards the same board.
+var countries = []struct {
+	code  string
+	names []string
+}{
+	{"AD", []string{"Andorra"}},
+	{"AE", []string{"United Arab Emirates", "UAE", "阿联酋"}},
+	{"AF", []string{"Afghanistan"}},
+	{"AG", []string{"Antigua and Barbuda"}},
+	{"AI", []string{"Anguilla"}},
+	{"AL", []string{"Albania"}},
+	{"AM", []string{"Armenia"}},
+	{"AO", []string{"Angola"}},
+	{"AQ", []string{"Antarctica", "南极洲"}},
+	{"AR", []string{"Argentina", "阿根廷"}},
+	{"AS", []string{"American Samoa"}},
+	{"AT", []string{"Austria", "奥地利"}},
+	{"AU", []string{"Australia", "澳大利亚", "澳洲"}},
+	{"AW", []string{"Aruba"}},
+	{"AX", []string{"Åland Islands", "Aland Islands"}},
+	{"AZ", []string{"Azerbaijan"}},
+	{"BA", []string{"Bosnia and Herzegovina"}},
+	{"BB", []string{"Barbados"}},
+	{"BD", []string{"Bangladesh"}},
+	{"BE", []string{"Belgium", "比利时"}},
+	{"BF", []string{"Burkina Faso"}},
+	{"BG", []string{"Bulgaria"}},
+	{"BH", []string{"Bahrain"}},
+	{"BI", []string{"Burundi"}},
+	{"BJ", []string{"Benin"}},
+	{"BL", []string{"Saint Barthélemy", "Saint Barthelemy"}},
+	{"BM", []string{"Bermuda"}},
+	{"BN", []string{"Brunei", "Brunei Darussalam"}},
+	{"BO", []string{"Bolivia"}},
+	{"BQ", []string{"Caribbean Netherlands", "Bonaire, Sint Eustatius and Saba"}},
+	{"BR", []string{"Brazil", "巴西"}},
+	{"BS", []string{"Bahamas"}},
+	{"BT", []string{"Bhutan", "不丹"}},
+	{"BV", []string{"Bouvet Island"}},
+	{"BW", []string{"Botswana"}},
+	{"BY", []string{"Belarus"}},
+	{"BZ", []string{"Belize"}},
+	{"CA", []string{"Canada", "加拿大"}},
+	{"CC", []string{"Cocos (Keeling) Islands", "Cocos Islands"}},
+	{"CD", []string{"Democratic Republic of the Congo", "DR Congo"}},
+	{"CF", []string{"Central African Republic"}},
+	{"CG", []string{"Republic of the Congo", "Congo"}},
+	{"CH", []string{"Switzerland", "瑞士"}},
+	{"CI", []string{"Côte d'Ivoire", "Cote d'Ivoire", "Ivory Coast"}},
+	{"CK", []string{"Cook Islands"}},
+	{"CL", []string{"Chile", "智利"}},
+	{"CM", []string{"Cameroon"}},
+	{"CN", []string{"China", "中国"}},
+	{"CO", []string{"Colombia"}},
+	{"CR", []string{"Costa Rica"}},
+	{"CU", []string{"Cuba"}},
+	{"CV", []string{"Cape Verde", "Cabo Verde"}},
+	{"CW", []string{"Curaçao", "Curacao"}},
+	{"CX", []string{"Christmas Island"}},
+	{"CY", []string{"Cyprus"}},
+	{"CZ", []string{"Czechia", "Czech Republic", "捷克"}},
+	{"DE", []string{"Germany", "德国"}},
+	{"DJ", []string{"Djibouti"}},
+	{"DK", []string{"Denmark", "丹麦"}},
+	{"DM", []string{"Dominica"}},
+	{"DO", []string{"Dominican Republic"}},
+	{"DZ", []string{"Algeria"}},
+	{"EC", []string{"Ecuador"}},
+	{"EE", []string{"Estonia"}},
+	{"EG", []string{"Egypt", "埃及"}},
+	{"EH", []string{"Western Sahara"}},
+	{"ER", []string{"Eritrea"}},
+	{"ES", []string{"Spain", "西班牙"}},
+	{"ET", []string{"Ethiopia"}},
+	{"FI", []string{"Finland", "芬兰"}},
+	{"FJ", []string{"Fiji", "斐济"}},
+	{"FK", []string{"Falkland Islands"}},
+	{"FM", []string{"Micronesia"}},
+	{"FO", []string{"Faroe Islands"}},
+	{"FR", []string{"France", "法国"}},
+	{"GA", []string{"Gabon"}},
+	{"GB", []string{"United Kingdom", "UK", "Great Britain", "Britain", "England", "Scotland", "Wales", "Northern Ireland", "英国"}},
+	{"GD", []string{"Grenada"}},
+	{"GE", []string{"Georgia"}},
+	{"GF", []string{"French Guiana"}},
+	{"GG", []string{"Guernsey"}},
+	{"GH", []string{"Ghana"}},
+	{"GI", []string{"Gibraltar"}},
+	{"GL", []string{"Greenland"}},
+	{"GM", []string{"Gambia"}},
+	{"GN", []string{"Guinea"}},
+	{"GP", []string{"Guadeloupe"}},
+	{"GQ", []string{"Equatorial Guinea"}},
+	{"GR", []string{"Greece", "希腊"}},
+	{"GS", []string{"South Georgia and the South Sandwich Islands"}},
+	{"GT", []string{"Guatemala"}},
+	{"GU", []string{"Guam", "关岛"}},
+	{"GW", []string{"Guinea-Bissau"}},
+	{"GY", []string{"Guyana"}},
+	{"HK", []string{"Hong Kong", "香港"}},
+	{"HM", []string{"Heard Island and McDonald Islands"}},
+	{"HN", []string{"Honduras"}},
+	{"HR", []string{"Croatia", "克罗地亚"}},
+	{"HT", []string{"Haiti"}},
+	{"HU", []string{"Hungary", "匈牙利"}},
+	{"ID", []string{"Indonesia", "印度尼西亚", "印尼"}},
+	{"IE", []string{"Ireland", "爱尔兰"}},
+	{"IL", []string{"Israel"}},
+	{"IM", []string{"Isle of Man"}},
+	{"IN", []string{"India", "印度"}},
+	{"IO", []string{"British Indian Ocean Territory"}},
+	{"IQ", []string{"Iraq"}},
+	{"IR", []string{"Iran"}},
+	{"IS", []string{"Iceland", "冰岛"}},
+	{"IT", []string{"Italy", "意大利"}},
+	{"JE", []string{"Jersey"}},
+	{"JM", []string{"Jamaica"}},
+	{"JO", []string{"Jordan"}},
+	{"JP", []string{"Japan", "日本"}},
+	{"KE", []string{"Kenya", "肯尼亚"}},
+	{"KG", []string{"Kyrgyzstan"}},
+	{"KH", []string{"Cambodia", "柬埔寨"}},
+	{"KI", []string{"Kiribati"}},
+	{"KM", []string{"Comoros"}},
+	{"KN", []string{"Saint Kitts and Nevis"}},
+	{"KP", []string{"North Korea"}},
+	{"KR", []string{"South Korea", "Korea", "韩国"}},
+	{"KW", []string{"Kuwait"}},
+	{"KY", []string{"Cayman Islands"}},
+	{"KZ", []string{"Kazakhstan"}},
+	{"LA", []string{"Laos", "老挝"}},
+	{"LB", []string{"Lebanon"}},
+	{"LC", []string{"Saint Lucia"}},
+	{"LI", []string{"Liechtenstein"}},
+	{"LK", []string{"Sri Lanka", "斯里兰卡"}},
+	{"LR", []string{"Liberia"}},
+	{"LS", []string{"Lesotho"}},
+	{"LT", []string{"Lithuania"}},
+	{"LU", []string{"Luxembourg"}},
+	{"LV", []string{"Latvia"}},
+	{"LY", []string{"Libya"}},
+	{"MA", []string{"Morocco", "摩洛哥"}},
+	{"MC", []string{"Monaco"}},
+	{"MD", []string{"Moldova"}},
+	{"ME", []string{"Montenegro"}},
+	{"MF", []string{"Saint Martin"}},
+	{"MG", []string{"Madagascar"}},
+	{"MH", []string{"Marshall Islands"}},
+	{"MK", []string{"North Macedonia", "Macedonia"}},
+	{"ML", []string{"Mali"}},
+	{"MM", []string{"Myanmar", "Burma", "缅甸"}},
+	{"MN", []string{"Mongolia", "蒙古"}},
+	{"MO", []string{"Macao", "Macau", "澳门"}},
+	{"MP", []string{"Northern Mariana Islands"}},
+	{"MQ", []string{"Martinique"}},
+	{"MR", []string{"Mauritania"}},
+	{"MS", []string{"Montserrat"}},
+	{"MT", []string{"Malta"}},
+	{"MU", []string{"Mauritius", "毛里求斯"}},
+	{"MV", []string{"Maldives", "马尔代夫"}},
+	{"MW", []string{"Malawi"}},
+	{"MX", []string{"Mexico", "墨西哥"}},
+	{"MY", []string{"Malaysia", "马来西亚"}},
+	{"MZ", []string{"Mozambique"}},
+	{"NA", []string{"Namibia"}},
+	{"NC", []string{"New Caledonia"}},
+	{"NE", []string{"Niger"}},
+	{"NF", []string{"Norfolk Island"}},
+	{"NG", []string{"Nigeria"}},
+	{"NI", []string{"Nicaragua"}},
+	{"NL", []string{"Netherlands", "Holland", "荷兰"}},
+	{"NO", []string{"Norway", "挪威"}},
+	{"NP", []string{"Nepal", "尼泊尔"}},
+	{"NR", []string{"Nauru"}},
+	{"NU", []string{"Niue"}},
+	{"NZ", []string{"New Zealand", "新西兰"}},
+	{"OM", []string{"Oman"}},
+	{"PA", []string{"Panama"}},
+	{"PE", []string{"Peru", "秘鲁"}},
+	{"PF", []string{"French Polynesia"}},
+	{"PG", []string{"Papua New Guinea"}},
+	{"PH", []string{"Philippines", "菲律宾"}},
+	{"PK", []string{"Pakistan"}},
+	{"PL", []string{"Poland", "波兰"}},
+	{"PM", []string{"Saint Pierre and Miquelon"}},
+	{"PN", []string{"Pitcairn Islands"}},
+	{"PR", []string{"Puerto Rico"}},
+	{"PS", []string{"Palestine"}},
+	{"PT", []string{"Portugal", "葡萄牙"}},
+	{"PW", []string{"Palau"}},
+	{"PY", []string{"Paraguay"}},
+	{"QA", []string{"Qatar"}},
+	{"RE", []string{"Réunion", "Reunion"}},
+	{"RO", []string{"Romania"}},
+	{"RS", []string{"Serbia"}},
+	{"RU", []string{"Russia", "Russian Federation", "俄罗斯"}},
+	{"RW", []string{"Rwanda"}},
+	{"SA", []string{"Saudi Arabia"}},
+	{"SB", []string{"Solomon Islands"}},
+	{"SC", []string{"Seychelles"}},
+	{"SD", []string{"Sudan"}},
+	{"SE", []string{"Sweden", "瑞典"}},
+	{"SG", []string{"Singapore", "新加坡"}},
+	{"SH", []string{"Saint Helena"}},
+	{"SI", []string{"Slovenia"}},
+	{"SJ", []string{"Svalbard and Jan Mayen"}},
+	{"SK", []string{"Slovakia"}},
+	{"SL", []string{"Sierra Leone"}},
+	{"SM", []string{"San Marino"}},
+	{"SN", []string{"Senegal"}},
+	{"SO", []string{"Somalia"}},
+	{"SR", []string{"Suriname"}},
+	{"SS", []string{"South Sudan"}},
+	{"ST", []string{"São Tomé and Príncipe", "Sao Tome and Principe"}},
+	{"SV", []string{"El Salvador"}},
+	{"SX", []string{"Sint Maarten"}},
+	{"SY", []string{"Syria"}},
+	{"SZ", []string{"Eswatini", "Swaziland"}},
+	{"TC", []string{"Turks and Caicos Islands"}},
+	{"TD", []string{"Chad"}},
+	{"TF", []string{"French Southern Territories"}},
+	{"TG", []string{"Togo"}},
+	{"TH", []string{"Thailand", "泰国"}},
+	{"TJ", []string{"Tajikistan"}},
+	{"TK", []string{"Tokelau"}},
+	{"TL", []string{"Timor-Leste", "East Timor"}},
+	{"TM", []string{"Turkmenistan"}},
+	{"TN", []string{"Tunisia"}},
+	{"TO", []string{"Tonga"}},
+	{"TR", []string{"Türkiye", "Turkiye", "Turkey", "土耳其"}},
+	{"TT", []string{"Trinidad and Tobago"}},
+	{"TV", []string{"Tuvalu"}},
+	{"TW", []string{"Taiwan", "台湾"}},
+	{"TZ", []string{"Tanzania", "坦桑尼亚"}},
+	{"UA", []string{"Ukraine"}},
+	{"UG", []string{"Uganda"}},
+	{"UM", []string{"United States Minor Outlying Islands"}},
+	{"US", []string{"United States", "United States of America", "USA", "America", "美国"}},
+	{"UY", []string{"Uruguay"}},
+	{"UZ", []string{"Uzbekistan"}},
+	{"VA", []string{"Vatican City", "Vatican", "Holy See"}},
+	{"VC", []string{"Saint Vincent and the Grenadines"}},
+	{"VE", []string{"Venezuela"}},
+	{"VG", []string{"British Virgin Islands"}},
+	{"VI", []string{"U.S. Virgin Islands", "US Virgin Islands"}},
+	{"VN", []string{"Vietnam", "Viet Nam", "越南"}},
+	{"VU", []string{"Vanuatu"}},
+	{"WF", []string{"Wallis and Futuna"}},
+	{"WS", []string{"Samoa"}},
+	{"YE", []string{"Yemen"}},
+	{"YT", []string{"Mayotte"}},
+	{"ZA", []string{"South Africa", "南非"}},
+	{"ZM", []string{"Zambia"}},
+	{"ZW", []string{"Zimbabwe"}},
+}
+
+var countryLookup = buildCountryLookup()
+
+func buildCountryLookup() map[string]string {
+	lookup := make(map[string]string, len(countries)*3)
+	for _, c := range countries {
+		lookup[c.code] = c.code
+		for _, name := range c.names {
+			lookup[countryKey(name)] = c.code
+		}
+	}
+	return lookup
+}
+
+// countryKey folds the spelling differences the lookup ignores: case, dots,
+// repeated spaces and a leading "the".
+func countryKey(name string) string {
+	key := strings.Join(strings.Fields(strings.ToUpper(strings.ReplaceAll(name, ".", ""))), " ")
+	return strings.TrimPrefix(key, "THE ")
+}
+
+// countryCode returns the ISO 3166-1 alpha-2 code of a country given by code
+// or name, or "" if it is not recognised.
+func countryCode(name string) string {
+	return countryLookup[countryKey(name)]
+}
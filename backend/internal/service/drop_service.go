@@ -0,0 +1,259 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+var (
+	ErrDropNotFound      = errors.New("drop not found")
+	ErrDropNotOpen       = errors.New("drop is not accepting entries")
+	ErrDropStillOpen     = errors.New("drop entry window has not closed yet")
+	ErrDropNotDrawn      = errors.New("drop has not been drawn yet")
+	ErrInvalidDropWindow = errors.New("closes_at must be after opens_at and in the future")
+)
+
+// DropService runs limited-time flash drops. Instead of first come, first
+// served, users enter during a window and a seeded lottery allocates the
+// reward's inventory when it closes. Only winners are charged.
+type DropService struct {
+	drops   *repository.DropRepository
+	rewards *repository.RewardRepository
+	users   *repository.UserRepository
+	// redemptions notifies the redemption listeners about winners.
+	redemptions *RewardService
+}
+
+type DropInput struct {
+	RewardID uint      `json:"reward_id"`
+	OpensAt  time.Time `json:"opens_at"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+// DropResults is the public audit trail of a drawn drop. Anyone can recompute
+// the order with DrawOrder from Seed and the entrants' user IDs and check
+// Seed against the SeedHash published when the drop was created.
+type DropResults struct {
+	Drop    *models.Drop       `json:"drop"`
+	Entries []models.DropEntry `json:"entries"`
+}
+
+func NewDropService(drops *repository.DropRepository, rewards *repository.RewardRepository, users *repository.UserRepository, redemptions *RewardService) *DropService {
+	return &DropService{drops: drops, rewards: rewards, users: users, redemptions: redemptions}
+}
+
+// Create schedules a drop for a reward and reserves the reward for it. The
+// seed is always drawn from crypto/rand so nobody, admins included, can pick
+// one that favours an entrant; only its hash is revealed until the draw.
+func (s *DropService) Create(input DropInput) (*models.Drop, error) {
+	if !input.ClosesAt.After(input.OpensAt) || !input.ClosesAt.After(time.Now()) {
+		return nil, ErrInvalidDropWindow
+	}
+	reward, err := s.rewards.FindByID(input.RewardID)
+	if err != nil || reward.ArchivedAt != nil {
+		return nil, repository.ErrRewardUnavailable
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	seed := hex.EncodeToString(buf)
+	drop := &models.Drop{
+		RewardID: reward.ID,
+		Reward:   *reward,
+		OpensAt:  input.OpensAt,
+		ClosesAt: input.ClosesAt,
+		Status:   models.DropOpen,
+		SeedHash: seedHash(seed),
+		Seed:     seed,
+	}
+	if err := s.drops.Create(drop); err != nil {
+		return nil, err
+	}
+	drop.Reward.InDrop = true
+	return withHiddenSeed(drop), nil
+}
+
+func (s *DropService) List(limit int) ([]models.Drop, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	drops, err := s.drops.List(limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range drops {
+		withHiddenSeed(&drops[i])
+	}
+	return drops, nil
+}
+
+func (s *DropService) Get(id uint) (*models.Drop, error) {
+	drop, err := s.drops.FindByID(id)
+	if err != nil {
+		return nil, ErrDropNotFound
+	}
+	return withHiddenSeed(drop), nil
+}
+
+// Enter adds the user to an open drop. Users must meet the reward's rules and
+// hold enough points when entering; both are checked again at the draw.
+func (s *DropService) Enter(userID, dropID uint) (*models.DropEntry, error) {
+	drop, err := s.drops.FindByID(dropID)
+	if err != nil {
+		return nil, ErrDropNotFound
+	}
+	now := time.Now()
+	if drop.Status != models.DropOpen || now.Before(drop.OpensAt) || !now.Before(drop.ClosesAt) {
+		return nil, ErrDropNotOpen
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.rewards.ActiveRedemptionCounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	if violations := ruleViolations(&drop.Reward, user, counts[drop.RewardID], now); len(violations) > 0 {
+		return nil, violations[0]
+	}
+	if user.Points < drop.Reward.PointsCost {
+		return nil, repository.ErrInsufficientPoints
+	}
+
+	entry := &models.DropEntry{DropID: drop.ID, UserID: userID, Result: models.DropEntryPending}
+	if err := s.drops.AddEntry(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// MyEntry returns the user's entry into the drop, or nil.
+func (s *DropService) MyEntry(userID, dropID uint) (*models.DropEntry, error) {
+	return s.drops.FindEntry(dropID, userID)
+}
+
+// Draw runs the lottery of a drop whose entry window has closed.
+func (s *DropService) Draw(dropID uint) (*DropResults, error) {
+	drop, err := s.drops.FindByID(dropID)
+	if err != nil {
+		return nil, ErrDropNotFound
+	}
+	if drop.Status != models.DropOpen {
+		return nil, repository.ErrDropDrawn
+	}
+	if time.Now().Before(drop.ClosesAt) {
+		return nil, ErrDropStillOpen
+	}
+	if err := s.draw(drop); err != nil {
+		return nil, err
+	}
+	return s.Results(dropID)
+}
+
+// DrawDue draws every drop whose window has closed and returns how many were
+// drawn. A drop that fails to draw does not hold up the others; it is tried
+// again next time and its error is returned joined with those of the other
+// failed drops.
+func (s *DropService) DrawDue() (int, error) {
+	due, err := s.drops.ListDue(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	drawn := 0
+	var errs []error
+	for i := range due {
+		err := s.draw(&due[i])
+		if errors.Is(err, repository.ErrDropDrawn) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("flash drop %d: %w", due[i].ID, err))
+			continue
+		}
+		drawn++
+	}
+	return drawn, errors.Join(errs...)
+}
+
+// Results returns the audit trail of a drawn drop.
+func (s *DropService) Results(dropID uint) (*DropResults, error) {
+	drop, err := s.drops.FindByID(dropID)
+	if err != nil {
+		return nil, ErrDropNotFound
+	}
+	if drop.Status != models.DropDrawn {
+		return nil, ErrDropNotDrawn
+	}
+	entries, err := s.drops.Entries(dropID)
+	if err != nil {
+		return nil, err
+	}
+	return &DropResults{Drop: drop, Entries: entries}, nil
+}
+
+func (s *DropService) draw(drop *models.Drop) error {
+	entries, err := s.drops.Entries(drop.ID)
+	if err != nil {
+		return err
+	}
+	ordered := DrawOrder(drop.Seed, drop.ID, entries)
+	results, err := s.drops.Draw(drop, drop.Seed, ordered, checkRules)
+	if err != nil {
+		return err
+	}
+	log.Printf("drew flash drop %d: %d entries, %d winners", drop.ID, len(entries), len(results))
+	for _, r := range results {
+		s.redemptions.redemptionCreated(r.User, r.Redemption)
+	}
+	return nil
+}
+
+// DrawOrder returns the entries in lottery order. Each entry's ticket is the
+// SHA-256 of "<seed>:<drop id>:<user id>" and entries are ranked by ticket, so
+// the order depends only on the seed and who entered, not on when or in which
+// order they did.
+func DrawOrder(seed string, dropID uint, entries []models.DropEntry) []models.DropEntry {
+	ordered := make([]models.DropEntry, len(entries))
+	copy(ordered, entries)
+	for i := range ordered {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%d", seed, dropID, ordered[i].UserID)))
+		ordered[i].Ticket = hex.EncodeToString(sum[:])
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].Ticket != ordered[j].Ticket {
+			return ordered[i].Ticket < ordered[j].Ticket
+		}
+		return ordered[i].UserID < ordered[j].UserID
+	})
+	for i := range ordered {
+		ordered[i].Position = i + 1
+	}
+	return ordered
+}
+
+func seedHash(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// withHiddenSeed blanks the seed of undrawn drops so entrants cannot predict
+// the outcome.
+func withHiddenSeed(drop *models.Drop) *models.Drop {
+	if drop.Status != models.DropDrawn {
+		drop.Seed = ""
+	}
+	return drop
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestFlashDropLottery(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	dropRepo := repository.NewDropRepository(db)
+	rewards := NewRewardService(rewardRepo, userRepo)
+	drops := NewDropService(dropRepo, rewardRepo, userRepo, rewards)
+
+	reward := &models.Reward{Name: "Sold Out Sneakers", PointsCost: 50, Inventory: 2}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+
+	drop, err := drops.Create(DropInput{
+		RewardID: reward.ID,
+		OpensAt:  time.Now().Add(-time.Minute),
+		ClosesAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("create drop failed: %v", err)
+	}
+	created, err := dropRepo.FindByID(drop.ID)
+	if err != nil {
+		t.Fatalf("failed to load drop: %v", err)
+	}
+	seed := created.Seed
+	if len(seed) != 64 || drop.Seed != "" || drop.SeedHash != seedHash(seed) {
+		t.Fatalf("expected a random seed with only its hash published, got %+v", drop)
+	}
+	if _, err := drops.Create(DropInput{RewardID: reward.ID, OpensAt: time.Now(), ClosesAt: time.Now().Add(time.Hour)}); !errors.Is(err, repository.ErrDropActive) {
+		t.Fatalf("expected a second drop for the reward to fail, got %v", err)
+	}
+
+	entrants := make([]*models.User, 5)
+	for i := range entrants {
+		entrants[i] = &models.User{Username: fmt.Sprintf("dropper-%d", i), Email: fmt.Sprintf("dropper-%d@example.com", i), Password: "secret", Points: 100}
+		if err := userRepo.Create(entrants[i]); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	if _, _, err := rewards.Redeem(entrants[0].ID, reward.ID); !errors.Is(err, ErrRewardInDrop) {
+		t.Fatalf("expected direct redemption to be blocked during the drop, got %v", err)
+	}
+
+	for _, u := range entrants {
+		if _, err := drops.Enter(u.ID, drop.ID); err != nil {
+			t.Fatalf("enter failed: %v", err)
+		}
+	}
+	if _, err := drops.Enter(entrants[0].ID, drop.ID); !errors.Is(err, repository.ErrAlreadyEntered) {
+		t.Fatalf("expected duplicate entry to fail, got %v", err)
+	}
+	if _, err := drops.Draw(drop.ID); !errors.Is(err, ErrDropStillOpen) {
+		t.Fatalf("expected draw before close to fail, got %v", err)
+	}
+
+	// The first ticket spends their points before the draw and must be
+	// skipped in favour of the next ones.
+	entries, _ := dropRepo.Entries(drop.ID)
+	expected := DrawOrder(seed, drop.ID, entries)
+	if _, err := userRepo.AddPoints(expected[0].UserID, -80, "redeem"); err != nil {
+		t.Fatalf("failed to drain points: %v", err)
+	}
+
+	db.Model(&models.Drop{}).Where("id = ?", drop.ID).Update("closes_at", time.Now().Add(-time.Second))
+	if _, err := drops.Enter(entrants[0].ID, drop.ID); !errors.Is(err, ErrDropNotOpen) {
+		t.Fatalf("expected entries after close to fail, got %v", err)
+	}
+	if n, err := drops.DrawDue(); err != nil || n != 1 {
+		t.Fatalf("expected one drop drawn, got %d (%v)", n, err)
+	}
+
+	results, err := drops.Results(drop.ID)
+	if err != nil {
+		t.Fatalf("results failed: %v", err)
+	}
+	if results.Drop.Seed != seed || results.Drop.Winners != 2 || results.Drop.Entries != 5 {
+		t.Fatalf("unexpected drop after draw: %+v", results.Drop)
+	}
+	wantResults := []string{models.DropEntryIneligible, models.DropEntryWon, models.DropEntryWon, models.DropEntryLost, models.DropEntryLost}
+	for i, entry := range results.Entries {
+		if entry.UserID != expected[i].UserID || entry.Position != i+1 || entry.Ticket != expected[i].Ticket {
+			t.Fatalf("entry %d does not match the reproducible order: %+v vs %+v", i, entry, expected[i])
+		}
+		if entry.Result != wantResults[i] {
+			t.Fatalf("entry %d: expected %s, got %s", i, wantResults[i], entry.Result)
+		}
+		user, _ := userRepo.FindByID(entry.UserID)
+		switch entry.Result {
+		case models.DropEntryWon:
+			if user.Points != 50 || entry.RedemptionID == nil {
+				t.Fatalf("winner %d should be charged once, has %d points", user.ID, user.Points)
+			}
+		case models.DropEntryLost:
+			if user.Points != 100 {
+				t.Fatalf("loser %d should not be charged, has %d points", user.ID, user.Points)
+			}
+		}
+	}
+
+	// Re-deriving the order from the published seed yields the same result.
+	again := DrawOrder(results.Drop.Seed, drop.ID, results.Entries)
+	for i := range again {
+		if again[i].UserID != results.Entries[i].UserID {
+			t.Fatalf("draw order is not reproducible at position %d", i+1)
+		}
+	}
+
+	stored, _ := rewardRepo.FindByID(reward.ID)
+	if stored.Inventory != 0 || stored.InDrop {
+		t.Fatalf("expected inventory allocated and reward released, got %+v", stored)
+	}
+	if _, err := drops.Draw(drop.ID); !errors.Is(err, repository.ErrDropDrawn) {
+		t.Fatalf("expected second draw to fail, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+)
+
+// Eligibility codes returned to clients when a reward cannot be redeemed.
+const (
+	EligibilityLevelTooLow        = "level_too_low"
+	EligibilityLimitReached       = "limit_reached"
+	EligibilityNotStarted         = "not_started"
+	EligibilityEnded              = "ended"
+	EligibilityRegionRestricted   = "region_restricted"
+	EligibilityOutOfStock         = "out_of_stock"
+	EligibilityInsufficientPoints = "insufficient_points"
+	EligibilityDropOnly           = "drop_only"
+)
+
+// EligibilityError reports why a user may not redeem a reward. Code is one of
+// the Eligibility constants and is stable for clients to switch on.
+type EligibilityError struct {
+	Code    string
+	Message string
+}
+
+func (e *EligibilityError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrLevelTooLow      = &EligibilityError{EligibilityLevelTooLow, "user level is too low for this reward"}
+	ErrLimitReached     = &EligibilityError{EligibilityLimitReached, "redemption limit for this reward reached"}
+	ErrRewardNotStarted = &EligibilityError{EligibilityNotStarted, "reward is not available yet"}
+	ErrRewardEnded      = &EligibilityError{EligibilityEnded, "reward is no longer available"}
+	ErrRegionRestricted = &EligibilityError{EligibilityRegionRestricted, "reward is not available in your region"}
+	ErrRewardInDrop     = &EligibilityError{EligibilityDropOnly, "reward is only available through its flash drop"}
+)
+
+// RewardListing is a catalog entry annotated with whether the caller can
+// redeem it. Eligible is omitted for anonymous callers.
+type RewardListing struct {
+	models.Reward
+	Eligible          *bool    `json:"eligible,omitempty"`
+	IneligibleReasons []string `json:"ineligible_reasons,omitempty"`
+}
+
+// ruleViolations evaluates the optional rules configured on the reward and
+// returns every rule the user fails, in a fixed order.
+func ruleViolations(reward *models.Reward, user *models.User, active int64, now time.Time) []*EligibilityError {
+	var violations []*EligibilityError
+	if reward.MinLevel > 0 && user.Level < reward.MinLevel {
+		violations = append(violations, ErrLevelTooLow)
+	}
+	if reward.MaxPerUser > 0 && active >= int64(reward.MaxPerUser) {
+		violations = append(violations, ErrLimitReached)
+	}
+	if reward.StartsAt != nil && now.Before(*reward.StartsAt) {
+		violations = append(violations, ErrRewardNotStarted)
+	}
+	if reward.EndsAt != nil && !now.Before(*reward.EndsAt) {
+		violations = append(violations, ErrRewardEnded)
+	}
+	if !regionAllowed(reward.Regions, user.Region) {
+		violations = append(violations, ErrRegionRestricted)
+	}
+	return violations
+}
+
+func regionAllowed(regions, region string) bool {
+	if strings.TrimSpace(regions) == "" {
+		return true
+	}
+	for _, r := range strings.Split(regions, ",") {
+		if strings.EqualFold(strings.TrimSpace(r), region) && region != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRegions upper-cases and de-duplicates a comma separated region
+// list.
+func normalizeRegions(regions string) string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, r := range strings.Split(regions, ",") {
+		r = strings.ToUpper(strings.TrimSpace(r))
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		out = append(out, r)
+	}
+	return strings.Join(out, ",")
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+	"gorm.io/gorm"
+)
+
+// maxFollowing caps how many users one user may follow, which also bounds
+// the friends leaderboard.
+const maxFollowing = 1000
+
+var (
+	ErrCannotFollowSelf = errors.New("you cannot follow yourself")
+	ErrFollowLimit      = errors.New("following limit reached")
+	ErrUserNotFound     = errors.New("user not found")
+)
+
+type FollowService struct {
+	follows     *repository.FollowRepository
+	users       *repository.UserRepository
+	leaderboard Leaderboard
+}
+
+// FollowedUser is one entry of a following or followers list.
+type FollowedUser struct {
+	ID         uint      `json:"id"`
+	Username   string    `json:"username"`
+	Level      int       `json:"level"`
+	AvatarURL  string    `json:"avatar_url,omitempty"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func NewFollowService(follows *repository.FollowRepository, users *repository.UserRepository, lb Leaderboard) *FollowService {
+	return &FollowService{follows: follows, users: users, leaderboard: lb}
+}
+
+func (s *FollowService) Follow(followerID, followeeID uint) error {
+	if followerID == followeeID {
+		return ErrCannotFollowSelf
+	}
+	if _, err := s.users.FindByID(followeeID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	count, err := s.follows.CountFollowing(followerID)
+	if err != nil {
+		return err
+	}
+	if count >= maxFollowing {
+		return ErrFollowLimit
+	}
+	return s.follows.Follow(followerID, followeeID)
+}
+
+func (s *FollowService) Unfollow(followerID, followeeID uint) error {
+	return s.follows.Unfollow(followerID, followeeID)
+}
+
+// Following lists the users the user follows.
+func (s *FollowService) Following(userID uint) ([]FollowedUser, error) {
+	follows, err := s.follows.Following(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.followedUsers(follows, func(f models.Follow) uint { return f.FolloweeID })
+}
+
+// Followers lists the users following the user.
+func (s *FollowService) Followers(userID uint) ([]FollowedUser, error) {
+	follows, err := s.follows.Followers(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.followedUsers(follows, func(f models.Follow) uint { return f.FollowerID })
+}
+
+func (s *FollowService) followedUsers(follows []models.Follow, other func(models.Follow) uint) ([]FollowedUser, error) {
+	ids := make([]uint, len(follows))
+	for i, f := range follows {
+		ids[i] = other(f)
+	}
+	users, err := s.users.FindByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+	list := make([]FollowedUser, 0, len(follows))
+	for _, f := range follows {
+		u, ok := byID[other(f)]
+		if !ok {
+			continue
+		}
+		list = append(list, FollowedUser{ID: u.ID, Username: u.Username, Level: u.Level, AvatarURL: u.AvatarURL, FollowedAt: f.CreatedAt})
+	}
+	return list, nil
+}
+
+// FriendsLeaderboard ranks the user and the people they follow.
+func (s *FollowService) FriendsLeaderboard(userID uint, limit int) ([]LeaderboardEntry, error) {
+	if s.leaderboard == nil {
+		return nil, errors.New("leaderboard not configured")
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	ids, err := s.follows.FollowingIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids = append(ids, userID)
+	entries, err := s.leaderboard.TopAmong(ids, limit)
+	if err != nil {
+		return nil, err
+	}
+	return entries, hydrateEntries(s.users, entries)
+}
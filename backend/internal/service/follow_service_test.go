@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestFriendsLeaderboard(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	lb := NewMemoryLeaderboard()
+	follows := NewFollowService(repository.NewFollowRepository(db), userRepo, lb)
+
+	var users []*models.User
+	for i, name := range []string{"fan", "idol", "rival", "stranger"} {
+		u := &models.User{Username: name, Email: name + "@follow.example.com", Password: "secret", Points: int64(100 * (i + 1))}
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		lb.AddScore(u.ID, u.Points)
+		users = append(users, u)
+	}
+	fan, idol, rival, stranger := users[0], users[1], users[2], users[3]
+
+	if err := follows.Follow(fan.ID, fan.ID); !errors.Is(err, ErrCannotFollowSelf) {
+		t.Fatalf("expected ErrCannotFollowSelf, got %v", err)
+	}
+	if err := follows.Follow(fan.ID, 999999); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("expected ErrUserNotFound, got %v", err)
+	}
+	for _, id := range []uint{idol.ID, rival.ID, rival.ID} {
+		if err := follows.Follow(fan.ID, id); err != nil {
+			t.Fatalf("follow failed: %v", err)
+		}
+	}
+
+	entries, err := follows.FriendsLeaderboard(fan.ID, 10)
+	if err != nil {
+		t.Fatalf("friends leaderboard failed: %v", err)
+	}
+	want := []uint{rival.ID, idol.ID, fan.ID}
+	if len(entries) != len(want) {
+		t.Fatalf("unexpected friends board: %+v", entries)
+	}
+	for i, e := range entries {
+		if e.UserID != want[i] || e.Rank != int64(i+1) || e.Username == "" {
+			t.Fatalf("unexpected friends board: %+v", entries)
+		}
+	}
+	if top, _ := follows.FriendsLeaderboard(stranger.ID, 10); len(top) != 1 || top[0].UserID != stranger.ID {
+		t.Fatalf("a user without follows should only see themselves, got %+v", top)
+	}
+
+	if err := follows.Unfollow(fan.ID, rival.ID); err != nil {
+		t.Fatalf("unfollow failed: %v", err)
+	}
+	if err := follows.Unfollow(fan.ID, rival.ID); !errors.Is(err, repository.ErrNotFollowing) {
+		t.Fatalf("expected ErrNotFollowing, got %v", err)
+	}
+	following, _ := follows.Following(fan.ID)
+	if len(following) != 1 || following[0].ID != idol.ID {
+		t.Fatalf("unexpected following list: %+v", following)
+	}
+	followers, _ := follows.Followers(idol.ID)
+	if len(followers) != 1 || followers[0].ID != fan.ID || followers[0].Username != "fan" {
+		t.Fatalf("unexpected followers list: %+v", followers)
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+const maxIdempotencyKeyLength = 255
+
+var (
+	ErrInvalidIdempotencyKey = errors.New("idempotency key must be between 1 and 255 characters")
+	ErrIdempotencyMismatch   = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// IdempotencyService lets retried requests carrying the same Idempotency-Key
+// receive the response of the first attempt instead of running twice.
+type IdempotencyService struct {
+	records *repository.IdempotencyRepository
+	ttl     time.Duration
+}
+
+func NewIdempotencyService(records *repository.IdempotencyRepository, cfg config.Config) *IdempotencyService {
+	ttl := cfg.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &IdempotencyService{records: records, ttl: ttl}
+}
+
+// RequestHash fingerprints a request so a reused key can be told apart from
+// a genuine retry.
+func RequestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin claims key for the user. When an earlier request with the key has
+// already completed its record is returned for replay; otherwise the returned
+// record is the new claim, which the caller must Complete or Release.
+func (s *IdempotencyService) Begin(userID uint, key, requestHash string) (record *models.IdempotencyRecord, replay bool, err error) {
+	key = strings.TrimSpace(key)
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return nil, false, ErrInvalidIdempotencyKey
+	}
+
+	claim := &models.IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   time.Now().Add(s.ttl),
+	}
+	existing, err := s.records.Reserve(claim)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing == nil {
+		return claim, false, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, false, ErrIdempotencyMismatch
+	}
+	if existing.StatusCode == 0 {
+		return nil, false, ErrIdempotencyInProgress
+	}
+	return existing, true, nil
+}
+
+// Complete stores the response of the claimed request.
+func (s *IdempotencyService) Complete(record *models.IdempotencyRecord, status int, contentType string, body []byte) error {
+	record.StatusCode = status
+	record.ContentType = contentType
+	record.Body = body
+	return s.records.Complete(record)
+}
+
+// Release drops a claim so the request can be retried, e.g. after a server
+// error that should not be replayed.
+func (s *IdempotencyService) Release(record *models.IdempotencyRecord) error {
+	return s.records.Delete(record)
+}
+
+func (s *IdempotencyService) PurgeExpired() (int64, error) {
+	return s.records.PurgeExpired(time.Now())
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestIdempotencyReplayAndConflict(t *testing.T) {
+	db := setupTestDB(t)
+	service := NewIdempotencyService(repository.NewIdempotencyRepository(db), config.Config{IdempotencyTTL: time.Hour})
+
+	hash := RequestHash("POST", "/api/v1/rewards/redeem", []byte(`{"reward_id":1}`))
+	record, replay, err := service.Begin(1, "retry-key", hash)
+	if err != nil || replay {
+		t.Fatalf("expected a fresh claim, got replay=%v err=%v", replay, err)
+	}
+
+	if _, _, err := service.Begin(1, "retry-key", hash); !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Fatalf("expected in-progress error, got %v", err)
+	}
+
+	if err := service.Complete(record, 200, "application/json", []byte(`{"ok":true}`)); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+
+	stored, replay, err := service.Begin(1, "retry-key", hash)
+	if err != nil || !replay {
+		t.Fatalf("expected replay, got replay=%v err=%v", replay, err)
+	}
+	if stored.StatusCode != 200 || string(stored.Body) != `{"ok":true}` {
+		t.Fatalf("unexpected stored response: %d %s", stored.StatusCode, stored.Body)
+	}
+
+	other := RequestHash("POST", "/api/v1/rewards/redeem", []byte(`{"reward_id":2}`))
+	if _, _, err := service.Begin(1, "retry-key", other); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Fatalf("expected mismatch error, got %v", err)
+	}
+
+	// Keys are scoped per user.
+	if _, replay, err := service.Begin(2, "retry-key", other); err != nil || replay {
+		t.Fatalf("expected another user to get a fresh claim, got replay=%v err=%v", replay, err)
+	}
+
+	if _, _, err := service.Begin(1, "", hash); !errors.Is(err, ErrInvalidIdempotencyKey) {
+		t.Fatalf("expected invalid key error, got %v", err)
+	}
+}
+
+func TestIdempotencyReleaseAndExpiry(t *testing.T) {
+	db := setupTestDB(t)
+	repo := repository.NewIdempotencyRepository(db)
+	service := NewIdempotencyService(repo, config.Config{IdempotencyTTL: time.Hour})
+
+	hash := RequestHash("POST", "/api/v1/trips", []byte(`{}`))
+	record, _, err := service.Begin(3, "release-key", hash)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if err := service.Release(record); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if _, replay, err := service.Begin(3, "release-key", hash); err != nil || replay {
+		t.Fatalf("expected released key to be claimable, got replay=%v err=%v", replay, err)
+	}
+
+	expired := NewIdempotencyService(repo, config.Config{IdempotencyTTL: time.Nanosecond})
+	record, _, err = expired.Begin(3, "expiring-key", hash)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if err := expired.Complete(record, 201, "application/json", []byte(`{}`)); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, replay, err := expired.Begin(3, "expiring-key", RequestHash("POST", "/api/v1/trips", []byte(`{"x":1}`))); err != nil || replay {
+		t.Fatalf("expected expired key to be reusable, got replay=%v err=%v", replay, err)
+	}
+}
@@ -2,14 +2,103 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"sort"
+	"math"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
 	"github.com/redis/go-redis/v9"
 )
 
+// Ties are broken in favour of the user who reached the score first. Redis
+// only orders by score, so the time is folded into the fractional part of
+// the score: earlier times give a larger fraction and the whole points stay
+// recoverable with math.Floor. Unix seconds below tieBreakBase keep the
+// fraction in (0, 1); at one-second resolution this is exact for totals up
+// to about 400,000 points and degrades gracefully beyond.
+const tieBreakBase = 1e10
+
+func tieScore(points int64, at time.Time) float64 {
+	seconds := float64(at.Unix())
+	if seconds < 1 {
+		seconds = 1
+	}
+	if seconds > tieBreakBase-1 {
+		seconds = tieBreakBase - 1
+	}
+	return float64(points) + (tieBreakBase-seconds)/tieBreakBase
+}
+
+func pointsOf(score float64) int64 {
+	return int64(math.Floor(score))
+}
+
+// reachedAtOf recovers the time tieScore folded into a score.
+func reachedAtOf(score float64) time.Time {
+	fraction := score - math.Floor(score)
+	return time.Unix(int64(math.Round(tieBreakBase-fraction*tieBreakBase)), 0)
+}
+
+// setScoreScript writes a member's score unless it already holds the same
+// whole points, which would lose the time it first reached them. Scores are
+// formatted explicitly because Lua's default conversion keeps only 14 digits.
+var setScoreScript = redis.NewScript(`
+local current = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if current and math.floor(tonumber(current)) == tonumber(ARGV[2]) then
+	return 0
+end
+return redis.call('ZADD', KEYS[1], string.format('%.17g', tonumber(ARGV[2]) + tonumber(ARGV[3])), ARGV[1])
+`)
+
+// incrScoreScript adds to a member's whole points and stamps the new total
+// with the given tie-break fraction.
+var incrScoreScript = redis.NewScript(`
+local points = tonumber(ARGV[2])
+local current = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if current then
+	points = points + math.floor(tonumber(current))
+end
+return redis.call('ZADD', KEYS[1], string.format('%.17g', points + tonumber(ARGV[3])), ARGV[1])
+`)
+
+// rankScript returns a member's score and how many members have more whole
+// points, read together so a concurrent write cannot slip in between.
+var rankScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score then
+	return false
+end
+local above = redis.call('ZCOUNT', KEYS[1], string.format('%d', math.floor(tonumber(score)) + 1), '+inf')
+return {score, above}
+`)
+
+// aroundScript returns the position of the first member around ARGV[1], the
+// number of members with more whole points than it, and the ARGV[2] members
+// on either side with their scores, all from the same state of the board.
+var aroundScript = redis.NewScript(`
+local position = redis.call('ZREVRANK', KEYS[1], ARGV[1])
+if not position then
+	return false
+end
+local start = position - tonumber(ARGV[2])
+if start < 0 then
+	start = 0
+end
+local values = redis.call('ZREVRANGE', KEYS[1], start, position + tonumber(ARGV[2]), 'WITHSCORES')
+local above = redis.call('ZCOUNT', KEYS[1], string.format('%d', math.floor(tonumber(values[2])) + 1), '+inf')
+return {start, above, values}
+`)
+
+// tieFraction is the fractional part tieScore adds for the given time.
+func tieFraction(at time.Time) string {
+	return strconv.FormatFloat(tieScore(0, at), 'f', -1, 64)
+}
+
 type RedisLeaderboard struct {
 	client *redis.Client
 	key    string
@@ -19,65 +108,579 @@ func NewRedisLeaderboard(addr string) *RedisLeaderboard {
 	if addr == "" {
 		return nil
 	}
-	client := redis.NewClient(&redis.Options{Addr: addr})
+	client := redis.NewClient(&redis.Options{
+		Addr: addr,
+		// Fail fast so an outage trips the circuit breaker instead of
+		// stalling requests.
+		DialTimeout:  2 * time.Second,
+		ReadTimeout:  time.Second,
+		WriteTimeout: time.Second,
+	})
 	return &RedisLeaderboard{client: client, key: "leaderboard:points"}
 }
 
+// Ping checks that Redis is reachable.
+func (r *RedisLeaderboard) Ping() error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return r.client.Ping(ctx).Err()
+}
+
 func (r *RedisLeaderboard) AddScore(userID uint, score int64) error {
+	return r.AddScoreAt(userID, score, time.Now())
+}
+
+func (r *RedisLeaderboard) AddScoreAt(userID uint, score int64, at time.Time) error {
 	if r == nil || r.client == nil {
 		return nil
 	}
 	ctx := context.Background()
-	return r.client.ZAdd(ctx, r.key, redis.Z{Score: float64(score), Member: fmt.Sprint(userID)}).Err()
+	return setScoreScript.Run(ctx, r.client, []string{r.key}, fmt.Sprint(userID), score, tieFraction(at)).Err()
 }
 
 func (r *RedisLeaderboard) Top(limit int) ([]LeaderboardEntry, error) {
+	return r.top(r.key, limit)
+}
+
+func (r *RedisLeaderboard) top(key string, limit int) ([]LeaderboardEntry, error) {
+	return r.rangeByRank(key, 0, int64(limit-1))
+}
+
+// rangeByRank returns the members from 0-based position start to stop,
+// highest score first, with shared ranks.
+func (r *RedisLeaderboard) rangeByRank(key string, start, stop int64) ([]LeaderboardEntry, error) {
 	if r == nil || r.client == nil {
 		return nil, nil
 	}
 	ctx := context.Background()
-	values, err := r.client.ZRevRangeWithScores(ctx, r.key, 0, int64(limit-1)).Result()
+	values, err := r.client.ZRevRangeWithScores(ctx, key, start, stop).Result()
 	if err != nil {
 		return nil, err
 	}
+	entries := entriesOf(values)
+
+	first := int64(1)
+	if start > 0 && len(entries) > 0 {
+		if first, err = r.sharedRank(key, entries[0].Points); err != nil {
+			return nil, err
+		}
+	}
+	assignRanks(entries, first, start+1)
+	return entries, nil
+}
+
+// entriesOf converts members in descending score order to entries without
+// ranks.
+func entriesOf(values []redis.Z) []LeaderboardEntry {
 	entries := make([]LeaderboardEntry, 0, len(values))
+	scores := make([]float64, 0, len(values))
 	for _, v := range values {
 		member := fmt.Sprint(v.Member)
 		if id, err := strconv.ParseUint(member, 10, 64); err == nil {
-			entries = append(entries, LeaderboardEntry{UserID: uint(id), Points: int64(v.Score)})
+			entries = append(entries, LeaderboardEntry{UserID: uint(id), Points: pointsOf(v.Score)})
+			scores = append(scores, v.Score)
+		}
+	}
+	// Members with identical scores come back in reverse lexical order;
+	// order them by user ID like the in-memory board.
+	for i := 1; i < len(entries); i++ {
+		for j := i; j > 0 && scores[j] == scores[j-1] && entries[j].UserID < entries[j-1].UserID; j-- {
+			entries[j], entries[j-1] = entries[j-1], entries[j]
+			scores[j], scores[j-1] = scores[j-1], scores[j]
+		}
+	}
+	return entries
+}
+
+// sharedRank is the rank of every member with the given whole points: one
+// more than the number of members with more points.
+func (r *RedisLeaderboard) sharedRank(key string, points int64) (int64, error) {
+	above, err := r.client.ZCount(context.Background(), key, strconv.FormatInt(points+1, 10), "+inf").Result()
+	if err != nil {
+		return 0, err
+	}
+	return above + 1, nil
+}
+
+func (r *RedisLeaderboard) Rank(userID uint) (int64, int64, bool, error) {
+	if r == nil || r.client == nil {
+		return 0, 0, false, nil
+	}
+	reply, err := rankScript.Run(context.Background(), r.client, []string{r.key}, fmt.Sprint(userID)).Slice()
+	if err == redis.Nil {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if len(reply) != 2 {
+		return 0, 0, false, fmt.Errorf("unexpected rank reply %v", reply)
+	}
+	score, err := strconv.ParseFloat(fmt.Sprint(reply[0]), 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	above, _ := reply[1].(int64)
+	return above + 1, pointsOf(score), true, nil
+}
+
+func (r *RedisLeaderboard) Around(userID uint, n int) ([]LeaderboardEntry, error) {
+	if r == nil || r.client == nil {
+		return nil, nil
+	}
+	reply, err := aroundScript.Run(context.Background(), r.client, []string{r.key}, fmt.Sprint(userID), n).Slice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 3 {
+		return nil, fmt.Errorf("unexpected around reply %v", reply)
+	}
+	start, _ := reply[0].(int64)
+	above, _ := reply[1].(int64)
+	flat, _ := reply[2].([]interface{})
+	values := make([]redis.Z, 0, len(flat)/2)
+	for i := 0; i+1 < len(flat); i += 2 {
+		score, err := strconv.ParseFloat(fmt.Sprint(flat[i+1]), 64)
+		if err != nil {
+			return nil, err
 		}
+		values = append(values, redis.Z{Member: flat[i], Score: score})
 	}
+	entries := entriesOf(values)
+	assignRanks(entries, above+1, start+1)
 	return entries, nil
 }
 
+// TopAmong intersects the board with a temporary set of the given users, so
+// Redis ranks the subset without sending the whole board.
+func (r *RedisLeaderboard) TopAmong(userIDs []uint, limit int) ([]LeaderboardEntry, error) {
+	if r == nil || r.client == nil {
+		return nil, nil
+	}
+	if len(userIDs) == 0 {
+		return []LeaderboardEntry{}, nil
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	members := r.key + ":among:" + hex.EncodeToString(suffix)
+	ranked := members + ":ranked"
+
+	ctx := context.Background()
+	var values *redis.ZSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		zs := make([]redis.Z, len(userIDs))
+		for i, id := range userIDs {
+			zs[i] = redis.Z{Member: fmt.Sprint(id)}
+		}
+		pipe.ZAdd(ctx, members, zs...)
+		// A weight of 0 keeps the board's score, tie-break included.
+		pipe.ZInterStore(ctx, ranked, &redis.ZStore{Keys: []string{r.key, members}, Weights: []float64{1, 0}})
+		values = pipe.ZRevRangeWithScores(ctx, ranked, 0, int64(limit-1))
+		pipe.Del(ctx, members, ranked)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := entriesOf(values.Val())
+	assignRanks(entries, 1, 1)
+	return entries, nil
+}
+
+func (r *RedisLeaderboard) Scores() (map[uint]int64, error) {
+	if r == nil || r.client == nil {
+		return nil, nil
+	}
+	ctx := context.Background()
+	values, err := r.client.ZRangeWithScores(ctx, r.key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[uint]int64, len(values))
+	for _, v := range values {
+		if id, err := strconv.ParseUint(fmt.Sprint(v.Member), 10, 64); err == nil {
+			scores[uint(id)] = pointsOf(v.Score)
+		}
+	}
+	return scores, nil
+}
+
+// Members returns every member with its points and the time it reached them.
+func (r *RedisLeaderboard) Members() ([]repository.UserScore, error) {
+	if r == nil || r.client == nil {
+		return nil, nil
+	}
+	values, err := r.client.ZRangeWithScores(context.Background(), r.key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]repository.UserScore, 0, len(values))
+	for _, v := range values {
+		if id, err := strconv.ParseUint(fmt.Sprint(v.Member), 10, 64); err == nil {
+			members = append(members, repository.UserScore{ID: uint(id), Points: pointsOf(v.Score), ReachedAt: reachedAtOf(v.Score)})
+		}
+	}
+	return members, nil
+}
+
+func (r *RedisLeaderboard) Remove(userID uint) error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+	ctx := context.Background()
+	return r.client.ZRem(ctx, r.key, fmt.Sprint(userID)).Err()
+}
+
+// boardKey is the Redis key of a named board.
+func (r *RedisLeaderboard) boardKey(board string) string {
+	return r.key + ":" + board
+}
+
+func (r *RedisLeaderboard) IncrBy(board string, userID uint, delta int64) error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+	ctx := context.Background()
+	return incrScoreScript.Run(ctx, r.client, []string{r.boardKey(board)}, fmt.Sprint(userID), delta, tieFraction(time.Now())).Err()
+}
+
+func (r *RedisLeaderboard) TopOn(board string, limit int) ([]LeaderboardEntry, error) {
+	return r.top(r.boardKey(board), limit)
+}
+
+func (r *RedisLeaderboard) Replace(board string, scores []repository.UserScore) error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+	ctx := context.Background()
+	key := r.boardKey(board)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(scores) == 0 {
+			return nil
+		}
+		members := make([]redis.Z, 0, len(scores))
+		for _, s := range scores {
+			members = append(members, redis.Z{Score: tieScore(s.Points, s.ReachedAt), Member: fmt.Sprint(s.ID)})
+		}
+		pipe.ZAdd(ctx, key, members...)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisLeaderboard) Clear(board string) error {
+	if r == nil || r.client == nil {
+		return nil
+	}
+	return r.client.Del(context.Background(), r.boardKey(board)).Err()
+}
+
+// assignRanks gives entries that follow each other in board order shared
+// ranks: equal points share the rank of the first of them, the next score
+// continues at its position ("1, 2, 2, 4"). first is the rank of the first
+// entry and position its 1-based position on the board.
+func assignRanks(entries []LeaderboardEntry, first, position int64) {
+	for i := range entries {
+		switch {
+		case i == 0:
+			entries[i].Rank = first
+		case entries[i].Points == entries[i-1].Points:
+			entries[i].Rank = entries[i-1].Rank
+		default:
+			entries[i].Rank = position + int64(i)
+		}
+	}
+}
+
 type MemoryLeaderboard struct {
 	mu     sync.RWMutex
-	scores map[uint]int64
+	scores *rankedScores
+	boards map[string]*rankedScores
 }
 
 func NewMemoryLeaderboard() *MemoryLeaderboard {
-	return &MemoryLeaderboard{scores: make(map[uint]int64)}
+	return &MemoryLeaderboard{scores: newRankedScores(), boards: make(map[string]*rankedScores)}
+}
+
+// boardMember is a user's score on a board and when it was reached.
+type boardMember struct {
+	userID    uint
+	points    int64
+	reachedAt time.Time
+}
+
+// before reports whether a ranks above b: more points first, then whoever
+// reached the score earlier, then the lower user ID.
+func (a boardMember) before(b boardMember) bool {
+	if a.points != b.points {
+		return a.points > b.points
+	}
+	if !a.reachedAt.Equal(b.reachedAt) {
+		return a.reachedAt.Before(b.reachedAt)
+	}
+	return a.userID < b.userID
+}
+
+// rankedScores keeps a board both by user and in rank order, so updates and
+// rank lookups take O(log n) instead of a sort of every user.
+type rankedScores struct {
+	members map[uint]boardMember
+	order   *skiplist
+}
+
+func newRankedScores() *rankedScores {
+	return &rankedScores{members: make(map[uint]boardMember), order: newSkiplist()}
+}
+
+// rankScores ranks scores, earliest to reach their points first.
+func rankScores(scores []repository.UserScore) *rankedScores {
+	ranked := newRankedScores()
+	for _, s := range scores {
+		ranked.set(s.ID, s.Points, s.ReachedAt)
+	}
+	return ranked
+}
+
+// set stores the user's points. Setting the points the user already has
+// keeps the time they were first reached.
+func (s *rankedScores) set(userID uint, points int64, at time.Time) {
+	if old, ok := s.members[userID]; ok {
+		if old.points == points {
+			return
+		}
+		s.remove(userID)
+	}
+	m := boardMember{userID: userID, points: points, reachedAt: at}
+	s.members[userID] = m
+	s.order.insert(m)
+}
+
+func (s *rankedScores) remove(userID uint) {
+	m, ok := s.members[userID]
+	if !ok {
+		return
+	}
+	delete(s.members, userID)
+	s.order.remove(m)
+}
+
+// index returns the 0-based position of the user.
+func (s *rankedScores) index(userID uint) (int, bool) {
+	m, ok := s.members[userID]
+	if !ok {
+		return 0, false
+	}
+	return s.order.count(func(other boardMember) bool { return !other.before(m) }), true
+}
+
+// sharedRank is the rank of every member with the given points.
+func (s *rankedScores) sharedRank(points int64) int64 {
+	return int64(s.order.count(func(other boardMember) bool { return other.points <= points })) + 1
+}
+
+// slice returns the entries from 0-based position start up to, not
+// including, end.
+func (s *rankedScores) slice(start, end int) []LeaderboardEntry {
+	if start < 0 {
+		start = 0
+	}
+	if end > s.order.length {
+		end = s.order.length
+	}
+	if start >= end {
+		return []LeaderboardEntry{}
+	}
+	entries := make([]LeaderboardEntry, end-start)
+	node := s.order.at(start)
+	for i := range entries {
+		entries[i] = LeaderboardEntry{UserID: node.member.userID, Points: node.member.points}
+		node = node.next[0].node
+	}
+	assignRanks(entries, s.sharedRank(entries[0].Points), int64(start+1))
+	return entries
+}
+
+// top returns the first limit entries, or all of them when limit is not
+// positive.
+func (s *rankedScores) top(limit int) []LeaderboardEntry {
+	end := s.order.length
+	if limit > 0 && limit < end {
+		end = limit
+	}
+	return s.slice(0, end)
 }
 
 func (m *MemoryLeaderboard) AddScore(userID uint, score int64) error {
+	return m.AddScoreAt(userID, score, time.Now())
+}
+
+func (m *MemoryLeaderboard) AddScoreAt(userID uint, score int64, at time.Time) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.scores[userID] = score
+	m.scores.set(userID, score, at)
 	return nil
 }
 
 func (m *MemoryLeaderboard) Top(limit int) ([]LeaderboardEntry, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	entries := make([]LeaderboardEntry, 0, len(m.scores))
-	for id, score := range m.scores {
-		entries = append(entries, LeaderboardEntry{UserID: id, Points: score})
+	return m.scores.top(limit), nil
+}
+
+func (m *MemoryLeaderboard) Rank(userID uint) (int64, int64, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	member, ok := m.scores.members[userID]
+	if !ok {
+		return 0, 0, false, nil
 	}
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Points > entries[j].Points
-	})
-	if limit > 0 && len(entries) > limit {
-		entries = entries[:limit]
+	return m.scores.sharedRank(member.points), member.points, true, nil
+}
+
+func (m *MemoryLeaderboard) Around(userID uint, n int) ([]LeaderboardEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i, ok := m.scores.index(userID)
+	if !ok {
+		return nil, nil
 	}
-	return entries, nil
+	return m.scores.slice(i-n, i+n+1), nil
+}
+
+func (m *MemoryLeaderboard) TopAmong(userIDs []uint, limit int) ([]LeaderboardEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	subset := newRankedScores()
+	for _, id := range userIDs {
+		if member, ok := m.scores.members[id]; ok {
+			subset.set(id, member.points, member.reachedAt)
+		}
+	}
+	return subset.top(limit), nil
+}
+
+func (m *MemoryLeaderboard) Scores() (map[uint]int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	scores := make(map[uint]int64, len(m.scores.members))
+	for id, member := range m.scores.members {
+		scores[id] = member.points
+	}
+	return scores, nil
+}
+
+// Members returns every member with its points and the time it reached them.
+func (m *MemoryLeaderboard) Members() ([]repository.UserScore, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	members := make([]repository.UserScore, 0, len(m.scores.members))
+	for _, member := range m.scores.members {
+		members = append(members, repository.UserScore{ID: member.userID, Points: member.points, ReachedAt: member.reachedAt})
+	}
+	return members, nil
+}
+
+func (m *MemoryLeaderboard) Remove(userID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scores.remove(userID)
+	return nil
+}
+
+func (m *MemoryLeaderboard) IncrBy(board string, userID uint, delta int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	scores, ok := m.boards[board]
+	if !ok {
+		scores = newRankedScores()
+		m.boards[board] = scores
+	}
+	scores.set(userID, scores.members[userID].points+delta, time.Now())
+	return nil
+}
+
+func (m *MemoryLeaderboard) TopOn(board string, limit int) ([]LeaderboardEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	scores, ok := m.boards[board]
+	if !ok {
+		return []LeaderboardEntry{}, nil
+	}
+	return scores.top(limit), nil
+}
+
+func (m *MemoryLeaderboard) Replace(board string, scores []repository.UserScore) error {
+	ranked := rankScores(scores)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.boards[board] = ranked
+	return nil
+}
+
+func (m *MemoryLeaderboard) Clear(board string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.boards, board)
+	return nil
+}
+
+// member returns the user's entry on the overall board.
+func (m *MemoryLeaderboard) member(userID uint) (boardMember, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	member, ok := m.scores.members[userID]
+	return member, ok
+}
+
+// boardScores returns every score on a named board, or false when the board
+// does not exist.
+func (m *MemoryLeaderboard) boardScores(board string) ([]repository.UserScore, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ranked, ok := m.boards[board]
+	if !ok {
+		return nil, false
+	}
+	scores := make([]repository.UserScore, 0, len(ranked.members))
+	for _, member := range ranked.members {
+		scores = append(scores, repository.UserScore{ID: member.userID, Points: member.points, ReachedAt: member.reachedAt})
+	}
+	return scores, true
+}
+
+// hydrateEntries fills in the public profile of every entry's user with a
+// single query. Entries of users that no longer exist are left as they are.
+func hydrateEntries(users *repository.UserRepository, entries []LeaderboardEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(entries))
+	for i, e := range entries {
+		ids[i] = e.UserID
+	}
+	found, err := users.FindByIDs(ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint]*models.User, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	for i := range entries {
+		if u, ok := byID[entries[i].UserID]; ok {
+			entries[i].Username = u.Username
+			entries[i].Level = u.Level
+			entries[i].AvatarURL = u.AvatarURL
+		}
+	}
+	return nil
 }
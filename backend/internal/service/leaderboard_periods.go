@@ -0,0 +1,217 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+// Windowed leaderboard periods. Weeks start on Monday and seasons are
+// calendar quarters; all boundaries are in UTC.
+const (
+	PeriodWeek   = "week"
+	PeriodMonth  = "month"
+	PeriodSeason = "season"
+)
+
+// archivedStandings is how many places of a closed period are archived.
+const archivedStandings = 100
+
+var leaderboardPeriods = []string{PeriodWeek, PeriodMonth, PeriodSeason}
+
+var ErrUnknownPeriod = errors.New("period must be one of week, month, season")
+
+// PeriodWindow is one concrete period, e.g. the week "2026-W42".
+type PeriodWindow struct {
+	Period string    `json:"period"`
+	Key    string    `json:"key"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// board names the period's board in the Leaderboard.
+func (w PeriodWindow) board() string {
+	return w.Period + ":" + w.Key
+}
+
+// periodWindow returns the window of the given period that contains t.
+func periodWindow(period string, t time.Time) (PeriodWindow, error) {
+	t = t.UTC()
+	y, m, d := t.Date()
+	w := PeriodWindow{Period: period}
+	switch period {
+	case PeriodWeek:
+		offset := (int(t.Weekday()) + 6) % 7
+		w.Start = time.Date(y, m, d-offset, 0, 0, 0, 0, time.UTC)
+		w.End = w.Start.AddDate(0, 0, 7)
+		year, week := w.Start.ISOWeek()
+		w.Key = fmt.Sprintf("%d-W%02d", year, week)
+	case PeriodMonth:
+		w.Start = time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+		w.End = w.Start.AddDate(0, 1, 0)
+		w.Key = fmt.Sprintf("%d-%02d", y, int(m))
+	case PeriodSeason:
+		quarter := (int(m) - 1) / 3
+		w.Start = time.Date(y, time.Month(quarter*3+1), 1, 0, 0, 0, 0, time.UTC)
+		w.End = w.Start.AddDate(0, 3, 0)
+		w.Key = fmt.Sprintf("%d-Q%d", y, quarter+1)
+	default:
+		return w, ErrUnknownPeriod
+	}
+	return w, nil
+}
+
+// recordEarned adds points a user just earned to every current windowed
+// board.
+func recordEarned(lb Leaderboard, userID uint, delta int64, at time.Time) error {
+	if lb == nil || delta == 0 {
+		return nil
+	}
+	for _, period := range leaderboardPeriods {
+		w, _ := periodWindow(period, at)
+		if err := lb.IncrBy(w.board(), userID, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PeriodLeaderboardService serves the windowed leaderboards and archives the
+// final standings of every period once it has ended.
+type PeriodLeaderboardService struct {
+	users       *repository.UserRepository
+	standings   *repository.LeaderboardRepository
+	leaderboard Leaderboard
+
+	mu sync.Mutex
+	// rolled remembers the last window rolled over per period, so periods
+	// without any earners are not recomputed on every tick.
+	rolled map[string]string
+}
+
+// PeriodStandings is a period's board, live or archived.
+type PeriodStandings struct {
+	PeriodWindow
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+func NewPeriodLeaderboardService(users *repository.UserRepository, standings *repository.LeaderboardRepository, lb Leaderboard) *PeriodLeaderboardService {
+	return &PeriodLeaderboardService{users: users, standings: standings, leaderboard: lb, rolled: make(map[string]string)}
+}
+
+// Top returns the current board of the period.
+func (s *PeriodLeaderboardService) Top(period string, limit int) (*PeriodStandings, error) {
+	w, err := periodWindow(period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	entries, err := s.leaderboard.TopOn(w.board(), limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := hydrateEntries(s.users, entries); err != nil {
+		return nil, err
+	}
+	return &PeriodStandings{PeriodWindow: w, Entries: entries}, nil
+}
+
+// Archived returns the final standings of a past period. An empty key selects
+// the period that ended most recently.
+func (s *PeriodLeaderboardService) Archived(period, key string, limit int) ([]models.LeaderboardStanding, error) {
+	if _, err := periodWindow(period, time.Now()); err != nil {
+		return nil, err
+	}
+	if key == "" {
+		current, _ := periodWindow(period, time.Now())
+		previous, _ := periodWindow(period, current.Start.Add(-time.Nanosecond))
+		key = previous.Key
+	}
+	if limit <= 0 || limit > archivedStandings {
+		limit = archivedStandings
+	}
+	return s.standings.Standings(period, key, limit)
+}
+
+// Rebuild recomputes the current windowed boards from the points history.
+func (s *PeriodLeaderboardService) Rebuild(now time.Time) error {
+	for _, period := range leaderboardPeriods {
+		w, _ := periodWindow(period, now)
+		earned, err := s.users.EarnedBetween(w.Start, w.End)
+		if err != nil {
+			return err
+		}
+		if err := s.leaderboard.Replace(w.board(), earned); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollover archives the final standings of the previous window of every
+// period, computed from the points history, and drops its live board. Periods
+// that were already archived are skipped, so it is safe to call repeatedly.
+func (s *PeriodLeaderboardService) Rollover(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, period := range leaderboardPeriods {
+		current, _ := periodWindow(period, now)
+		previous, _ := periodWindow(period, current.Start.Add(-time.Nanosecond))
+		if s.rolled[period] == previous.Key {
+			continue
+		}
+		archived, err := s.standings.Archived(period, previous.Key)
+		if err != nil {
+			return err
+		}
+		if archived {
+			s.rolled[period] = previous.Key
+			continue
+		}
+
+		earned, err := s.users.EarnedBetween(previous.Start, previous.End)
+		if err != nil {
+			return err
+		}
+		ranked := rankScores(earned).top(archivedStandings)
+		standings := make([]models.LeaderboardStanding, len(ranked))
+		for i, entry := range ranked {
+			standings[i] = models.LeaderboardStanding{
+				Period:    period,
+				PeriodKey: previous.Key,
+				Rank:      int(entry.Rank),
+				UserID:    entry.UserID,
+				Points:    entry.Points,
+			}
+		}
+		if err := s.standings.Archive(standings); err != nil {
+			return err
+		}
+		if err := s.leaderboard.Clear(previous.board()); err != nil {
+			return err
+		}
+		if len(standings) > 0 {
+			log.Printf("archived %s leaderboard %s with %d entries", period, previous.Key, len(standings))
+		}
+		s.rolled[period] = previous.Key
+	}
+	return nil
+}
+
+// Run rolls the windowed boards over every interval.
+func (s *PeriodLeaderboardService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := s.Rollover(now); err != nil {
+			log.Printf("leaderboard rollover failed: %v", err)
+		}
+	}
+}
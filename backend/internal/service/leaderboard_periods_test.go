@@ -0,0 +1,168 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestPeriodWindow(t *testing.T) {
+	at := time.Date(2026, 10, 18, 23, 30, 0, 0, time.UTC) // a Sunday
+	cases := []struct {
+		period string
+		key    string
+		start  time.Time
+		end    time.Time
+	}{
+		{PeriodWeek, "2026-W42", time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{PeriodMonth, "2026-10", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{PeriodSeason, "2026-Q4", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		w, err := periodWindow(tc.period, at)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.period, err)
+		}
+		if w.Key != tc.key || !w.Start.Equal(tc.start) || !w.End.Equal(tc.end) {
+			t.Fatalf("%s: unexpected window %+v", tc.period, w)
+		}
+	}
+
+	// ISO weeks belong to the year of their Thursday.
+	if w, _ := periodWindow(PeriodWeek, time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC)); w.Key != "2026-W53" {
+		t.Fatalf("expected 2026-W53, got %s", w.Key)
+	}
+	if _, err := periodWindow("decade", at); err != ErrUnknownPeriod {
+		t.Fatalf("expected ErrUnknownPeriod, got %v", err)
+	}
+}
+
+func TestRecordEarnedFillsCurrentBoards(t *testing.T) {
+	lb := NewMemoryLeaderboard()
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	recordEarned(lb, 1, 30, at)
+	recordEarned(lb, 2, 50, at)
+	recordEarned(lb, 1, 40, at)
+	recordEarned(lb, 1, 500, at.AddDate(0, 0, 1))
+
+	week, _ := lb.TopOn("week:2026-W42", 10)
+	if len(week) != 2 || week[0].UserID != 1 || week[0].Points != 70 || week[1].Points != 50 {
+		t.Fatalf("unexpected weekly board: %+v", week)
+	}
+	month, _ := lb.TopOn("month:2026-10", 10)
+	if len(month) != 2 || month[0].Points != 570 {
+		t.Fatalf("unexpected monthly board: %+v", month)
+	}
+}
+
+func TestPeriodRolloverArchivesStandings(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	lb := NewMemoryLeaderboard()
+	periods := NewPeriodLeaderboardService(userRepo, repository.NewLeaderboardRepository(db), lb)
+
+	first := &models.User{Username: "weekly_first", Email: "weekly_first@example.com", Password: "secret"}
+	second := &models.User{Username: "weekly_second", Email: "weekly_second@example.com", Password: "secret"}
+	for _, u := range []*models.User{first, second} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	// ISO week 2031-W01 starts on 2030-12-30, so the points earned on
+	// 2 January count for it but not for 2030-Q4. "now" is in 2031-W02.
+	lastWeek := time.Date(2031, 1, 2, 10, 0, 0, 0, time.UTC)
+	now := time.Date(2031, 1, 8, 10, 0, 0, 0, time.UTC)
+	history := []models.PointsHistory{
+		{CreatedAt: lastWeek, UserID: first.ID, Delta: 80, Reason: "activity"},
+		{CreatedAt: lastWeek, UserID: second.ID, Delta: 120, Reason: "activity"},
+		{CreatedAt: lastWeek, UserID: second.ID, Delta: -500, Reason: "redeem"},
+		{CreatedAt: lastWeek, UserID: first.ID, Delta: 60, Reason: "streak_bonus"},
+		{CreatedAt: now, UserID: first.ID, Delta: 25, Reason: "activity"},
+	}
+	if err := db.Create(&history).Error; err != nil {
+		t.Fatalf("failed to seed history: %v", err)
+	}
+	recordEarned(lb, first.ID, 140, lastWeek)
+
+	if err := periods.Rollover(now); err != nil {
+		t.Fatalf("rollover failed: %v", err)
+	}
+	standings, err := periods.Archived(PeriodWeek, "2031-W01", 0)
+	if err != nil {
+		t.Fatalf("failed to load standings: %v", err)
+	}
+	if len(standings) != 2 || standings[0].UserID != first.ID || standings[0].Points != 140 || standings[0].Rank != 1 ||
+		standings[1].UserID != second.ID || standings[1].Points != 120 {
+		t.Fatalf("unexpected standings: %+v", standings)
+	}
+	if entries, _ := lb.TopOn("week:2031-W01", 10); len(entries) != 0 {
+		t.Fatalf("expected the closed board to be cleared, got %+v", entries)
+	}
+	if season, _ := periods.Archived(PeriodSeason, "2030-Q4", 0); len(season) != 0 {
+		t.Fatalf("expected no earners in 2030-Q4, got %+v", season)
+	}
+
+	// A second rollover must not archive the week again.
+	if err := NewPeriodLeaderboardService(userRepo, repository.NewLeaderboardRepository(db), lb).Rollover(now); err != nil {
+		t.Fatalf("second rollover failed: %v", err)
+	}
+	if again, _ := periods.Archived(PeriodWeek, "2031-W01", 0); len(again) != 2 {
+		t.Fatalf("expected standings to be archived once, got %+v", again)
+	}
+
+	if err := periods.Rebuild(now); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	current, _ := lb.TopOn("week:2031-W02", 10)
+	if len(current) != 1 || current[0].UserID != first.ID || current[0].Points != 25 {
+		t.Fatalf("unexpected rebuilt board: %+v", current)
+	}
+}
+
+func TestPeriodBoardsKeepTieBreak(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	lb := NewMemoryLeaderboard()
+	periods := NewPeriodLeaderboardService(userRepo, repository.NewLeaderboardRepository(db), lb)
+
+	late := &models.User{Username: "tie_late", Email: "tie_late@example.com", Password: "secret"}
+	early := &models.User{Username: "tie_early", Email: "tie_early@example.com", Password: "secret"}
+	for _, u := range []*models.User{late, early} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	// Both earn 100 points in 2032-W03; early gets there a day sooner.
+	monday := time.Date(2032, 1, 12, 9, 0, 0, 0, time.UTC)
+	history := []models.PointsHistory{
+		{CreatedAt: monday, UserID: late.ID, Delta: 40, Reason: "activity"},
+		{CreatedAt: monday, UserID: early.ID, Delta: 100, Reason: "activity"},
+		{CreatedAt: monday.AddDate(0, 0, 1), UserID: late.ID, Delta: 60, Reason: "activity"},
+	}
+	if err := db.Create(&history).Error; err != nil {
+		t.Fatalf("failed to seed history: %v", err)
+	}
+
+	if err := periods.Rebuild(monday.AddDate(0, 0, 2)); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	board, _ := lb.TopOn("week:2032-W03", 10)
+	if len(board) != 2 || board[0].UserID != early.ID || board[1].UserID != late.ID || board[1].Rank != 1 {
+		t.Fatalf("expected the earlier user first with a shared rank, got %+v", board)
+	}
+
+	if err := periods.Rollover(monday.AddDate(0, 0, 7)); err != nil {
+		t.Fatalf("rollover failed: %v", err)
+	}
+	standings, err := periods.Archived(PeriodWeek, "2032-W03", 0)
+	if err != nil {
+		t.Fatalf("failed to load standings: %v", err)
+	}
+	if len(standings) != 2 || standings[0].UserID != early.ID || standings[1].UserID != late.ID {
+		t.Fatalf("expected the archive to keep the tie-break, got %+v", standings)
+	}
+}
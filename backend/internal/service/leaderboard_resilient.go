@@ -0,0 +1,457 @@
+package service
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+// Circuit breaker states of a ResilientLeaderboard.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// pinger is implemented by leaderboards that can check their connection.
+type pinger interface {
+	Ping() error
+}
+
+// ResilientLeaderboard puts a circuit breaker in front of a remote
+// leaderboard such as Redis. Every write is mirrored to an in-memory board.
+// After too many consecutive errors the breaker opens: reads are served from
+// the mirror and the users and boards the primary missed are queued. Once the
+// primary answers a ping again they are copied from the mirror and the
+// breaker closes.
+//
+// Writes themselves are never replayed: an increment that timed out may
+// still have reached the primary, and a queued write could overwrite a newer
+// one. Copying the mirror's current value is safe to repeat either way.
+type ResilientLeaderboard struct {
+	primary  Leaderboard
+	fallback *MemoryLeaderboard
+
+	threshold int
+	cooldown  time.Duration
+	maxQueue  int
+
+	mu          sync.Mutex
+	state       string
+	failures    int
+	openedAt    time.Time
+	lastError   string
+	lastFailure time.Time
+	queue       []staleEntry
+	queued      map[staleEntry]bool
+	replaying   bool
+	dropped     int64
+	onReplay    []func()
+}
+
+// leaderboardOp is a write applied to the mirror and the primary.
+type leaderboardOp func(Leaderboard) error
+
+// staleEntry is what a missed write left out of date on the primary: a
+// user's score on the overall board, or a whole named board.
+type staleEntry struct {
+	board  string
+	userID uint
+}
+
+// LeaderboardHealth reports which board serves requests and the breaker
+// state.
+type LeaderboardHealth struct {
+	Backend        string     `json:"backend"`
+	State          string     `json:"state"`
+	Failures       int        `json:"consecutive_failures"`
+	QueuedUpdates  int        `json:"queued_updates"`
+	DroppedUpdates int64      `json:"dropped_updates"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastFailureAt  *time.Time `json:"last_failure_at,omitempty"`
+	OpenedAt       *time.Time `json:"opened_at,omitempty"`
+}
+
+// Degraded reports whether requests are served from the fallback.
+func (h LeaderboardHealth) Degraded() bool {
+	return h.State != BreakerClosed
+}
+
+// NewResilientLeaderboard wraps primary. When primary can be pinged and the
+// ping fails, the board starts with the breaker open.
+func NewResilientLeaderboard(primary Leaderboard, cfg config.Config) *ResilientLeaderboard {
+	r := &ResilientLeaderboard{
+		primary:   primary,
+		fallback:  NewMemoryLeaderboard(),
+		threshold: cfg.LeaderboardBreakerFailures,
+		cooldown:  cfg.LeaderboardBreakerCooldown,
+		maxQueue:  cfg.LeaderboardReplayQueue,
+		state:     BreakerClosed,
+		queued:    make(map[staleEntry]bool),
+	}
+	if r.threshold <= 0 {
+		r.threshold = 1
+	}
+	if p, ok := primary.(pinger); ok {
+		if err := p.Ping(); err != nil {
+			r.mu.Lock()
+			r.recordFailure(err)
+			r.open()
+			r.mu.Unlock()
+		}
+	}
+	return r
+}
+
+// Health returns the current state. A nil board is the plain in-memory
+// leaderboard.
+func (r *ResilientLeaderboard) Health() LeaderboardHealth {
+	if r == nil {
+		return LeaderboardHealth{Backend: "memory", State: BreakerClosed}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := LeaderboardHealth{
+		Backend:        "redis",
+		State:          r.state,
+		Failures:       r.failures,
+		QueuedUpdates:  len(r.queue),
+		DroppedUpdates: r.dropped,
+		LastError:      r.lastError,
+	}
+	if r.state != BreakerClosed {
+		h.Backend = "memory"
+		openedAt := r.openedAt
+		h.OpenedAt = &openedAt
+	}
+	if !r.lastFailure.IsZero() {
+		lastFailure := r.lastFailure
+		h.LastFailureAt = &lastFailure
+	}
+	return h
+}
+
+// recordFailure counts an error of the primary; the caller holds mu.
+func (r *ResilientLeaderboard) recordFailure(err error) {
+	r.failures++
+	r.lastError = err.Error()
+	r.lastFailure = time.Now()
+	if r.state == BreakerClosed && r.failures >= r.threshold {
+		r.open()
+	}
+}
+
+// open trips the breaker; the caller holds mu.
+func (r *ResilientLeaderboard) open() {
+	if r.state != BreakerOpen {
+		log.Printf("leaderboard circuit opened, serving the in-memory fallback: %s", r.lastError)
+	}
+	r.state = BreakerOpen
+	r.openedAt = time.Now()
+}
+
+// OnReplay registers fn to run after missed updates were copied to the
+// primary, since those changes bypass the wrappers around this board.
+func (r *ResilientLeaderboard) OnReplay(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onReplay = append(r.onReplay, fn)
+}
+
+// enqueue marks entry as stale on the primary, dropping the oldest entry when
+// the queue is full; the caller holds mu.
+func (r *ResilientLeaderboard) enqueue(entry staleEntry) {
+	if r.queued[entry] {
+		return
+	}
+	if r.maxQueue > 0 && len(r.queue) >= r.maxQueue {
+		delete(r.queued, r.queue[0])
+		r.queue = r.queue[1:]
+		r.dropped++
+	}
+	r.queue = append(r.queue, entry)
+	r.queued[entry] = true
+}
+
+// write applies op to the mirror and, unless the breaker is open or missed
+// updates are still waiting, to the primary. When the primary is skipped or
+// fails, entry is queued to be copied from the mirror later, so callers
+// never see an outage.
+func (r *ResilientLeaderboard) write(entry staleEntry, op leaderboardOp) error {
+	_ = op(r.fallback)
+
+	r.mu.Lock()
+	if r.state != BreakerClosed || len(r.queue) > 0 || r.replaying {
+		r.enqueue(entry)
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
+
+	err := op(r.primary)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.recordFailure(err)
+		r.enqueue(entry)
+		return nil
+	}
+	r.failures = 0
+	return nil
+}
+
+// replay copies entry from the mirror to the primary.
+func (r *ResilientLeaderboard) replay(entry staleEntry) error {
+	if entry.board == "" {
+		member, ok := r.fallback.member(entry.userID)
+		if !ok {
+			return r.primary.Remove(entry.userID)
+		}
+		return r.primary.AddScoreAt(member.userID, member.points, member.reachedAt)
+	}
+	scores, ok := r.fallback.boardScores(entry.board)
+	if !ok {
+		return r.primary.Clear(entry.board)
+	}
+	return r.primary.Replace(entry.board, scores)
+}
+
+// useFallback reports whether reads skip the primary.
+func (r *ResilientLeaderboard) useFallback() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state != BreakerClosed
+}
+
+// readFailed records err and reports whether the read should be retried on
+// the fallback.
+func (r *ResilientLeaderboard) readFailed(err error) bool {
+	if err == nil {
+		r.mu.Lock()
+		r.failures = 0
+		r.mu.Unlock()
+		return false
+	}
+	r.mu.Lock()
+	r.recordFailure(err)
+	r.mu.Unlock()
+	return true
+}
+
+// Probe checks whether an open breaker can close: once the cooldown has
+// passed the primary is pinged and the queued entries are copied from the
+// mirror. It also drains entries left behind by single failures while
+// closed.
+func (r *ResilientLeaderboard) Probe() {
+	r.mu.Lock()
+	switch {
+	case r.replaying:
+		r.mu.Unlock()
+		return
+	case r.state == BreakerOpen && time.Since(r.openedAt) >= r.cooldown:
+		r.state = BreakerHalfOpen
+	case r.state == BreakerClosed && len(r.queue) > 0:
+	default:
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+
+	if p, ok := r.primary.(pinger); ok {
+		if err := p.Ping(); err != nil {
+			r.mu.Lock()
+			r.recordFailure(err)
+			r.open()
+			r.mu.Unlock()
+			return
+		}
+	}
+
+	// Writes arriving while replaying are queued behind the entries being
+	// copied, so the primary never receives them out of order.
+	r.mu.Lock()
+	r.replaying = true
+	r.mu.Unlock()
+
+	replayed := 0
+	defer func() {
+		if replayed == 0 {
+			return
+		}
+		r.mu.Lock()
+		hooks := r.onReplay
+		r.mu.Unlock()
+		for _, fn := range hooks {
+			fn()
+		}
+	}()
+	for {
+		r.mu.Lock()
+		if len(r.queue) == 0 {
+			if r.state != BreakerClosed {
+				log.Printf("leaderboard circuit closed after replaying %d updates", replayed)
+			}
+			if r.dropped > 0 {
+				log.Printf("leaderboard dropped %d updates while unavailable; the next consistency check repairs them", r.dropped)
+				r.dropped = 0
+			}
+			r.state = BreakerClosed
+			r.failures = 0
+			r.replaying = false
+			r.mu.Unlock()
+			return
+		}
+		entry := r.queue[0]
+		r.queue = r.queue[1:]
+		delete(r.queued, entry)
+		r.mu.Unlock()
+
+		if err := r.replay(entry); err != nil {
+			r.mu.Lock()
+			if !r.queued[entry] {
+				r.queue = append([]staleEntry{entry}, r.queue...)
+				r.queued[entry] = true
+			}
+			r.replaying = false
+			r.recordFailure(err)
+			r.open()
+			r.mu.Unlock()
+			return
+		}
+		replayed++
+	}
+}
+
+// Run probes the primary every interval.
+func (r *ResilientLeaderboard) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.Probe()
+	}
+}
+
+func (r *ResilientLeaderboard) AddScore(userID uint, score int64) error {
+	return r.AddScoreAt(userID, score, time.Now())
+}
+
+func (r *ResilientLeaderboard) AddScoreAt(userID uint, score int64, at time.Time) error {
+	return r.write(staleEntry{userID: userID}, func(lb Leaderboard) error { return lb.AddScoreAt(userID, score, at) })
+}
+
+func (r *ResilientLeaderboard) Remove(userID uint) error {
+	return r.write(staleEntry{userID: userID}, func(lb Leaderboard) error { return lb.Remove(userID) })
+}
+
+func (r *ResilientLeaderboard) IncrBy(board string, userID uint, delta int64) error {
+	return r.write(staleEntry{board: board}, func(lb Leaderboard) error { return lb.IncrBy(board, userID, delta) })
+}
+
+func (r *ResilientLeaderboard) Replace(board string, scores []repository.UserScore) error {
+	return r.write(staleEntry{board: board}, func(lb Leaderboard) error { return lb.Replace(board, scores) })
+}
+
+func (r *ResilientLeaderboard) Clear(board string) error {
+	return r.write(staleEntry{board: board}, func(lb Leaderboard) error { return lb.Clear(board) })
+}
+
+func (r *ResilientLeaderboard) Top(limit int) ([]LeaderboardEntry, error) {
+	if !r.useFallback() {
+		entries, err := r.primary.Top(limit)
+		if !r.readFailed(err) {
+			return entries, nil
+		}
+	}
+	return r.fallback.Top(limit)
+}
+
+func (r *ResilientLeaderboard) TopOn(board string, limit int) ([]LeaderboardEntry, error) {
+	if !r.useFallback() {
+		entries, err := r.primary.TopOn(board, limit)
+		if !r.readFailed(err) {
+			return entries, nil
+		}
+	}
+	return r.fallback.TopOn(board, limit)
+}
+
+func (r *ResilientLeaderboard) Rank(userID uint) (int64, int64, bool, error) {
+	if !r.useFallback() {
+		rank, score, ok, err := r.primary.Rank(userID)
+		if !r.readFailed(err) {
+			return rank, score, ok, nil
+		}
+	}
+	return r.fallback.Rank(userID)
+}
+
+func (r *ResilientLeaderboard) Around(userID uint, n int) ([]LeaderboardEntry, error) {
+	if !r.useFallback() {
+		entries, err := r.primary.Around(userID, n)
+		if !r.readFailed(err) {
+			return entries, nil
+		}
+	}
+	return r.fallback.Around(userID, n)
+}
+
+func (r *ResilientLeaderboard) TopAmong(userIDs []uint, limit int) ([]LeaderboardEntry, error) {
+	if !r.useFallback() {
+		entries, err := r.primary.TopAmong(userIDs, limit)
+		if !r.readFailed(err) {
+			return entries, nil
+		}
+	}
+	return r.fallback.TopAmong(userIDs, limit)
+}
+
+// memberLister is implemented by boards that can list when each member
+// reached its points.
+type memberLister interface {
+	Members() ([]repository.UserScore, error)
+}
+
+// Scores returns the scores of the board serving reads. Reading them from
+// the primary also brings the mirror in line, reached times included, so a
+// freshly started mirror is warm after the first consistency check and
+// breaks ties like the primary.
+func (r *ResilientLeaderboard) Scores() (map[uint]int64, error) {
+	if !r.useFallback() {
+		if lister, ok := r.primary.(memberLister); ok {
+			members, err := lister.Members()
+			if !r.readFailed(err) {
+				r.syncFallback(members)
+				scores := make(map[uint]int64, len(members))
+				for _, m := range members {
+					scores[m.ID] = m.Points
+				}
+				return scores, nil
+			}
+		} else {
+			scores, err := r.primary.Scores()
+			if !r.readFailed(err) {
+				return scores, nil
+			}
+		}
+	}
+	return r.fallback.Scores()
+}
+
+func (r *ResilientLeaderboard) syncFallback(members []repository.UserScore) {
+	mirrored, _ := r.fallback.Scores()
+	listed := make(map[uint]bool, len(members))
+	for _, m := range members {
+		listed[m.ID] = true
+		if current, ok := mirrored[m.ID]; !ok || current != m.Points {
+			_ = r.fallback.AddScoreAt(m.ID, m.Points, m.ReachedAt)
+		}
+	}
+	for id := range mirrored {
+		if !listed[id] {
+			_ = r.fallback.Remove(id)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+)
+
+// flakyLeaderboard stands in for Redis: an in-memory board that fails every
+// call while it is down.
+type flakyLeaderboard struct {
+	*MemoryLeaderboard
+	mu   sync.Mutex
+	down bool
+	// lostAck applies board increments but still reports an error, like a
+	// timeout after Redis ran the command.
+	lostAck bool
+}
+
+var errLeaderboardDown = errors.New("connection refused")
+
+func newFlakyLeaderboard() *flakyLeaderboard {
+	return &flakyLeaderboard{MemoryLeaderboard: NewMemoryLeaderboard()}
+}
+
+func (f *flakyLeaderboard) setDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *flakyLeaderboard) err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return errLeaderboardDown
+	}
+	return nil
+}
+
+func (f *flakyLeaderboard) Ping() error { return f.err() }
+
+func (f *flakyLeaderboard) AddScoreAt(userID uint, score int64, at time.Time) error {
+	if err := f.err(); err != nil {
+		return err
+	}
+	return f.MemoryLeaderboard.AddScoreAt(userID, score, at)
+}
+
+func (f *flakyLeaderboard) IncrBy(board string, userID uint, delta int64) error {
+	if err := f.err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	lostAck := f.lostAck
+	f.mu.Unlock()
+	if err := f.MemoryLeaderboard.IncrBy(board, userID, delta); err != nil || !lostAck {
+		return err
+	}
+	return errLeaderboardDown
+}
+
+func (f *flakyLeaderboard) Top(limit int) ([]LeaderboardEntry, error) {
+	if err := f.err(); err != nil {
+		return nil, err
+	}
+	return f.MemoryLeaderboard.Top(limit)
+}
+
+func TestResilientLeaderboardFallsBackAndReplays(t *testing.T) {
+	primary := newFlakyLeaderboard()
+	lb := NewResilientLeaderboard(primary, config.Config{LeaderboardBreakerFailures: 2, LeaderboardReplayQueue: 100})
+
+	lb.AddScore(1, 100)
+	primary.setDown(true)
+	if err := lb.AddScore(2, 50); err != nil {
+		t.Fatalf("outage should not surface to callers: %v", err)
+	}
+	if h := lb.Health(); h.State != BreakerClosed || h.QueuedUpdates != 1 {
+		t.Fatalf("one failure should not open the breaker: %+v", h)
+	}
+
+	// The failing read is the second consecutive error and is answered from
+	// the mirror.
+	top, err := lb.Top(10)
+	if err != nil || len(top) != 2 || top[0].UserID != 1 || top[1].UserID != 2 {
+		t.Fatalf("expected the fallback board, got %+v (%v)", top, err)
+	}
+	h := lb.Health()
+	if h.State != BreakerOpen || h.Backend != "memory" || !h.Degraded() || h.LastError != errLeaderboardDown.Error() {
+		t.Fatalf("expected an open breaker, got %+v", h)
+	}
+
+	lb.AddScore(1, 150)
+	lb.IncrBy("week:2026-W42", 1, 50)
+	lb.Probe()
+	if h := lb.Health(); h.State != BreakerOpen || h.QueuedUpdates != 3 {
+		t.Fatalf("probe against a down primary should keep the breaker open: %+v", h)
+	}
+
+	primary.setDown(false)
+	lb.Probe()
+	if h := lb.Health(); h.State != BreakerClosed || h.Backend != "redis" || h.QueuedUpdates != 0 {
+		t.Fatalf("expected the breaker to close after replay: %+v", h)
+	}
+	scores, _ := primary.Scores()
+	if scores[1] != 150 || scores[2] != 50 {
+		t.Fatalf("missed updates were not replayed: %v", scores)
+	}
+	if week, _ := primary.TopOn("week:2026-W42", 10); len(week) != 1 || week[0].Points != 50 {
+		t.Fatalf("missed board update was not replayed: %+v", week)
+	}
+}
+
+func TestResilientLeaderboardStartsOpenAndBoundsQueue(t *testing.T) {
+	primary := newFlakyLeaderboard()
+	primary.setDown(true)
+	lb := NewResilientLeaderboard(primary, config.Config{LeaderboardBreakerFailures: 3, LeaderboardBreakerCooldown: time.Hour, LeaderboardReplayQueue: 2})
+	if h := lb.Health(); h.State != BreakerOpen {
+		t.Fatalf("a failed startup ping should open the breaker: %+v", h)
+	}
+
+	for id := uint(1); id <= 3; id++ {
+		lb.AddScore(id, int64(id))
+	}
+	if h := lb.Health(); h.QueuedUpdates != 2 || h.DroppedUpdates != 1 {
+		t.Fatalf("expected the oldest update to be dropped: %+v", h)
+	}
+	if rank, _, ok, _ := lb.Rank(1); !ok || rank != 3 {
+		t.Fatalf("the fallback should hold every update, got rank %d", rank)
+	}
+
+	// The primary is not retried before the cooldown has passed.
+	primary.setDown(false)
+	lb.Probe()
+	if h := lb.Health(); h.State != BreakerOpen {
+		t.Fatalf("expected the breaker to stay open during the cooldown: %+v", h)
+	}
+	if (*ResilientLeaderboard)(nil).Health().Backend != "memory" {
+		t.Fatalf("a nil resilient board reports the in-memory backend")
+	}
+}
+
+func TestResilientLeaderboardReplaysCurrentValues(t *testing.T) {
+	primary := newFlakyLeaderboard()
+	lb := NewResilientLeaderboard(primary, config.Config{LeaderboardBreakerFailures: 5, LeaderboardReplayQueue: 100})
+	stream := NewLeaderboardStream(lb, nil, config.Config{})
+
+	// An increment that reached the primary but timed out is not counted
+	// twice on replay.
+	primary.lostAck = true
+	lb.IncrBy("week:2026-W43", 1, 30)
+	primary.lostAck = false
+	if h := lb.Health(); h.QueuedUpdates != 1 {
+		t.Fatalf("expected the board to be queued: %+v", h)
+	}
+
+	// A score overwritten during the outage is replayed with its last value.
+	primary.setDown(true)
+	lb.AddScore(2, 80)
+	lb.AddScore(2, 40)
+	lb.Remove(3)
+	primary.setDown(false)
+	select {
+	case <-stream.dirty:
+	default:
+	}
+
+	lb.Probe()
+	if week, _ := primary.TopOn("week:2026-W43", 10); len(week) != 1 || week[0].Points != 30 {
+		t.Fatalf("expected the increment once, got %+v", week)
+	}
+	if scores, _ := primary.Scores(); scores[2] != 40 {
+		t.Fatalf("expected the newest score, got %v", scores)
+	}
+	if h := lb.Health(); h.QueuedUpdates != 0 || h.State != BreakerClosed {
+		t.Fatalf("expected the queue to drain: %+v", h)
+	}
+	select {
+	case <-stream.dirty:
+	default:
+		t.Fatalf("the stream was not told about the replayed updates")
+	}
+}
+
+func TestResilientLeaderboardMirrorsReachedTimes(t *testing.T) {
+	primary := newFlakyLeaderboard()
+	lb := NewResilientLeaderboard(primary, config.Config{LeaderboardBreakerFailures: 1, LeaderboardBreakerCooldown: time.Hour})
+
+	// Written before this instance started, so only the primary has them;
+	// user 2 reached the score first.
+	start := time.Unix(1700000000, 0)
+	primary.MemoryLeaderboard.AddScoreAt(1, 100, start.Add(time.Hour))
+	primary.MemoryLeaderboard.AddScoreAt(2, 100, start)
+	if _, err := lb.Scores(); err != nil {
+		t.Fatalf("scores failed: %v", err)
+	}
+
+	primary.setDown(true)
+	top, err := lb.Top(2)
+	if err != nil || len(top) != 2 || top[0].UserID != 2 || top[1].UserID != 1 {
+		t.Fatalf("expected the mirror to break ties like the primary, got %+v (%v)", top, err)
+	}
+	if h := lb.Health(); h.Backend != "memory" {
+		t.Fatalf("expected the mirror to serve reads: %+v", h)
+	}
+
+	if at := reachedAtOf(tieScore(100, start)); !at.Equal(start) {
+		t.Fatalf("expected the reached time to survive a Redis score, got %v", at)
+	}
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+// Leaderboard stream event types. A snapshot carries the current top of the
+// board; an update also lists the rank changes since the previous event.
+const (
+	LeaderboardSnapshot = "snapshot"
+	LeaderboardUpdate   = "update"
+)
+
+// streamBacklog is how many events are kept for Last-Event-ID resumption.
+const streamBacklog = 100
+
+var ErrStreamFull = errors.New("too many leaderboard stream subscribers, retry later")
+
+// LeaderboardEvent is one message of the live leaderboard stream. IDs are
+// "<epoch>-<sequence>": the epoch changes whenever the server starts, so an
+// ID from before a restart is never mistaken for a current one.
+type LeaderboardEvent struct {
+	ID      string `json:"id"`
+	seq     uint64
+	Type    string             `json:"type"`
+	At      time.Time          `json:"at"`
+	Entries []LeaderboardEntry `json:"entries"`
+	Changes []RankChange       `json:"changes,omitempty"`
+}
+
+// RankChange is a user whose place in the streamed top changed. Rank is 0
+// when the user dropped out of it and PreviousRank is 0 when they entered.
+type RankChange struct {
+	UserID       uint   `json:"user_id"`
+	Username     string `json:"username,omitempty"`
+	Points       int64  `json:"points"`
+	Rank         int64  `json:"rank"`
+	PreviousRank int64  `json:"previous_rank"`
+}
+
+// LeaderboardStream wraps a Leaderboard and publishes the top of the overall
+// board to subscribers whenever a score change alters it. Changes are
+// coalesced: at most one event is computed per interval, however many
+// scores changed in it.
+type LeaderboardStream struct {
+	Leaderboard
+	users          *repository.UserRepository
+	size           int
+	interval       time.Duration
+	epoch          string
+	maxSubscribers int
+
+	dirty chan struct{}
+
+	mu          sync.Mutex
+	top         []LeaderboardEntry
+	lastID      uint64
+	backlog     []LeaderboardEvent
+	subscribers map[chan LeaderboardEvent]struct{}
+}
+
+func NewLeaderboardStream(lb Leaderboard, users *repository.UserRepository, cfg config.Config) *LeaderboardStream {
+	size := cfg.LeaderboardStreamSize
+	if size <= 0 {
+		size = 10
+	}
+	s := &LeaderboardStream{
+		Leaderboard:    lb,
+		users:          users,
+		size:           size,
+		interval:       cfg.LeaderboardStreamInterval,
+		epoch:          strconv.FormatInt(time.Now().UnixNano(), 36),
+		maxSubscribers: cfg.LeaderboardStreamMaxSubscribers,
+		dirty:          make(chan struct{}, 1),
+		subscribers:    make(map[chan LeaderboardEvent]struct{}),
+	}
+	// Updates replayed after an outage go straight to the primary board.
+	if replayer, ok := lb.(interface{ OnReplay(func()) }); ok {
+		replayer.OnReplay(s.changed)
+	}
+	return s
+}
+
+func (s *LeaderboardStream) AddScore(userID uint, score int64) error {
+	err := s.Leaderboard.AddScore(userID, score)
+	s.changed()
+	return err
+}
+
+func (s *LeaderboardStream) AddScoreAt(userID uint, score int64, at time.Time) error {
+	err := s.Leaderboard.AddScoreAt(userID, score, at)
+	s.changed()
+	return err
+}
+
+func (s *LeaderboardStream) Remove(userID uint) error {
+	err := s.Leaderboard.Remove(userID)
+	s.changed()
+	return err
+}
+
+// changed marks the board for a check without blocking the writer.
+func (s *LeaderboardStream) changed() {
+	select {
+	case s.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes changes of the top until the process exits. Score changes
+// arriving while an interval is running are merged into the next check.
+func (s *LeaderboardStream) Run() {
+	if err := s.publish(); err != nil {
+		log.Printf("failed to load the streamed leaderboard: %v", err)
+	}
+	for range s.dirty {
+		if err := s.publish(); err != nil {
+			log.Printf("failed to publish leaderboard changes: %v", err)
+		}
+		time.Sleep(s.interval)
+	}
+}
+
+// publish compares the current top with the last one and sends an update
+// to every subscriber if it differs.
+func (s *LeaderboardStream) publish() error {
+	top, err := s.Leaderboard.Top(s.size)
+	if err != nil {
+		return err
+	}
+	if err := hydrateEntries(s.users, top); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes := rankChanges(s.top, top)
+	if s.lastID > 0 && len(changes) == 0 {
+		return nil
+	}
+	s.top = top
+	s.lastID++
+	event := LeaderboardEvent{ID: s.eventID(s.lastID), seq: s.lastID, Type: LeaderboardUpdate, At: time.Now(), Entries: top, Changes: changes}
+	s.backlog = append(s.backlog, event)
+	if len(s.backlog) > streamBacklog {
+		s.backlog = s.backlog[len(s.backlog)-streamBacklog:]
+	}
+	for ch := range s.subscribers {
+		// Every event carries the whole top, so a client too slow to take
+		// one misses nothing once it catches up with the next.
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+// rankChanges lists the users whose rank or points differ between two tops.
+func rankChanges(before, after []LeaderboardEntry) []RankChange {
+	previous := make(map[uint]LeaderboardEntry, len(before))
+	for _, e := range before {
+		previous[e.UserID] = e
+	}
+	var changes []RankChange
+	for _, e := range after {
+		old, ok := previous[e.UserID]
+		delete(previous, e.UserID)
+		if ok && old.Rank == e.Rank && old.Points == e.Points {
+			continue
+		}
+		changes = append(changes, RankChange{UserID: e.UserID, Username: e.Username, Points: e.Points, Rank: e.Rank, PreviousRank: old.Rank})
+	}
+	for _, e := range before {
+		if _, left := previous[e.UserID]; left {
+			changes = append(changes, RankChange{UserID: e.UserID, Username: e.Username, Points: e.Points, PreviousRank: e.Rank})
+		}
+	}
+	return changes
+}
+
+func (s *LeaderboardStream) eventID(seq uint64) string {
+	return fmt.Sprintf("%s-%d", s.epoch, seq)
+}
+
+// sequence returns the sequence number of an event ID issued since this
+// server started, or 0 for any other ID.
+func (s *LeaderboardStream) sequence(id string) uint64 {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != s.epoch {
+		return 0
+	}
+	n, _ := strconv.ParseUint(seq, 10, 64)
+	return n
+}
+
+// Subscribe registers a subscriber. The returned events are what the client
+// missed: the events after lastEventID when they are still kept, otherwise a
+// snapshot of the current top. cancel must be called once the client is
+// gone. ErrStreamFull is returned when the subscriber limit is reached.
+func (s *LeaderboardStream) Subscribe(lastEventID string) ([]LeaderboardEvent, <-chan LeaderboardEvent, func(), error) {
+	ch := make(chan LeaderboardEvent, 8)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxSubscribers > 0 && len(s.subscribers) >= s.maxSubscribers {
+		return nil, nil, nil, ErrStreamFull
+	}
+	s.subscribers[ch] = struct{}{}
+
+	last := s.sequence(lastEventID)
+	var missed []LeaderboardEvent
+	switch {
+	case last > 0 && last == s.lastID:
+	case last > 0 && len(s.backlog) > 0 && last >= s.backlog[0].seq-1 && last < s.lastID:
+		for _, e := range s.backlog {
+			if e.seq > last {
+				missed = append(missed, e)
+			}
+		}
+	default:
+		top := s.top
+		if top == nil {
+			top = []LeaderboardEntry{}
+		}
+		missed = []LeaderboardEvent{{ID: s.eventID(s.lastID), seq: s.lastID, Type: LeaderboardSnapshot, At: time.Now(), Entries: top}}
+	}
+
+	cancel := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers, ch)
+	}
+	return missed, ch, cancel, nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestLeaderboardStreamPublishesTopChanges(t *testing.T) {
+	db := setupTestDB(t)
+	stream := NewLeaderboardStream(NewMemoryLeaderboard(), repository.NewUserRepository(db), config.Config{LeaderboardStreamSize: 2})
+
+	stream.AddScore(1, 100)
+	stream.AddScore(2, 80)
+	if err := stream.publish(); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	missed, events, cancel, err := stream.Subscribe("")
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	defer cancel()
+	if len(missed) != 1 || missed[0].Type != LeaderboardSnapshot || missed[0].ID != stream.eventID(1) || len(missed[0].Entries) != 2 {
+		t.Fatalf("expected a snapshot on connect, got %+v", missed)
+	}
+
+	// A change below the streamed top is not published.
+	stream.AddScore(3, 10)
+	stream.publish()
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %+v", event)
+	default:
+	}
+
+	// Several changes before the next check arrive as one event.
+	stream.AddScore(3, 90)
+	stream.AddScore(3, 120)
+	stream.publish()
+	event := <-events
+	if event.ID != stream.eventID(2) || event.Type != LeaderboardUpdate || event.Entries[0].UserID != 3 {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	changes := map[uint]RankChange{}
+	for _, c := range event.Changes {
+		changes[c.UserID] = c
+	}
+	if len(changes) != 3 || changes[3].Rank != 1 || changes[3].PreviousRank != 0 ||
+		changes[1].Rank != 2 || changes[1].PreviousRank != 1 || changes[2].Rank != 0 || changes[2].PreviousRank != 2 {
+		t.Fatalf("unexpected changes: %+v", event.Changes)
+	}
+
+	stream.Remove(3)
+	stream.publish()
+	<-events
+
+	// Resuming replays the kept events after the last one seen; an unknown
+	// ID falls back to a snapshot and an up-to-date client gets nothing.
+	if resumed, _, cancel, _ := stream.Subscribe(stream.eventID(1)); len(resumed) != 2 || resumed[0].ID != stream.eventID(2) || resumed[1].ID != stream.eventID(3) {
+		t.Fatalf("unexpected resumption: %+v", resumed)
+	} else {
+		cancel()
+	}
+	if resumed, _, cancel, _ := stream.Subscribe(stream.eventID(3)); len(resumed) != 0 {
+		t.Fatalf("expected nothing for an up-to-date client, got %+v", resumed)
+	} else {
+		cancel()
+	}
+	if resumed, _, cancel, _ := stream.Subscribe(stream.eventID(42)); len(resumed) != 1 || resumed[0].Type != LeaderboardSnapshot || resumed[0].ID != stream.eventID(3) {
+		t.Fatalf("expected a snapshot for an unknown ID, got %+v", resumed)
+	} else {
+		cancel()
+	}
+}
+
+func TestLeaderboardStreamSurvivesRestartAndLimitsSubscribers(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := config.Config{LeaderboardStreamSize: 2, LeaderboardStreamMaxSubscribers: 1}
+	before := NewLeaderboardStream(NewMemoryLeaderboard(), repository.NewUserRepository(db), cfg)
+	before.AddScore(1, 100)
+	before.publish()
+	before.AddScore(2, 80)
+	before.publish()
+
+	// After a restart the sequence starts over, so an ID from the previous
+	// run must not look like one of the new events.
+	after := NewLeaderboardStream(NewMemoryLeaderboard(), repository.NewUserRepository(db), cfg)
+	after.epoch = before.epoch + "x"
+	after.AddScore(1, 100)
+	after.publish()
+	after.AddScore(2, 80)
+	after.publish()
+	after.AddScore(3, 120)
+	after.publish()
+	missed, _, cancel, err := after.Subscribe(before.eventID(2))
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+	if len(missed) != 1 || missed[0].Type != LeaderboardSnapshot || missed[0].ID != after.eventID(3) {
+		t.Fatalf("expected a snapshot for an ID from before the restart, got %+v", missed)
+	}
+
+	if _, _, _, err := after.Subscribe(""); !errors.Is(err, ErrStreamFull) {
+		t.Fatalf("expected the subscriber limit, got %v", err)
+	}
+	cancel()
+	if _, _, cancel, err := after.Subscribe(""); err != nil {
+		t.Fatalf("expected a free slot after cancel, got %v", err)
+	} else {
+		cancel()
+	}
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/example/solo_journey/internal/repository"
+	"gorm.io/gorm"
+)
+
+// maxReportedDiscrepancies caps how many individual discrepancies a report
+// lists; the counters always cover all of them.
+const maxReportedDiscrepancies = 100
+
+// LeaderboardSync keeps the configured Leaderboard in line with the point
+// totals stored in the database. The board is only updated on some point
+// changes and the in-memory board starts empty, so it is warmed up on startup
+// and checked periodically.
+type LeaderboardSync struct {
+	users       *repository.UserRepository
+	trips       *repository.TripRepository
+	leaderboard Leaderboard
+}
+
+// LeaderboardDiscrepancy is a member whose score on the board differed from
+// the database. Actual is nil when the user was missing from the board and
+// Expected is nil when the board held a user that no longer exists.
+type LeaderboardDiscrepancy struct {
+	UserID   uint   `json:"user_id"`
+	Expected *int64 `json:"expected"`
+	Actual   *int64 `json:"actual"`
+}
+
+type ReconcileReport struct {
+	CheckedAt     time.Time                `json:"checked_at"`
+	Users         int                      `json:"users"`
+	Added         int                      `json:"added"`
+	Updated       int                      `json:"updated"`
+	Removed       int                      `json:"removed"`
+	Discrepancies []LeaderboardDiscrepancy `json:"discrepancies"`
+}
+
+// Repaired returns how many members of the board had to be changed.
+func (r *ReconcileReport) Repaired() int {
+	return r.Added + r.Updated + r.Removed
+}
+
+func NewLeaderboardSync(users *repository.UserRepository, trips *repository.TripRepository, leaderboard Leaderboard) *LeaderboardSync {
+	return &LeaderboardSync{users: users, trips: trips, leaderboard: leaderboard}
+}
+
+// Reconcile compares every user's points with the board, writes missing and
+// stale scores and removes members that are not users. The board is read
+// before the database, so a score awarded in between is newer in the
+// database snapshot rather than older; each user's points are read again
+// before writing, and a user whose points changed since the snapshot is left
+// to the award that changed them.
+func (s *LeaderboardSync) Reconcile() (*ReconcileReport, error) {
+	actual, err := s.leaderboard.Scores()
+	if err != nil {
+		return nil, err
+	}
+	expected, err := s.users.Scores()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{CheckedAt: time.Now(), Users: len(expected), Discrepancies: []LeaderboardDiscrepancy{}}
+	record := func(d LeaderboardDiscrepancy) {
+		if len(report.Discrepancies) < maxReportedDiscrepancies {
+			report.Discrepancies = append(report.Discrepancies, d)
+		}
+	}
+
+	known := make(map[uint]bool, len(expected))
+	for _, u := range expected {
+		known[u.ID] = true
+		points := u.Points
+		score, ok := actual[u.ID]
+		if ok && score == points {
+			continue
+		}
+		current, err := s.users.FindByID(u.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		if current.Points != points {
+			continue
+		}
+		if err := s.leaderboard.AddScoreAt(u.ID, points, u.ReachedAt); err != nil {
+			return report, err
+		}
+		if ok {
+			report.Updated++
+			record(LeaderboardDiscrepancy{UserID: u.ID, Expected: &points, Actual: &score})
+		} else {
+			report.Added++
+			record(LeaderboardDiscrepancy{UserID: u.ID, Expected: &points})
+		}
+	}
+
+	for id, score := range actual {
+		if known[id] {
+			continue
+		}
+		if err := s.leaderboard.Remove(id); err != nil {
+			return report, err
+		}
+		score := score
+		report.Removed++
+		record(LeaderboardDiscrepancy{UserID: id, Actual: &score})
+	}
+	return report, nil
+}
+
+// RebuildRegions recomputes every regional board from the points awarded to
+// trips and returns how many regions it wrote.
+func (s *LeaderboardSync) RebuildRegions() (int, error) {
+	scores, err := s.trips.PointsByCountry()
+	if err != nil {
+		return 0, err
+	}
+	regions := make(map[string][]repository.UserScore)
+	for _, score := range scores {
+		regions[score.Country] = append(regions[score.Country], repository.UserScore{ID: score.UserID, Points: score.Points, ReachedAt: score.ReachedAt})
+	}
+	for country, board := range regions {
+		if err := s.leaderboard.Replace(regionBoard(country), board); err != nil {
+			return 0, err
+		}
+	}
+	return len(regions), nil
+}
+
+// Run reconciles every interval and logs the drift it repaired.
+func (s *LeaderboardSync) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := s.RebuildRegions(); err != nil {
+			log.Printf("failed to rebuild regional leaderboards: %v", err)
+		}
+		report, err := s.Reconcile()
+		if err != nil {
+			log.Printf("leaderboard consistency check failed: %v", err)
+			continue
+		}
+		if report.Repaired() > 0 {
+			log.Printf("leaderboard drift repaired: %d added, %d updated, %d removed", report.Added, report.Updated, report.Removed)
+		}
+	}
+}
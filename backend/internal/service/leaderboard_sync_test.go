@@ -0,0 +1,192 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+// awardingLeaderboard lets a points award land just before the board is
+// read, like a trip created while Reconcile runs.
+type awardingLeaderboard struct {
+	*MemoryLeaderboard
+	award func()
+}
+
+func (a *awardingLeaderboard) Scores() (map[uint]int64, error) {
+	if a.award != nil {
+		a.award()
+		a.award = nil
+	}
+	return a.MemoryLeaderboard.Scores()
+}
+
+func TestLeaderboardReconcileKeepsConcurrentAward(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	lb := &awardingLeaderboard{MemoryLeaderboard: NewMemoryLeaderboard()}
+	syncer := NewLeaderboardSync(userRepo, repository.NewTripRepository(db), lb)
+
+	user := &models.User{Username: "racer", Email: "racer@example.com", Password: "secret", Points: 40}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	lb.AddScore(user.ID, 40)
+	lb.award = func() {
+		updated, err := userRepo.IncrementPoints(user.ID, 60)
+		if err != nil {
+			t.Fatalf("failed to award points: %v", err)
+		}
+		lb.AddScore(user.ID, updated.Points)
+	}
+
+	if _, err := syncer.Reconcile(); err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if scores, _ := lb.Scores(); scores[user.ID] != 100 {
+		t.Fatalf("the concurrent award was overwritten: %v", scores)
+	}
+}
+
+func TestLeaderboardReconcileRepairsDrift(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	lb := NewMemoryLeaderboard()
+	syncer := NewLeaderboardSync(userRepo, repository.NewTripRepository(db), lb)
+
+	stale := &models.User{Username: "drifted", Email: "drifted@example.com", Password: "secret", Points: 120}
+	missing := &models.User{Username: "forgotten", Email: "forgotten@example.com", Password: "secret", Points: 75}
+	for _, u := range []*models.User{stale, missing} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	lb.AddScore(stale.ID, 40)
+	lb.AddScore(999999, 10)
+
+	report, err := syncer.Reconcile()
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if report.Updated != 1 || report.Removed != 1 || report.Added != report.Users-1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	found := map[uint]LeaderboardDiscrepancy{}
+	for _, d := range report.Discrepancies {
+		found[d.UserID] = d
+	}
+	if d := found[stale.ID]; d.Actual == nil || *d.Actual != 40 || *d.Expected != 120 {
+		t.Fatalf("expected stale score to be reported, got %+v", d)
+	}
+	if d := found[missing.ID]; d.Actual != nil || d.Expected == nil || *d.Expected != 75 {
+		t.Fatalf("expected missing user to be reported, got %+v", d)
+	}
+	if d, ok := found[999999]; !ok || d.Expected != nil {
+		t.Fatalf("expected unknown member to be reported, got %+v", d)
+	}
+
+	scores, _ := lb.Scores()
+	if scores[stale.ID] != 120 || scores[missing.ID] != 75 {
+		t.Fatalf("board not repaired: %v", scores)
+	}
+	if _, ok := scores[999999]; ok {
+		t.Fatalf("unknown member was not removed")
+	}
+
+	report, err = syncer.Reconcile()
+	if err != nil {
+		t.Fatalf("second reconcile failed: %v", err)
+	}
+	if report.Repaired() != 0 || len(report.Discrepancies) != 0 {
+		t.Fatalf("expected a consistent board, got %+v", report)
+	}
+}
+
+func TestRegionalLeaderboardsFollowTrips(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tripRepo := repository.NewTripRepository(db)
+	lb := NewMemoryLeaderboard()
+	trips := NewTripService(tripRepo, userRepo, lb, config.Config{})
+
+	local := &models.User{Username: "icelander", Email: "icelander@example.com", Password: "secret"}
+	visitor := &models.User{Username: "iceland_visitor", Email: "iceland_visitor@example.com", Password: "secret"}
+	for _, u := range []*models.User{local, visitor} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	for _, trip := range []CreateTripInput{
+		verifiedTripInput(local.ID, "Iceland", time.Now()),
+		verifiedTripInput(visitor.ID, "Bhutan", time.Now()),
+		verifiedTripInput(visitor.ID, "iceland", time.Now()),
+		verifiedTripInput(visitor.ID, "Atlantis", time.Now()),
+	} {
+		if _, err := trips.CreateTrip(trip); err != nil {
+			t.Fatalf("failed to create trip: %v", err)
+		}
+	}
+
+	check := func(when string) {
+		entries, err := trips.RegionalLeaderboard("is", 10)
+		if err != nil {
+			t.Fatalf("%s: regional leaderboard failed: %v", when, err)
+		}
+		if len(entries) != 2 || entries[0].UserID != local.ID || entries[0].Points != 90 || entries[0].Username != "icelander" || entries[1].UserID != visitor.ID {
+			t.Fatalf("%s: unexpected Iceland board: %+v", when, entries)
+		}
+		bhutan, _ := trips.RegionalLeaderboard("Bhutan", 10)
+		if len(bhutan) != 1 || bhutan[0].UserID != visitor.ID {
+			t.Fatalf("%s: unexpected Bhutan board: %+v", when, bhutan)
+		}
+		if _, err := trips.RegionalLeaderboard("Atlantis", 10); !errors.Is(err, ErrUnknownCountry) {
+			t.Fatalf("%s: expected ErrUnknownCountry, got %v", when, err)
+		}
+	}
+	check("live")
+
+	// A restarted in-memory board is rebuilt from the stored trip awards.
+	rebuilt := NewMemoryLeaderboard()
+	if _, err := NewLeaderboardSync(userRepo, tripRepo, rebuilt).RebuildRegions(); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	trips = NewTripService(tripRepo, userRepo, rebuilt, config.Config{})
+	check("rebuilt")
+}
+
+func TestRebuildRegionsKeepsTieBreak(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tripRepo := repository.NewTripRepository(db)
+	trips := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard(), config.Config{})
+
+	late := &models.User{Username: "nepal_late", Email: "nepal_late@example.com", Password: "secret"}
+	early := &models.User{Username: "nepal_early", Email: "nepal_early@example.com", Password: "secret"}
+	for _, u := range []*models.User{late, early} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	// Both earn the same points; the user who got there first ranks first.
+	for _, id := range []uint{early.ID, late.ID} {
+		if _, err := trips.CreateTrip(verifiedTripInput(id, "Nepal", time.Now())); err != nil {
+			t.Fatalf("failed to create trip: %v", err)
+		}
+	}
+
+	rebuilt := NewMemoryLeaderboard()
+	if _, err := NewLeaderboardSync(userRepo, tripRepo, rebuilt).RebuildRegions(); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	entries, err := NewTripService(tripRepo, userRepo, rebuilt, config.Config{}).RegionalLeaderboard("NP", 10)
+	if err != nil {
+		t.Fatalf("regional leaderboard failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].UserID != early.ID || entries[1].UserID != late.ID || entries[0].Points != entries[1].Points {
+		t.Fatalf("expected the earlier user first after the rebuild, got %+v", entries)
+	}
+}
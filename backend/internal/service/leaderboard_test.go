@@ -0,0 +1,208 @@
+package service
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestMemoryLeaderboardRankAndAround(t *testing.T) {
+	lb := NewMemoryLeaderboard()
+	for id := uint(1); id <= 10; id++ {
+		lb.AddScore(id, int64(id*10))
+	}
+	// Moving a user re-sorts the board; removing one closes the gap.
+	lb.AddScore(3, 1000)
+	lb.Remove(10)
+
+	rank, points, ok, err := lb.Rank(3)
+	if err != nil || !ok || rank != 1 || points != 1000 {
+		t.Fatalf("unexpected rank of user 3: %d %d %v %v", rank, points, ok, err)
+	}
+	rank, _, ok, _ = lb.Rank(5)
+	if !ok || rank != 6 {
+		t.Fatalf("expected user 5 at rank 6, got %d", rank)
+	}
+	if _, _, ok, _ := lb.Rank(10); ok {
+		t.Fatalf("removed user should not be ranked")
+	}
+
+	around, _ := lb.Around(5, 2)
+	want := []uint{7, 6, 5, 4, 2}
+	if len(around) != len(want) {
+		t.Fatalf("unexpected window: %+v", around)
+	}
+	for i, e := range around {
+		if e.UserID != want[i] || e.Rank != int64(i+4) {
+			t.Fatalf("unexpected window: %+v", around)
+		}
+	}
+
+	// The window is cut off at both ends of the board.
+	if top, _ := lb.Around(3, 2); len(top) != 3 || top[0].UserID != 3 {
+		t.Fatalf("unexpected window at the top: %+v", top)
+	}
+	if bottom, _ := lb.Around(1, 2); len(bottom) != 3 || bottom[2].UserID != 1 || bottom[2].Rank != 9 {
+		t.Fatalf("unexpected window at the bottom: %+v", bottom)
+	}
+	if none, _ := lb.Around(42, 2); len(none) != 0 {
+		t.Fatalf("expected no window for an unknown user, got %+v", none)
+	}
+}
+
+func TestMemoryLeaderboardMatchesSortedOrder(t *testing.T) {
+	lb := NewMemoryLeaderboard()
+	rng := rand.New(rand.NewSource(1))
+	start := time.Now()
+	want := map[uint]boardMember{}
+	for step := 0; step < 2000; step++ {
+		id := uint(rng.Intn(200) + 1)
+		if rng.Intn(5) == 0 {
+			lb.Remove(id)
+			delete(want, id)
+			continue
+		}
+		points := int64(rng.Intn(50))
+		at := start.Add(time.Duration(step) * time.Second)
+		lb.AddScoreAt(id, points, at)
+		if old, ok := want[id]; !ok || old.points != points {
+			want[id] = boardMember{userID: id, points: points, reachedAt: at}
+		}
+	}
+
+	sorted := make([]boardMember, 0, len(want))
+	for _, m := range want {
+		sorted = append(sorted, m)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].before(sorted[j]) })
+	top, _ := lb.Top(0)
+	if len(top) != len(sorted) {
+		t.Fatalf("expected %d entries, got %d", len(sorted), len(top))
+	}
+	for i, m := range sorted {
+		if top[i].UserID != m.userID || top[i].Points != m.points {
+			t.Fatalf("position %d: expected user %d with %d, got %+v", i, m.userID, m.points, top[i])
+		}
+		rank, _, _, _ := lb.Rank(m.userID)
+		if rank != top[i].Rank {
+			t.Fatalf("user %d: Rank says %d, Top says %d", m.userID, rank, top[i].Rank)
+		}
+		around, _ := lb.Around(m.userID, 1)
+		if len(around) == 0 || (i > 0 && around[0].UserID != sorted[i-1].userID) {
+			t.Fatalf("user %d: unexpected neighbours %+v", m.userID, around)
+		}
+	}
+}
+
+func TestLeaderboardPositionAddsMissingUser(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	lb := NewMemoryLeaderboard()
+	trips := NewTripService(repository.NewTripRepository(db), userRepo, lb, config.Config{})
+
+	user := &models.User{Username: "newcomer", Email: "newcomer@example.com", Password: "secret", Points: 15}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	lb.AddScore(user.ID+1000, 40)
+	lb.AddScore(user.ID+1001, 5)
+
+	position, err := trips.LeaderboardPosition(user.ID, 1)
+	if err != nil {
+		t.Fatalf("position failed: %v", err)
+	}
+	if position.Rank != 2 || position.Points != 15 || len(position.Entries) != 3 || position.Entries[1].UserID != user.ID {
+		t.Fatalf("unexpected position: %+v", position)
+	}
+}
+
+func TestMemoryLeaderboardSharesRanksAndBreaksTiesByTime(t *testing.T) {
+	lb := NewMemoryLeaderboard()
+	early := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	lb.AddScoreAt(1, 100, late)
+	lb.AddScoreAt(2, 100, early)
+	lb.AddScoreAt(3, 200, late)
+	lb.AddScoreAt(4, 50, early)
+	// Writing the same points again keeps the time they were reached.
+	lb.AddScoreAt(2, 100, late.Add(time.Hour))
+
+	top, _ := lb.Top(10)
+	wantIDs := []uint{3, 2, 1, 4}
+	wantRanks := []int64{1, 2, 2, 4}
+	for i, e := range top {
+		if e.UserID != wantIDs[i] || e.Rank != wantRanks[i] {
+			t.Fatalf("unexpected board: %+v", top)
+		}
+	}
+	if rank, _, _, _ := lb.Rank(1); rank != 2 {
+		t.Fatalf("expected user 1 to share rank 2, got %d", rank)
+	}
+	// A window starting inside a tie still reports the shared rank.
+	around, _ := lb.Around(4, 1)
+	if len(around) != 2 || around[0].UserID != 1 || around[0].Rank != 2 || around[1].Rank != 4 {
+		t.Fatalf("unexpected window: %+v", around)
+	}
+}
+
+func TestTieScoreKeepsPointsAndOrder(t *testing.T) {
+	early := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	late := early.Add(time.Second)
+	if tieScore(100, early) <= tieScore(100, late) {
+		t.Fatalf("earlier score should rank higher")
+	}
+	if tieScore(101, late) <= tieScore(100, early) {
+		t.Fatalf("more points should always rank higher")
+	}
+	for _, points := range []int64{0, 100, 350000, -5} {
+		if got := pointsOf(tieScore(points, late)); got != points {
+			t.Fatalf("expected %d points back, got %d", points, got)
+		}
+	}
+	if got := pointsOf(tieScore(7, time.Time{})); got != 7 {
+		t.Fatalf("expected a zero time to keep the points, got %d", got)
+	}
+}
+
+func TestLeaderboardEntriesAreHydrated(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	lb := NewMemoryLeaderboard()
+	trips := NewTripService(repository.NewTripRepository(db), userRepo, lb, config.Config{})
+
+	user := &models.User{Username: "hydrated", Email: "hydrated@example.com", Password: "secret", Level: 3, AvatarURL: "https://cdn.example.com/a.png"}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	lb.AddScore(user.ID, 1_000_000)
+	lb.AddScore(user.ID+5000, 999_999)
+
+	entries, err := trips.Leaderboard(2)
+	if err != nil {
+		t.Fatalf("leaderboard failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Username != "hydrated" || entries[0].Level != 3 || entries[0].AvatarURL != user.AvatarURL || entries[0].Rank != 1 {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if entries[1].Username != "" || entries[1].Rank != 2 {
+		t.Fatalf("expected an unknown user to stay bare, got %+v", entries[1])
+	}
+
+	if _, err := userRepo.AddPoints(user.ID, 5, "activity"); err != nil {
+		t.Fatalf("failed to add points: %v", err)
+	}
+	scores, err := userRepo.Scores()
+	if err != nil {
+		t.Fatalf("failed to load scores: %v", err)
+	}
+	for _, s := range scores {
+		if s.ID == user.ID && (s.ReachedAt.IsZero() || s.ReachedAt.Before(user.CreatedAt)) {
+			t.Fatalf("expected the latest history entry as reached time, got %v", s.ReachedAt)
+		}
+	}
+}
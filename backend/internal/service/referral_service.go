@@ -0,0 +1,217 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+const (
+	referralInviterBonus int64 = 100
+	referralInviteeBonus int64 = 50
+	inviteCodeLength           = 8
+	inviteCodeAlphabet         = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// Reasons recorded on rejected referrals.
+const (
+	ReferralSelf       = "self_referral"
+	ReferralSameDevice = "same_device"
+	ReferralSameIP     = "same_ip"
+)
+
+var ErrInvalidInviteCode = errors.New("invalid invite code")
+
+type ReferralService struct {
+	referrals   *repository.ReferralRepository
+	users       *repository.UserRepository
+	leaderboard Leaderboard
+}
+
+type ReferralEntry struct {
+	ID              uint       `json:"id"`
+	InviteeUsername string     `json:"invitee_username"`
+	Status          string     `json:"status"`
+	RejectReason    string     `json:"reject_reason,omitempty"`
+	Bonus           int64      `json:"bonus"`
+	CreatedAt       time.Time  `json:"created_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+}
+
+type ReferralSummary struct {
+	InviteCode   string          `json:"invite_code"`
+	Pending      int             `json:"pending"`
+	Completed    int             `json:"completed"`
+	Rejected     int             `json:"rejected"`
+	PointsEarned int64           `json:"points_earned"`
+	Referrals    []ReferralEntry `json:"referrals"`
+}
+
+func NewReferralService(referrals *repository.ReferralRepository, users *repository.UserRepository, lb Leaderboard) *ReferralService {
+	return &ReferralService{referrals: referrals, users: users, leaderboard: lb}
+}
+
+// Inviter resolves an invite code to the user who owns it.
+func (s *ReferralService) Inviter(code string) (*models.User, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, ErrInvalidInviteCode
+	}
+	inviter, err := s.users.FindByInviteCode(code)
+	if err != nil {
+		return nil, ErrInvalidInviteCode
+	}
+	return inviter, nil
+}
+
+// Record stores the referral of a freshly registered invitee. Referrals that
+// look fraudulent are stored as rejected so they never pay out.
+func (s *ReferralService) Record(inviter, invitee *models.User) (*models.Referral, error) {
+	referral := &models.Referral{
+		InviterID:    inviter.ID,
+		InviteeID:    invitee.ID,
+		Code:         inviter.InviteCode,
+		Status:       models.ReferralPending,
+		InviterBonus: referralInviterBonus,
+		InviteeBonus: referralInviteeBonus,
+	}
+	if reason := referralFraudReason(inviter, invitee); reason != "" {
+		referral.Status = models.ReferralRejected
+		referral.RejectReason = reason
+	}
+	if err := s.referrals.Create(referral); err != nil {
+		return nil, err
+	}
+	return referral, nil
+}
+
+// TripCreated pays out the pending referral of the author once they post their
+// first verified trip.
+func (s *ReferralService) TripCreated(user *models.User, trip *models.TripPost) error {
+	if !trip.Verified {
+		return nil
+	}
+	referral, err := s.referrals.FindPendingByInvitee(user.ID)
+	if err != nil || referral == nil {
+		return err
+	}
+
+	now := time.Now()
+	referral.CompletedAt = &now
+	inviter, invitee, err := s.referrals.Complete(referral)
+	if err != nil {
+		return err
+	}
+
+	if s.leaderboard != nil {
+		if err := s.leaderboard.AddScore(inviter.ID, inviter.Points); err != nil {
+			return err
+		}
+		if err := s.leaderboard.AddScore(invitee.ID, invitee.Points); err != nil {
+			return err
+		}
+		if err := recordEarned(s.leaderboard, inviter.ID, referral.InviterBonus, now); err != nil {
+			return err
+		}
+		return recordEarned(s.leaderboard, invitee.ID, referral.InviteeBonus, now)
+	}
+	return nil
+}
+
+func (s *ReferralService) Summary(userID uint) (*ReferralSummary, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.InviteCode == "" {
+		if user.InviteCode, err = newInviteCode(s.users); err != nil {
+			return nil, err
+		}
+		if err := s.users.Update(user); err != nil {
+			return nil, err
+		}
+	}
+
+	referrals, err := s.referrals.ListByInviter(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ReferralSummary{InviteCode: user.InviteCode, Referrals: make([]ReferralEntry, 0, len(referrals))}
+	for _, r := range referrals {
+		entry := ReferralEntry{
+			ID:              r.ID,
+			InviteeUsername: r.Invitee.Username,
+			Status:          r.Status,
+			RejectReason:    r.RejectReason,
+			CreatedAt:       r.CreatedAt,
+			CompletedAt:     r.CompletedAt,
+		}
+		switch r.Status {
+		case models.ReferralPending:
+			summary.Pending++
+		case models.ReferralCompleted:
+			summary.Completed++
+			entry.Bonus = r.InviterBonus
+			summary.PointsEarned += r.InviterBonus
+		case models.ReferralRejected:
+			summary.Rejected++
+		}
+		summary.Referrals = append(summary.Referrals, entry)
+	}
+	return summary, nil
+}
+
+// referralFraudReason returns why a referral must not pay out, or an empty
+// string when it looks legitimate.
+func referralFraudReason(inviter, invitee *models.User) string {
+	switch {
+	case inviter.ID == invitee.ID || canonicalEmail(inviter.Email) == canonicalEmail(invitee.Email):
+		return ReferralSelf
+	case inviter.DeviceID != "" && inviter.DeviceID == invitee.DeviceID:
+		return ReferralSameDevice
+	case inviter.RegistrationIP != "" && inviter.RegistrationIP == invitee.RegistrationIP:
+		return ReferralSameIP
+	}
+	return ""
+}
+
+// canonicalEmail lower-cases the address and strips "+tag" suffixes and dots
+// from the local part so aliases of the same mailbox compare equal.
+func canonicalEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at:]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	return strings.ReplaceAll(local, ".", "") + domain
+}
+
+// newInviteCode generates a random invite code that is not used yet.
+func newInviteCode(users *repository.UserRepository) (string, error) {
+	for {
+		buf := make([]byte, inviteCodeLength)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for i, b := range buf {
+			buf[i] = inviteCodeAlphabet[int(b)%len(inviteCodeAlphabet)]
+		}
+		code := string(buf)
+		exists, err := users.InviteCodeExists(code)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return code, nil
+		}
+	}
+}
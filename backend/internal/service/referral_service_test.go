@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestReferralBonusAfterFirstVerifiedTrip(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tripRepo := repository.NewTripRepository(db)
+	lb := NewMemoryLeaderboard()
+	auth := NewAuthService(userRepo, repository.NewTokenRepository(db), config.Config{JWTSecret: "test"})
+	referrals := NewReferralService(repository.NewReferralRepository(db), userRepo, lb)
+	trips := NewTripService(tripRepo, userRepo, lb, config.Config{})
+	trips.AddListener(referrals)
+
+	inviter, err := auth.Register(RegisterInput{Username: "gina", Email: "gina@example.com", Password: "password", IP: "10.0.0.1", DeviceID: "phone-1"})
+	if err != nil {
+		t.Fatalf("failed to register inviter: %v", err)
+	}
+	if inviter.InviteCode == "" {
+		t.Fatalf("expected invite code to be generated")
+	}
+
+	found, err := referrals.Inviter(inviter.InviteCode)
+	if err != nil || found.ID != inviter.ID {
+		t.Fatalf("expected invite code to resolve to inviter, got %v, %v", found, err)
+	}
+	if _, err := referrals.Inviter("NOPE1234"); err != ErrInvalidInviteCode {
+		t.Fatalf("expected invalid invite code error, got %v", err)
+	}
+
+	invitee, err := auth.Register(RegisterInput{Username: "hank", Email: "hank@example.com", Password: "password", IP: "10.0.0.2", DeviceID: "phone-2"})
+	if err != nil {
+		t.Fatalf("failed to register invitee: %v", err)
+	}
+	referral, err := referrals.Record(found, invitee)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if referral.Status != models.ReferralPending {
+		t.Fatalf("expected pending referral, got %s (%s)", referral.Status, referral.RejectReason)
+	}
+
+	unverified := verifiedTripInput(invitee.ID, "Japan", time.Now())
+	unverified.Media[0].MetadataRaw = `{"captured_at":"` + time.Now().Format(time.RFC3339) + `","latitude":1,"longitude":1}`
+	unverified.VisitedAt = time.Now().Add(12 * time.Hour)
+	if trip, err := trips.CreateTrip(unverified); err != nil || trip.Verified {
+		t.Fatalf("expected unverified trip, got %+v, %v", trip, err)
+	}
+	if summary, _ := referrals.Summary(inviter.ID); summary.Pending != 1 {
+		t.Fatalf("expected referral to stay pending, got %+v", summary)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := trips.CreateTrip(verifiedTripInput(invitee.ID, "Japan", time.Now())); err != nil {
+			t.Fatalf("failed to create trip: %v", err)
+		}
+	}
+
+	summary, err := referrals.Summary(inviter.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.Completed != 1 || summary.PointsEarned != referralInviterBonus || summary.Referrals[0].InviteeUsername != "hank" {
+		t.Fatalf("expected completed referral, got %+v", summary)
+	}
+
+	updated, err := userRepo.FindByID(inviter.ID)
+	if err != nil {
+		t.Fatalf("failed to load inviter: %v", err)
+	}
+	if updated.Points != referralInviterBonus {
+		t.Fatalf("expected inviter bonus to be paid once, got %d points", updated.Points)
+	}
+}
+
+func TestReferralFraudChecks(t *testing.T) {
+	inviter := &models.User{ID: 1, Email: "john.doe@example.com", RegistrationIP: "10.0.0.1", DeviceID: "phone-1"}
+	cases := []struct {
+		invitee models.User
+		reason  string
+	}{
+		{models.User{ID: 2, Email: "johndoe+alt@example.com", RegistrationIP: "10.0.0.2", DeviceID: "phone-2"}, ReferralSelf},
+		{models.User{ID: 2, Email: "other@example.com", RegistrationIP: "10.0.0.2", DeviceID: "phone-1"}, ReferralSameDevice},
+		{models.User{ID: 2, Email: "other@example.com", RegistrationIP: "10.0.0.1", DeviceID: "phone-2"}, ReferralSameIP},
+		{models.User{ID: 2, Email: "other@example.com", RegistrationIP: "10.0.0.2"}, ""},
+	}
+	for _, c := range cases {
+		if got := referralFraudReason(inviter, &c.invitee); got != c.reason {
+			t.Fatalf("expected %q for %+v, got %q", c.reason, c.invitee, got)
+		}
+	}
+}
@@ -2,47 +2,331 @@ package service
 
 import (
 	"errors"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/example/solo_journey/internal/models"
 	"github.com/example/solo_journey/internal/repository"
 )
 
 type RewardService struct {
-	rewards *repository.RewardRepository
-	users   *repository.UserRepository
+	rewards   *repository.RewardRepository
+	users     *repository.UserRepository
+	listeners []RedemptionListener
+}
+
+// RedemptionListener is notified after a redemption has been stored.
+type RedemptionListener interface {
+	RedemptionCreated(user *models.User, redemption *models.Redemption) error
 }
 
 func NewRewardService(rewards *repository.RewardRepository, users *repository.UserRepository) *RewardService {
 	return &RewardService{rewards: rewards, users: users}
 }
 
+func (s *RewardService) AddListener(l RedemptionListener) {
+	s.listeners = append(s.listeners, l)
+}
+
 func (s *RewardService) ListRewards() ([]models.Reward, error) {
 	return s.rewards.List()
 }
 
-func (s *RewardService) Redeem(userID uint, rewardID uint) (*models.Redemption, *models.User, error) {
-	reward, err := s.rewards.FindByID(rewardID)
+// ListRewardsFor returns the catalog annotated with the caller's eligibility.
+// A zero userID lists the catalog anonymously.
+func (s *RewardService) ListRewardsFor(userID uint) ([]RewardListing, error) {
+	rewards, err := s.rewards.List()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	var user *models.User
+	if userID != 0 {
+		if user, err = s.users.FindByID(userID); err != nil {
+			return nil, err
+		}
+	}
+	return s.annotate(rewards, user)
+}
+
+const (
+	defaultCatalogPageSize = 50
+	maxCatalogPageSize     = 100
+)
+
+var (
+	ErrInvalidSort         = errors.New("sort must be one of cost_asc, cost_desc, popularity, newest")
+	ErrAffordableNeedsUser = errors.New("affordable filter requires authentication")
+)
+
+// CatalogQuery describes one page of the public catalog.
+type CatalogQuery struct {
+	Category string
+	Tag      string
+	Search   string
+	Sort     string
+	// Affordable limits the catalog to rewards the caller has enough points
+	// for.
+	Affordable bool
+	Limit      int
+	Offset     int
+}
+
+// BrowseRewards filters, sorts and pages the catalog and annotates the page
+// with the caller's eligibility. It also returns the total number of matching
+// rewards.
+func (s *RewardService) BrowseRewards(userID uint, q CatalogQuery) ([]RewardListing, int64, error) {
+	switch q.Sort {
+	case "", repository.RewardSortCostAsc, repository.RewardSortCostDesc, repository.RewardSortPopularity, repository.RewardSortNewest:
+	default:
+		return nil, 0, ErrInvalidSort
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultCatalogPageSize
+	}
+	if q.Limit > maxCatalogPageSize {
+		q.Limit = maxCatalogPageSize
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	var user *models.User
+	if userID != 0 {
+		var err error
+		if user, err = s.users.FindByID(userID); err != nil {
+			return nil, 0, err
+		}
+	}
+	query := repository.RewardQuery{
+		Category: normalizeCategory(q.Category),
+		Tag:      strings.ToLower(strings.TrimSpace(q.Tag)),
+		Search:   strings.TrimSpace(q.Search),
+		Sort:     q.Sort,
+		Limit:    q.Limit,
+		Offset:   q.Offset,
+	}
+	if q.Affordable {
+		if user == nil {
+			return nil, 0, ErrAffordableNeedsUser
+		}
+		query.MaxCost = &user.Points
 	}
 
-	if reward.Inventory <= 0 {
-		return nil, nil, errors.New("reward unavailable")
+	rewards, total, err := s.rewards.ListCatalog(query)
+	if err != nil {
+		return nil, 0, err
 	}
+	listings, err := s.annotate(rewards, user)
+	return listings, total, err
+}
+
+func (s *RewardService) Categories() ([]repository.CategoryCount, error) {
+	return s.rewards.Categories()
+}
 
-	user, err := s.users.RedeemPoints(userID, reward.PointsCost)
+// annotate wraps rewards in listings and, for a signed-in user, fills in
+// their eligibility.
+func (s *RewardService) annotate(rewards []models.Reward, user *models.User) ([]RewardListing, error) {
+	listings := make([]RewardListing, len(rewards))
+	for i := range rewards {
+		listings[i].Reward = rewards[i]
+	}
+	if user == nil {
+		return listings, nil
+	}
+
+	active, err := s.rewards.ActiveRedemptionCounts(user.ID)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	reward.Inventory--
-	if err := s.rewards.Update(reward); err != nil {
-		return nil, nil, err
+	now := time.Now()
+	for i := range listings {
+		l := &listings[i]
+		if l.InDrop {
+			l.IneligibleReasons = append(l.IneligibleReasons, EligibilityDropOnly)
+		}
+		for _, v := range ruleViolations(&l.Reward, user, active[l.ID], now) {
+			l.IneligibleReasons = append(l.IneligibleReasons, v.Code)
+		}
+		if l.Inventory <= 0 {
+			l.IneligibleReasons = append(l.IneligibleReasons, EligibilityOutOfStock)
+		}
+		if user.Points < l.PointsCost {
+			l.IneligibleReasons = append(l.IneligibleReasons, EligibilityInsufficientPoints)
+		}
+		eligible := len(l.IneligibleReasons) == 0
+		l.Eligible = &eligible
 	}
+	return listings, nil
+}
 
-	redemption := &models.Redemption{UserID: user.ID, RewardID: reward.ID, Status: "pending"}
-	if err := s.rewards.CreateRedemption(redemption); err != nil {
+func (s *RewardService) Redeem(userID uint, rewardID uint) (*models.Redemption, *models.User, error) {
+	check := func(reward *models.Reward, user *models.User, active int64) error {
+		if reward.InDrop {
+			return ErrRewardInDrop
+		}
+		return checkRules(reward, user, active)
+	}
+	redemption, user, err := s.rewards.Redeem(userID, rewardID, check)
+	if err != nil {
 		return nil, nil, err
 	}
+	s.redemptionCreated(user, redemption)
 	return redemption, user, nil
 }
+
+// checkRules is the repository.EligibilityCheck enforcing the reward's rules.
+func checkRules(reward *models.Reward, user *models.User, active int64) error {
+	if violations := ruleViolations(reward, user, active, time.Now()); len(violations) > 0 {
+		return violations[0]
+	}
+	return nil
+}
+
+func (s *RewardService) redemptionCreated(user *models.User, redemption *models.Redemption) {
+	for _, l := range s.listeners {
+		if err := l.RedemptionCreated(user, redemption); err != nil {
+			log.Printf("redemption listener failed for redemption %d: %v", redemption.ID, err)
+		}
+	}
+}
+
+var (
+	ErrRedemptionNotFound = errors.New("redemption not found")
+	ErrInvalidTransition  = errors.New("invalid redemption status transition")
+	ErrCodeRevealed       = errors.New("voucher code was already revealed")
+)
+
+// redemptionTransitions lists, for every status, the statuses it may move to
+// and the actor roles allowed to make that move. Statuses missing from the map
+// are final.
+var redemptionTransitions = map[string]map[string][]string{
+	models.RedemptionPending: {
+		models.RedemptionApproved:  {models.RoleAdmin, models.RolePartner},
+		models.RedemptionRejected:  {models.RoleAdmin, models.RolePartner},
+		models.RedemptionCancelled: {models.RoleUser, models.RoleAdmin},
+		models.RedemptionExpired:   {models.RoleSystem},
+	},
+	models.RedemptionApproved: {
+		models.RedemptionFulfilled: {models.RoleAdmin, models.RolePartner},
+		models.RedemptionRejected:  {models.RoleAdmin, models.RolePartner},
+		models.RedemptionCancelled: {models.RoleAdmin},
+		models.RedemptionExpired:   {models.RoleSystem},
+	},
+}
+
+// refundedStatuses return the points and the inventory unit when entered.
+var refundedStatuses = map[string]bool{
+	models.RedemptionRejected:  true,
+	models.RedemptionCancelled: true,
+	models.RedemptionExpired:   true,
+}
+
+// Cancel lets a user withdraw one of their own pending redemptions.
+func (s *RewardService) Cancel(userID, redemptionID uint, note string) (*models.Redemption, error) {
+	redemption, err := s.rewards.FindRedemption(redemptionID)
+	if err != nil || redemption.UserID != userID {
+		return nil, ErrRedemptionNotFound
+	}
+	revealed, err := s.rewards.VoucherRevealed(redemption.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revealed {
+		return nil, ErrCodeRevealed
+	}
+	if err := s.transition(redemption, models.RedemptionCancelled, userID, models.RoleUser, note); err != nil {
+		return nil, err
+	}
+	return redemption, nil
+}
+
+// Transition applies an administrator's status change to a redemption.
+func (s *RewardService) Transition(actorID, redemptionID uint, to, note string) (*models.Redemption, error) {
+	redemption, err := s.rewards.FindRedemption(redemptionID)
+	if err != nil {
+		return nil, ErrRedemptionNotFound
+	}
+	if err := s.transition(redemption, to, actorID, models.RoleAdmin, note); err != nil {
+		return nil, err
+	}
+	return redemption, nil
+}
+
+// PartnerUpdate applies a status reported by a fulfillment partner. Partners
+// may mark a redemption fulfilled or rejected; a pending redemption reported
+// as fulfilled is approved first so its history keeps every step.
+func (s *RewardService) PartnerUpdate(redemptionID uint, to, note string) (*models.Redemption, error) {
+	if to != models.RedemptionFulfilled && to != models.RedemptionRejected {
+		return nil, ErrInvalidTransition
+	}
+	redemption, err := s.rewards.FindRedemption(redemptionID)
+	if err != nil {
+		return nil, ErrRedemptionNotFound
+	}
+	if to == models.RedemptionFulfilled && redemption.Status == models.RedemptionPending {
+		if err := s.transition(redemption, models.RedemptionApproved, 0, models.RolePartner, note); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.transition(redemption, to, 0, models.RolePartner, note); err != nil {
+		return nil, err
+	}
+	return redemption, nil
+}
+
+// ExpireStale expires every pending or approved redemption older than ttl and
+// returns how many were expired.
+func (s *RewardService) ExpireStale(ttl time.Duration) (int, error) {
+	stale, err := s.rewards.ListOpenRedemptionsBefore(time.Now().Add(-ttl))
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for i := range stale {
+		err := s.transition(&stale[i], models.RedemptionExpired, 0, models.RoleSystem, "not fulfilled in time")
+		if errors.Is(err, repository.ErrRedemptionChanged) || errors.Is(err, ErrCodeRevealed) {
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func (s *RewardService) ListRedemptions(status string, limit int) ([]models.Redemption, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.rewards.ListRedemptions(status, limit)
+}
+
+func (s *RewardService) transition(redemption *models.Redemption, to string, actorID uint, role, note string) error {
+	if !transitionAllowed(redemption.Status, to, role) {
+		return ErrInvalidTransition
+	}
+	event := models.RedemptionEvent{
+		ToStatus:  to,
+		ActorID:   actorID,
+		ActorRole: role,
+		Note:      strings.TrimSpace(note),
+	}
+	err := s.rewards.TransitionRedemption(redemption, event, refundedStatuses[to])
+	if errors.Is(err, repository.ErrVoucherRevealed) {
+		return ErrCodeRevealed
+	}
+	return err
+}
+
+func transitionAllowed(from, to, role string) bool {
+	for _, allowed := range redemptionTransitions[from][to] {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestRedeemConcurrentLastUnit(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to access db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	service := NewRewardService(rewardRepo, userRepo)
+
+	reward := &models.Reward{Name: "Last Ticket", PointsCost: 100, Inventory: 1}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+
+	const workers = 200
+	users := make([]*models.User, workers)
+	for i := range users {
+		users[i] = &models.User{Username: fmt.Sprintf("racer-%d", i), Email: fmt.Sprintf("racer-%d@example.com", i), Password: "secret", Points: 150}
+		if err := userRepo.Create(users[i]); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	start := make(chan struct{})
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, _, errs[i] = service.Redeem(users[i].ID, reward.ID)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	winners := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			winners++
+		case !errors.Is(err, repository.ErrRewardUnavailable):
+			t.Fatalf("worker %d: unexpected error: %v", i, err)
+		}
+	}
+	if winners != 1 {
+		t.Fatalf("expected exactly one successful redemption, got %d", winners)
+	}
+
+	stored, err := rewardRepo.FindByID(reward.ID)
+	if err != nil {
+		t.Fatalf("failed to load reward: %v", err)
+	}
+	if stored.Inventory != 0 {
+		t.Fatalf("expected inventory to be exhausted, got %d", stored.Inventory)
+	}
+
+	var redemptions, charged int64
+	db.Model(&models.Redemption{}).Where("reward_id = ?", reward.ID).Count(&redemptions)
+	db.Model(&models.User{}).Where("username LIKE ? AND points < ?", "racer-%", 150).Count(&charged)
+	if redemptions != 1 || charged != 1 {
+		t.Fatalf("expected one redemption and one charged user, got %d and %d", redemptions, charged)
+	}
+}
+
+func TestRedeemInsufficientPointsKeepsInventory(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	service := NewRewardService(rewardRepo, userRepo)
+
+	reward := &models.Reward{Name: "Pricey", PointsCost: 500, Inventory: 1}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+	user := &models.User{Username: "ivan", Email: "ivan@example.com", Password: "secret", Points: 100}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if _, _, err := service.Redeem(user.ID, reward.ID); !errors.Is(err, repository.ErrInsufficientPoints) {
+		t.Fatalf("expected insufficient points error, got %v", err)
+	}
+
+	stored, err := rewardRepo.FindByID(reward.ID)
+	if err != nil {
+		t.Fatalf("failed to load reward: %v", err)
+	}
+	if stored.Inventory != 1 {
+		t.Fatalf("expected inventory to be restored, got %d", stored.Inventory)
+	}
+	history, err := userRepo.PointsHistory(user.ID, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("expected no points history, got %+v", history)
+	}
+}
+
+func TestRedemptionLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	service := NewRewardService(rewardRepo, userRepo)
+
+	reward := &models.Reward{Name: "Museum Pass", PointsCost: 100, Inventory: 5}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+	user := &models.User{Username: "judy", Email: "judy@example.com", Password: "secret", Points: 1000}
+	admin := &models.User{Username: "judge", Email: "judge@example.com", Password: "secret", Role: models.RoleAdmin}
+	for _, u := range []*models.User{user, admin} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	redeem := func() *models.Redemption {
+		redemption, _, err := service.Redeem(user.ID, reward.ID)
+		if err != nil {
+			t.Fatalf("failed to redeem: %v", err)
+		}
+		return redemption
+	}
+	points := func() int64 {
+		u, err := userRepo.FindByID(user.ID)
+		if err != nil {
+			t.Fatalf("failed to load user: %v", err)
+		}
+		return u.Points
+	}
+	inventory := func() int {
+		r, err := rewardRepo.FindByID(reward.ID)
+		if err != nil {
+			t.Fatalf("failed to load reward: %v", err)
+		}
+		return r.Inventory
+	}
+
+	cancelled := redeem()
+	if _, err := service.Cancel(admin.ID, cancelled.ID, ""); !errors.Is(err, ErrRedemptionNotFound) {
+		t.Fatalf("expected other users to be unable to cancel, got %v", err)
+	}
+	if _, err := service.Cancel(user.ID, cancelled.ID, "changed my mind"); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if points() != 1000 || inventory() != 5 {
+		t.Fatalf("expected cancellation to refund, got %d points and %d inventory", points(), inventory())
+	}
+
+	fulfilled := redeem()
+	if _, err := service.Transition(admin.ID, fulfilled.ID, models.RedemptionFulfilled, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected pending redemption not to be fulfilled directly, got %v", err)
+	}
+	if _, err := service.Transition(admin.ID, fulfilled.ID, models.RedemptionApproved, ""); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	if _, err := service.Cancel(user.ID, fulfilled.ID, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected approved redemption not to be cancellable by the user, got %v", err)
+	}
+	if _, err := service.Transition(admin.ID, fulfilled.ID, models.RedemptionFulfilled, "shipped"); err != nil {
+		t.Fatalf("failed to fulfill: %v", err)
+	}
+	if _, err := service.Transition(admin.ID, fulfilled.ID, models.RedemptionRejected, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected fulfilled redemption to be final, got %v", err)
+	}
+
+	rejected := redeem()
+	if _, err := service.Transition(admin.ID, rejected.ID, models.RedemptionRejected, "out of region"); err != nil {
+		t.Fatalf("failed to reject: %v", err)
+	}
+
+	stale := redeem()
+	if err := db.Model(&models.Redemption{}).Where("id = ?", stale.ID).Update("created_at", time.Now().Add(-48*time.Hour)).Error; err != nil {
+		t.Fatalf("failed to age redemption: %v", err)
+	}
+	expired, err := service.ExpireStale(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("failed to expire: %v", err)
+	}
+	if expired != 1 {
+		t.Fatalf("expected one expired redemption, got %d", expired)
+	}
+
+	if points() != 900 || inventory() != 4 {
+		t.Fatalf("expected only the fulfilled redemption to be charged, got %d points and %d inventory", points(), inventory())
+	}
+
+	timeline, err := rewardRepo.FindRedemption(fulfilled.ID)
+	if err != nil {
+		t.Fatalf("failed to load redemption: %v", err)
+	}
+	var statuses []string
+	for _, e := range timeline.History {
+		statuses = append(statuses, e.ToStatus)
+	}
+	if got := strings.Join(statuses, ","); got != "pending,approved,fulfilled" {
+		t.Fatalf("unexpected timeline %s", got)
+	}
+}
+
+func TestRedeemEnforcesEligibilityRules(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	service := NewRewardService(rewardRepo, userRepo)
+
+	user := &models.User{Username: "leo", Email: "leo@example.com", Password: "secret", Points: 1000, Level: 1, Region: "JP"}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	cases := []struct {
+		reward models.Reward
+		err    error
+	}{
+		{models.Reward{Name: "Elite", PointsCost: 10, Inventory: 5, MinLevel: 3}, ErrLevelTooLow},
+		{models.Reward{Name: "Soon", PointsCost: 10, Inventory: 5, StartsAt: &future}, ErrRewardNotStarted},
+		{models.Reward{Name: "Gone", PointsCost: 10, Inventory: 5, EndsAt: &past}, ErrRewardEnded},
+		{models.Reward{Name: "Korea Only", PointsCost: 10, Inventory: 5, Regions: "KR"}, ErrRegionRestricted},
+		{models.Reward{Name: "Asia", PointsCost: 10, Inventory: 5, Regions: "KR,JP", StartsAt: &past, EndsAt: &future, MinLevel: 1}, nil},
+	}
+	for _, c := range cases {
+		reward := c.reward
+		if err := rewardRepo.Create(&reward); err != nil {
+			t.Fatalf("failed to create reward: %v", err)
+		}
+		if _, _, err := service.Redeem(user.ID, reward.ID); !errors.Is(err, c.err) {
+			t.Fatalf("%s: expected %v, got %v", reward.Name, c.err, err)
+		}
+	}
+
+	limited := &models.Reward{Name: "Once", PointsCost: 10, Inventory: 5, MaxPerUser: 1}
+	if err := rewardRepo.Create(limited); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+	first, _, err := service.Redeem(user.ID, limited.ID)
+	if err != nil {
+		t.Fatalf("failed to redeem: %v", err)
+	}
+	if _, _, err := service.Redeem(user.ID, limited.ID); !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("expected limit to be reached, got %v", err)
+	}
+
+	listings, err := service.ListRewardsFor(user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, l := range listings {
+		if l.ID == limited.ID && (l.Eligible == nil || *l.Eligible || strings.Join(l.IneligibleReasons, ",") != EligibilityLimitReached) {
+			t.Fatalf("expected listing to explain the limit, got %+v", l)
+		}
+	}
+
+	if _, err := service.Cancel(user.ID, first.ID, ""); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	if _, _, err := service.Redeem(user.ID, limited.ID); err != nil {
+		t.Fatalf("expected cancelled redemption not to count against the limit, got %v", err)
+	}
+
+	anonymous, err := service.ListRewardsFor(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, l := range anonymous {
+		if l.Eligible != nil {
+			t.Fatalf("expected anonymous listing without eligibility, got %+v", l)
+		}
+	}
+}
+
+func TestBrowseRewardsFiltersSortsAndPages(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	service := NewRewardService(rewardRepo, userRepo)
+	catalog := NewCatalogService(rewardRepo, config.Config{UploadDir: t.TempDir()})
+
+	inputs := []RewardInput{
+		{Name: "Ramen Voucher", PointsCost: 50, Inventory: 10, Publish: true, Category: "Browse-Food", Tags: "Tokyo, noodles"},
+		{Name: "Sushi Dinner", PointsCost: 300, Inventory: 10, Publish: true, Category: "browse-food", Tags: "tokyo"},
+		{Name: "Street Snacks", PointsCost: 20, Inventory: 10, Publish: true, Category: "browse-food", Tags: "osaka"},
+		{Name: "Hidden Tasting", PointsCost: 10, Inventory: 10, Category: "browse-food"},
+	}
+	created := make([]*models.Reward, len(inputs))
+	for i, input := range inputs {
+		reward, err := catalog.Create(1, input)
+		if err != nil {
+			t.Fatalf("failed to create reward: %v", err)
+		}
+		created[i] = reward
+	}
+
+	user := &models.User{Username: "browser", Email: "browser@example.com", Password: "secret", Points: 700}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := service.Redeem(user.ID, created[1].ID); err != nil {
+			t.Fatalf("redeem failed: %v", err)
+		}
+	}
+	if _, _, err := service.Redeem(user.ID, created[2].ID); err != nil {
+		t.Fatalf("redeem failed: %v", err)
+	}
+	names := func(listings []RewardListing) string {
+		var out []string
+		for _, l := range listings {
+			out = append(out, l.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	listings, total, err := service.BrowseRewards(0, CatalogQuery{Category: "browse-food", Sort: "cost_asc"})
+	if err != nil {
+		t.Fatalf("browse failed: %v", err)
+	}
+	if total != 3 || names(listings) != "Street Snacks,Ramen Voucher,Sushi Dinner" {
+		t.Fatalf("unexpected cost order (%d): %s", total, names(listings))
+	}
+
+	listings, _, err = service.BrowseRewards(0, CatalogQuery{Category: "browse-food", Sort: "popularity"})
+	if err != nil {
+		t.Fatalf("browse failed: %v", err)
+	}
+	if names(listings) != "Sushi Dinner,Street Snacks,Ramen Voucher" || listings[0].RedemptionCount != 2 {
+		t.Fatalf("unexpected popularity order: %s (%d)", names(listings), listings[0].RedemptionCount)
+	}
+
+	listings, total, err = service.BrowseRewards(0, CatalogQuery{Category: "browse-food", Tag: "TOKYO", Sort: "newest", Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("browse failed: %v", err)
+	}
+	if total != 2 || names(listings) != "Ramen Voucher" {
+		t.Fatalf("unexpected tag page (%d): %s", total, names(listings))
+	}
+
+	listings, _, err = service.BrowseRewards(0, CatalogQuery{Category: "browse-food", Search: "snack"})
+	if err != nil || names(listings) != "Street Snacks" {
+		t.Fatalf("unexpected search result: %s (%v)", names(listings), err)
+	}
+	// Wildcards in the search term match literally.
+	for _, term := range []string{"%", "_", "s%s"} {
+		listings, _, err = service.BrowseRewards(0, CatalogQuery{Category: "browse-food", Search: term})
+		if err != nil || len(listings) != 0 {
+			t.Fatalf("expected %q to match nothing, got %s (%v)", term, names(listings), err)
+		}
+	}
+
+	// 80 points are left after the three redemptions.
+	listings, _, err = service.BrowseRewards(user.ID, CatalogQuery{Category: "browse-food", Affordable: true, Sort: "cost_asc"})
+	if err != nil {
+		t.Fatalf("browse failed: %v", err)
+	}
+	if names(listings) != "Street Snacks,Ramen Voucher" || listings[0].Eligible == nil || !*listings[0].Eligible {
+		t.Fatalf("unexpected affordable listings: %s", names(listings))
+	}
+
+	if _, _, err := service.BrowseRewards(0, CatalogQuery{Affordable: true}); !errors.Is(err, ErrAffordableNeedsUser) {
+		t.Fatalf("expected anonymous affordable filter to fail, got %v", err)
+	}
+	if _, _, err := service.BrowseRewards(0, CatalogQuery{Sort: "random"}); !errors.Is(err, ErrInvalidSort) {
+		t.Fatalf("expected invalid sort error, got %v", err)
+	}
+}
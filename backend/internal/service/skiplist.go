@@ -0,0 +1,137 @@
+package service
+
+import "math/rand"
+
+const (
+	skiplistMaxLevel = 32
+	skiplistP        = 0.25
+)
+
+// skiplist keeps board members in rank order. Like a Redis sorted set, every
+// link records how many members it skips, so inserts, removals, rank lookups
+// and jumps to a position all take O(log n).
+type skiplist struct {
+	head   *skiplistNode
+	level  int
+	length int
+}
+
+type skiplistNode struct {
+	member boardMember
+	next   []skiplistLink
+}
+
+// skiplistLink points to the next node on a level. span is the number of
+// positions it advances: the members it skips plus the one it lands on.
+type skiplistLink struct {
+	node *skiplistNode
+	span int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{head: &skiplistNode{next: make([]skiplistLink, skiplistMaxLevel)}, level: 1}
+}
+
+func randomSkiplistLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP {
+		level++
+	}
+	return level
+}
+
+func (l *skiplist) insert(m boardMember) {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && x.next[i].node.member.before(m) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	level := randomSkiplistLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+			update[i].next[i].span = l.length
+		}
+		l.level = level
+	}
+	n := &skiplistNode{member: m, next: make([]skiplistLink, level)}
+	for i := 0; i < level; i++ {
+		n.next[i].node = update[i].next[i].node
+		update[i].next[i].node = n
+		n.next[i].span = update[i].next[i].span - (rank[0] - rank[i])
+		update[i].next[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < l.level; i++ {
+		update[i].next[i].span++
+	}
+	l.length++
+}
+
+func (l *skiplist) remove(m boardMember) {
+	var update [skiplistMaxLevel]*skiplistNode
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.member.before(m) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	x = x.next[0].node
+	if x == nil || x.member.userID != m.userID {
+		return
+	}
+	for i := 0; i < l.level; i++ {
+		if update[i].next[i].node == x {
+			update[i].next[i].span += x.next[i].span - 1
+			update[i].next[i].node = x.next[i].node
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1].node == nil {
+		l.level--
+	}
+	l.length--
+}
+
+// count returns how many members come before the first one for which stop
+// is true. stop must be false for a prefix of the list and true after it.
+func (l *skiplist) count(stop func(boardMember) bool) int {
+	n := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && !stop(x.next[i].node.member) {
+			n += x.next[i].span
+			x = x.next[i].node
+		}
+	}
+	return n
+}
+
+// at returns the node at 0-based position i, or nil past the end.
+func (l *skiplist) at(i int) *skiplistNode {
+	if i < 0 || i >= l.length {
+		return nil
+	}
+	traversed := 0
+	x := l.head
+	for level := l.level - 1; level >= 0; level-- {
+		for x.next[level].node != nil && traversed+x.next[level].span <= i+1 {
+			traversed += x.next[level].span
+			x = x.next[level].node
+		}
+		if traversed == i+1 {
+			return x
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"time"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+const (
+	streakBonusPerDay int64 = 5
+	streakBonusMax    int64 = 50
+	dayLayout               = "2006-01-02"
+)
+
+type StreakService struct {
+	trips       *repository.TripRepository
+	users       *repository.UserRepository
+	leaderboard Leaderboard
+}
+
+type StreakSummary struct {
+	Timezone      string `json:"timezone"`
+	Current       int    `json:"current"`
+	Longest       int    `json:"longest"`
+	LastActiveDay string `json:"last_active_day,omitempty"`
+	ActiveToday   bool   `json:"active_today"`
+	NextBonus     int64  `json:"next_bonus"`
+}
+
+type ActivityDay struct {
+	Date     string `json:"date"`
+	Posted   int    `json:"posted"`
+	Verified int    `json:"verified"`
+	Visited  int    `json:"visited"`
+}
+
+type ActivityCalendar struct {
+	Timezone string        `json:"timezone"`
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Days     []ActivityDay `json:"days"`
+}
+
+func NewStreakService(trips *repository.TripRepository, users *repository.UserRepository, lb Leaderboard) *StreakService {
+	return &StreakService{trips: trips, users: users, leaderboard: lb}
+}
+
+// Summary reports the user's current and longest streak of consecutive days
+// with at least one verified trip, using the user's timezone for day
+// boundaries.
+func (s *StreakService) Summary(userID uint) (*StreakSummary, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	loc := userLocation(user)
+
+	times, err := s.trips.VerifiedPostTimes(userID)
+	if err != nil {
+		return nil, err
+	}
+	days := activeDays(times, loc)
+	today := localDay(time.Now(), loc)
+
+	summary := &StreakSummary{
+		Timezone: loc.String(),
+		Current:  currentStreak(days, today),
+		Longest:  longestRun(days),
+	}
+	if len(days) > 0 {
+		last := days[len(days)-1]
+		summary.LastActiveDay = last.Format(dayLayout)
+		summary.ActiveToday = last.Equal(today)
+	}
+	summary.NextBonus = streakBonus(summary.Current + 1)
+	return summary, nil
+}
+
+// Calendar returns one entry per day for the given year, or for the trailing
+// 365 days when year is zero. Posted and Verified count trips by CreatedAt,
+// Visited counts trips by VisitedAt.
+func (s *StreakService) Calendar(userID uint, year int) (*ActivityCalendar, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	loc := userLocation(user)
+
+	var from, to time.Time
+	if year > 0 {
+		from = time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+		to = from.AddDate(1, 0, 0)
+	} else {
+		now := time.Now().In(loc)
+		to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+		from = to.AddDate(0, 0, -365)
+	}
+
+	activity, err := s.trips.ActivityByUser(userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	var days []ActivityDay
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		key := d.Format(dayLayout)
+		index[key] = len(days)
+		days = append(days, ActivityDay{Date: key})
+	}
+
+	for _, a := range activity {
+		if i, ok := index[a.CreatedAt.In(loc).Format(dayLayout)]; ok {
+			days[i].Posted++
+			if a.Verified {
+				days[i].Verified++
+			}
+		}
+		if i, ok := index[a.VisitedAt.In(loc).Format(dayLayout)]; ok {
+			days[i].Visited++
+		}
+	}
+
+	return &ActivityCalendar{
+		Timezone: loc.String(),
+		From:     from.Format(dayLayout),
+		To:       to.AddDate(0, 0, -1).Format(dayLayout),
+		Days:     days,
+	}, nil
+}
+
+// TripCreated awards a streak bonus for the first verified trip of a day that
+// extends a streak of at least two days.
+func (s *StreakService) TripCreated(user *models.User, trip *models.TripPost) error {
+	if !trip.Verified {
+		return nil
+	}
+	loc := userLocation(user)
+
+	times, err := s.trips.VerifiedPostTimes(user.ID)
+	if err != nil {
+		return err
+	}
+
+	today := localDay(trip.CreatedAt, loc)
+	postsToday := 0
+	for _, t := range times {
+		if localDay(t, loc).Equal(today) {
+			postsToday++
+		}
+	}
+	if postsToday != 1 {
+		return nil
+	}
+
+	bonus := streakBonus(currentStreak(activeDays(times, loc), today))
+	if bonus == 0 {
+		return nil
+	}
+
+	updated, err := s.users.AddPoints(user.ID, bonus, "streak_bonus")
+	if err != nil {
+		return err
+	}
+	if s.leaderboard != nil {
+		if err := s.leaderboard.AddScore(updated.ID, updated.Points); err != nil {
+			return err
+		}
+		return recordEarned(s.leaderboard, updated.ID, bonus, time.Now())
+	}
+	return nil
+}
+
+// streakBonus returns the bonus for reaching the given streak length. The
+// first day of a streak earns nothing, every following day earns
+// streakBonusPerDay more, capped at streakBonusMax.
+func streakBonus(streak int) int64 {
+	if streak < 2 {
+		return 0
+	}
+	bonus := int64(streak-1) * streakBonusPerDay
+	if bonus > streakBonusMax {
+		bonus = streakBonusMax
+	}
+	return bonus
+}
+
+func userLocation(user *models.User) *time.Location {
+	if user.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localDay maps t to midnight UTC of its calendar day in loc so days from
+// different locations can be compared and stepped with AddDate.
+func localDay(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// activeDays returns the distinct local days of the sorted timestamps.
+func activeDays(times []time.Time, loc *time.Location) []time.Time {
+	var days []time.Time
+	for _, t := range times {
+		day := localDay(t, loc)
+		if len(days) > 0 && days[len(days)-1].Equal(day) {
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+func longestRun(days []time.Time) int {
+	longest, current := 0, 0
+	for i, day := range days {
+		if i > 0 && day.Equal(days[i-1].AddDate(0, 0, 1)) {
+			current++
+		} else {
+			current = 1
+		}
+		if current > longest {
+			longest = current
+		}
+	}
+	return longest
+}
+
+// currentStreak returns the length of the run ending today, or yesterday when
+// the user has not been active yet today.
+func currentStreak(days []time.Time, today time.Time) int {
+	if len(days) == 0 {
+		return 0
+	}
+	end := len(days) - 1
+	last := days[end]
+	if !last.Equal(today) && !last.Equal(today.AddDate(0, 0, -1)) {
+		return 0
+	}
+	streak := 1
+	for i := end; i > 0 && days[i-1].Equal(days[i].AddDate(0, 0, -1)); i-- {
+		streak++
+	}
+	return streak
+}
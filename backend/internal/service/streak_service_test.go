@@ -0,0 +1,102 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestStreakRuns(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2024, 3, d, h, 0, 0, 0, time.UTC) }
+	times := []time.Time{day(1, 9), day(1, 20), day(2, 8), day(4, 10), day(5, 10), day(6, 10), day(8, 10)}
+	days := activeDays(times, time.UTC)
+	if got := longestRun(days); got != 3 {
+		t.Fatalf("expected longest streak of 3, got %d", got)
+	}
+	if got := currentStreak(days, localDay(day(8, 0), time.UTC)); got != 1 {
+		t.Fatalf("expected current streak of 1, got %d", got)
+	}
+	if got := currentStreak(days[:5], localDay(day(7, 0), time.UTC)); got != 3 {
+		t.Fatalf("expected streak ending yesterday to count, got %d", got)
+	}
+	if got := currentStreak(days, localDay(day(10, 0), time.UTC)); got != 0 {
+		t.Fatalf("expected broken streak, got %d", got)
+	}
+
+	// 20:00 UTC is already the next day in Tokyo.
+	tokyo := time.FixedZone("JST", 9*3600)
+	times = []time.Time{day(1, 10), day(1, 20), day(2, 20)}
+	if got := longestRun(activeDays(times, time.UTC)); got != 2 {
+		t.Fatalf("expected streak of 2 in UTC, got %d", got)
+	}
+	if got := longestRun(activeDays(times, tokyo)); got != 3 {
+		t.Fatalf("expected streak of 3 in Tokyo, got %d", got)
+	}
+}
+
+func TestStreakBonusAwardedOncePerDay(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tripRepo := repository.NewTripRepository(db)
+	lb := NewMemoryLeaderboard()
+	streaks := NewStreakService(tripRepo, userRepo, lb)
+	trips := NewTripService(tripRepo, userRepo, lb, config.Config{})
+	trips.AddListener(streaks)
+
+	user := &models.User{Username: "streaker", Email: "streaker@example.com", Password: "secret"}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	for i := 2; i >= 1; i-- {
+		past := models.TripPost{UserID: user.ID, Title: "Past", Verified: true, CreatedAt: time.Now().AddDate(0, 0, -i), VisitedAt: time.Now().AddDate(0, 0, -i)}
+		if err := db.Create(&past).Error; err != nil {
+			t.Fatalf("failed to seed trip: %v", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := trips.CreateTrip(verifiedTripInput(user.ID, "Japan", time.Now())); err != nil {
+			t.Fatalf("failed to create trip: %v", err)
+		}
+	}
+
+	history, err := userRepo.PointsHistory(user.ID, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bonuses := 0
+	for _, h := range history {
+		if h.Reason == "streak_bonus" {
+			bonuses++
+			if h.Delta != 2*streakBonusPerDay {
+				t.Fatalf("expected bonus of %d, got %d", 2*streakBonusPerDay, h.Delta)
+			}
+		}
+	}
+	if bonuses != 1 {
+		t.Fatalf("expected exactly one streak bonus, got %d", bonuses)
+	}
+
+	summary, err := streaks.Summary(user.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary.Current != 3 || !summary.ActiveToday {
+		t.Fatalf("expected active streak of 3, got %+v", summary)
+	}
+
+	calendar, err := streaks.Calendar(user.ID, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(calendar.Days) != 365 {
+		t.Fatalf("expected 365 calendar days, got %d", len(calendar.Days))
+	}
+	if today := calendar.Days[len(calendar.Days)-1]; today.Posted != 2 || today.Verified != 2 {
+		t.Fatalf("expected two posts today, got %+v", today)
+	}
+}
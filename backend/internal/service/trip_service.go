@@ -5,10 +5,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"log"
 	"math"
 	"strings"
 	"time"
 
+	"github.com/example/solo_journey/internal/config"
 	"github.com/example/solo_journey/internal/models"
 	"github.com/example/solo_journey/internal/repository"
 )
@@ -17,16 +19,66 @@ type TripService struct {
 	trips       *repository.TripRepository
 	users       *repository.UserRepository
 	leaderboard Leaderboard
+	limits      config.Config
+	listeners   []TripListener
 }
 
+// Limits reported in models.PointsAward when an award was reduced.
+const (
+	LimitRepeatLocation = "repeat_location"
+	LimitCooldown       = "cooldown"
+	LimitDailyCap       = "daily_cap"
+	LimitWeeklyCap      = "weekly_cap"
+)
+
+const (
+	repeatLocationWindow = 30 * 24 * time.Hour
+	repeatLocationDecay  = 0.5
+)
+
+// Leaderboard ranks users by points. Users with equal points share a rank and
+// are listed in the order they reached the score.
 type Leaderboard interface {
 	AddScore(userID uint, score int64) error
+	// AddScoreAt is AddScore for a score that was reached at the given time.
+	AddScoreAt(userID uint, score int64, at time.Time) error
 	Top(limit int) ([]LeaderboardEntry, error)
+	// Scores returns every member's score; Remove drops a member. Both are
+	// used to reconcile the board with the database.
+	Scores() (map[uint]int64, error)
+	Remove(userID uint) error
+	// Rank returns the user's 1-based shared rank and score; ok is false
+	// when the user is not on the board.
+	Rank(userID uint) (rank int64, score int64, ok bool, err error)
+	// Around returns the user's entry with up to n entries above and below
+	// it, or nothing when the user is not on the board.
+	Around(userID uint, n int) ([]LeaderboardEntry, error)
+	// TopAmong ranks only the given users, e.g. a user and whom they
+	// follow.
+	TopAmong(userIDs []uint, limit int) ([]LeaderboardEntry, error)
+
+	// Named boards, such as the windowed boards, accumulate the points
+	// earned rather than holding totals.
+	IncrBy(board string, userID uint, delta int64) error
+	TopOn(board string, limit int) ([]LeaderboardEntry, error)
+	// Replace swaps a named board's contents; Clear deletes it.
+	Replace(board string, scores []repository.UserScore) error
+	Clear(board string) error
+}
+
+// TripListener is notified after a trip has been stored and its points
+// awarded.
+type TripListener interface {
+	TripCreated(user *models.User, trip *models.TripPost) error
 }
 
 type LeaderboardEntry struct {
-	UserID uint  `json:"user_id"`
-	Points int64 `json:"points"`
+	UserID    uint   `json:"user_id"`
+	Points    int64  `json:"points"`
+	Rank      int64  `json:"rank,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Level     int    `json:"level,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
 }
 
 type mediaMetadata struct {
@@ -37,8 +89,12 @@ type mediaMetadata struct {
 	Signature  string    `json:"signature"`
 }
 
-func NewTripService(trips *repository.TripRepository, users *repository.UserRepository, lb Leaderboard) *TripService {
-	return &TripService{trips: trips, users: users, leaderboard: lb}
+func NewTripService(trips *repository.TripRepository, users *repository.UserRepository, lb Leaderboard, cfg config.Config) *TripService {
+	return &TripService{trips: trips, users: users, leaderboard: lb, limits: cfg}
+}
+
+func (s *TripService) AddListener(l TripListener) {
+	s.listeners = append(s.listeners, l)
 }
 
 type CreateTripInput struct {
@@ -46,6 +102,7 @@ type CreateTripInput struct {
 	Title       string         `json:"title"`
 	Description string         `json:"description"`
 	Location    string         `json:"location"`
+	Country     string         `json:"country"`
 	VisitedAt   time.Time      `json:"visited_at"`
 	Media       []models.Media `json:"media"`
 }
@@ -85,6 +142,7 @@ func (s *TripService) CreateTrip(input CreateTripInput) (*models.TripPost, error
 		Title:       strings.TrimSpace(input.Title),
 		Description: strings.TrimSpace(input.Description),
 		Location:    strings.TrimSpace(input.Location),
+		Country:     normalizeCountry(input.Country, input.Location),
 		VisitedAt:   input.VisitedAt,
 		Media:       input.Media,
 		Verified:    verified,
@@ -97,9 +155,6 @@ func (s *TripService) CreateTrip(input CreateTripInput) (*models.TripPost, error
 
 	trip.Verified = verified
 	trip.Score = math.Round(confidence*1000) / 10
-	if err := s.trips.Create(trip); err != nil {
-		return nil, err
-	}
 
 	bonus := int64(math.Round(confidence * 50))
 	points := int64(20) + bonus
@@ -107,19 +162,116 @@ func (s *TripService) CreateTrip(input CreateTripInput) (*models.TripPost, error
 		points += 20
 	}
 
-	user, err := s.users.IncrementPoints(trip.UserID, points)
+	user, err := s.users.FindByID(trip.UserID)
 	if err != nil {
 		return nil, err
 	}
 
-	if s.leaderboard != nil {
-		_ = s.leaderboard.AddScore(user.ID, user.Points)
+	// The caps are read and the award is granted in one transaction, so
+	// concurrent posts cannot both pass the same remaining allowance.
+	var award *models.PointsAward
+	user, err = s.trips.CreateAwarded(trip, func(trips *repository.TripRepository, users *repository.UserRepository) (int64, error) {
+		var err error
+		award, err = s.limitAward(trips, users, user, trip.Location, points, time.Now())
+		if err != nil {
+			return 0, err
+		}
+		return award.Awarded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	trip.Award = award
+
+	if award.Awarded > 0 {
+		if s.leaderboard != nil {
+			if err := s.leaderboard.AddScore(user.ID, user.Points); err != nil {
+				log.Printf("failed to update leaderboard for user %d: %v", user.ID, err)
+			}
+			if err := recordEarned(s.leaderboard, user.ID, award.Awarded, time.Now()); err != nil {
+				log.Printf("failed to update windowed leaderboards for user %d: %v", user.ID, err)
+			}
+			if trip.Country != "" {
+				if err := s.leaderboard.IncrBy(regionBoard(trip.Country), user.ID, award.Awarded); err != nil {
+					log.Printf("failed to update %s leaderboard for user %d: %v", trip.Country, user.ID, err)
+				}
+			}
+		}
 	}
 
 	trip.Media = input.Media
+	for _, l := range s.listeners {
+		if err := l.TripCreated(user, trip); err != nil {
+			log.Printf("trip listener failed for trip %d: %v", trip.ID, err)
+		}
+	}
 	return trip, nil
 }
 
+// limitAward applies the anti-farming rules to the base points of a new trip:
+// repeated posts at the same location within repeatLocationWindow earn
+// geometrically less, posts within the cooldown of the last award earn
+// nothing, and the remainder is clipped to the daily and weekly caps, measured
+// in the user's timezone. Earlier trips and awards are read through the given
+// repositories, which CreateTrip binds to the award transaction.
+func (s *TripService) limitAward(trips *repository.TripRepository, users *repository.UserRepository, user *models.User, location string, base int64, now time.Time) (*models.PointsAward, error) {
+	award := &models.PointsAward{Base: base, Awarded: base, LocationFactor: 1}
+
+	repeats, err := trips.CountByLocationSince(user.ID, strings.TrimSpace(location), now.Add(-repeatLocationWindow))
+	if err != nil {
+		return nil, err
+	}
+	if repeats > 0 {
+		award.LocationFactor = math.Pow(repeatLocationDecay, float64(repeats))
+		award.Awarded = int64(math.Round(float64(base) * award.LocationFactor))
+		award.Limits = append(award.Limits, LimitRepeatLocation)
+	}
+
+	if s.limits.AwardCooldown > 0 {
+		last, err := users.LastEarnedAt(user.ID, "activity")
+		if err != nil {
+			return nil, err
+		}
+		if !last.IsZero() && now.Sub(last) < s.limits.AwardCooldown {
+			award.Awarded = 0
+			award.Limits = append(award.Limits, LimitCooldown)
+			return award, nil
+		}
+	}
+
+	loc := userLocation(user)
+	local := now.In(loc)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	weekStart := dayStart.AddDate(0, 0, -((int(dayStart.Weekday()) + 6) % 7))
+
+	caps := []struct {
+		limit int64
+		since time.Time
+		name  string
+	}{
+		{s.limits.PointsDailyCap, dayStart, LimitDailyCap},
+		{s.limits.PointsWeeklyCap, weekStart, LimitWeeklyCap},
+	}
+	for _, c := range caps {
+		if c.limit <= 0 || award.Awarded == 0 {
+			continue
+		}
+		earned, err := users.EarnedSince(user.ID, "activity", c.since)
+		if err != nil {
+			return nil, err
+		}
+		remaining := c.limit - earned
+		if remaining < 0 {
+			remaining = 0
+		}
+		if award.Awarded > remaining {
+			award.Awarded = remaining
+			award.Limits = append(award.Limits, c.name)
+		}
+	}
+	return award, nil
+}
+
 func (s *TripService) ListTrips(limit int) ([]models.TripPost, error) {
 	if limit <= 0 {
 		limit = 20
@@ -138,7 +290,102 @@ func (s *TripService) Leaderboard(limit int) ([]LeaderboardEntry, error) {
 	if limit <= 0 {
 		limit = 10
 	}
-	return s.leaderboard.Top(limit)
+	entries, err := s.leaderboard.Top(limit)
+	if err != nil {
+		return nil, err
+	}
+	return entries, hydrateEntries(s.users, entries)
+}
+
+// regionBoard names the board of the points earned with trips in a country.
+func regionBoard(country string) string {
+	return "region:" + country
+}
+
+// RegionalLeaderboard ranks the users by the points their trips in the given
+// country earned.
+func (s *TripService) RegionalLeaderboard(region string, limit int) ([]LeaderboardEntry, error) {
+	if s.leaderboard == nil {
+		return nil, errors.New("leaderboard not configured")
+	}
+	code := countryCode(region)
+	if code == "" {
+		return nil, ErrUnknownCountry
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	entries, err := s.leaderboard.TopOn(regionBoard(code), limit)
+	if err != nil {
+		return nil, err
+	}
+	return entries, hydrateEntries(s.users, entries)
+}
+
+// maxLeaderboardWindow caps how many neighbours are returned on each side of
+// the user.
+const maxLeaderboardWindow = 50
+
+// LeaderboardPosition is where a user stands on the leaderboard together with
+// the users ranked just above and below.
+type LeaderboardPosition struct {
+	Rank    int64              `json:"rank"`
+	Points  int64              `json:"points"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// LeaderboardPosition returns the user's rank and up to window neighbours on
+// each side. Users missing from the board, e.g. because they have not earned
+// points since signing up, are added with their current balance first.
+func (s *TripService) LeaderboardPosition(userID uint, window int) (*LeaderboardPosition, error) {
+	if s.leaderboard == nil {
+		return nil, errors.New("leaderboard not configured")
+	}
+	if window <= 0 {
+		window = 5
+	}
+	if window > maxLeaderboardWindow {
+		window = maxLeaderboardWindow
+	}
+
+	rank, points, ok, err := s.leaderboard.Rank(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		user, err := s.users.FindByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.leaderboard.AddScore(user.ID, user.Points); err != nil {
+			return nil, err
+		}
+		if rank, points, _, err = s.leaderboard.Rank(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := s.leaderboard.Around(userID, window)
+	if err != nil {
+		return nil, err
+	}
+	if err := hydrateEntries(s.users, entries); err != nil {
+		return nil, err
+	}
+	return &LeaderboardPosition{Rank: rank, Points: points, Entries: entries}, nil
+}
+
+// normalizeCountry returns the ISO 3166-1 alpha-2 code of a trip's country.
+// When no country is given explicitly the last comma separated part of the
+// location is used, so "Kyoto, Japan" becomes "JP". Countries that are not
+// recognised are left empty and count towards no regional board.
+func normalizeCountry(country, location string) string {
+	country = strings.TrimSpace(country)
+	if country == "" {
+		parts := strings.Split(location, ",")
+		country = parts[len(parts)-1]
+	}
+	return countryCode(country)
 }
 
 func isValidChecksum(value string) bool {
@@ -2,9 +2,12 @@ package service
 
 import (
 	"encoding/json"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/example/solo_journey/internal/config"
 	"github.com/example/solo_journey/internal/models"
 	"github.com/example/solo_journey/internal/repository"
 	"gorm.io/driver/sqlite"
@@ -16,7 +19,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("failed to open db: %v", err)
 	}
-	if err := db.AutoMigrate(&models.User{}, &models.TripPost{}, &models.Media{}, &models.PointsHistory{}, &models.Reward{}, &models.Redemption{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.TripPost{}, &models.Media{}, &models.PointsHistory{}, &models.Reward{}, &models.RewardStockEvent{}, &models.Redemption{}, &models.RedemptionEvent{}, &models.Badge{}, &models.UserBadge{}, &models.PointsAdjustment{}, &models.Referral{}, &models.VoucherCode{}, &models.IdempotencyRecord{}, &models.WebhookDelivery{}, &models.WishlistItem{}, &models.Notification{}, &models.Drop{}, &models.DropEntry{}, &models.LeaderboardStanding{}, &models.Follow{}, &models.RefreshToken{}, &models.RevokedTokenFamily{}, &models.Session{}); err != nil {
 		t.Fatalf("failed to migrate: %v", err)
 	}
 	return db
@@ -27,7 +30,7 @@ func TestCreateTripAwardsPoints(t *testing.T) {
 	userRepo := repository.NewUserRepository(db)
 	tripRepo := repository.NewTripRepository(db)
 	lb := NewMemoryLeaderboard()
-	service := NewTripService(tripRepo, userRepo, lb)
+	service := NewTripService(tripRepo, userRepo, lb, config.Config{})
 
 	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
 	if err := userRepo.Create(user); err != nil {
@@ -89,7 +92,7 @@ func TestCreateTripRejectsInvalidMedia(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repository.NewUserRepository(db)
 	tripRepo := repository.NewTripRepository(db)
-	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard())
+	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard(), config.Config{})
 
 	user := &models.User{Username: "bob", Email: "bob@example.com", Password: "secret"}
 	if err := userRepo.Create(user); err != nil {
@@ -117,7 +120,7 @@ func TestCreateTripRejectsInconsistentCaptureTime(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repository.NewUserRepository(db)
 	tripRepo := repository.NewTripRepository(db)
-	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard())
+	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard(), config.Config{})
 
 	user := &models.User{Username: "carol", Email: "carol@example.com", Password: "secret"}
 	if err := userRepo.Create(user); err != nil {
@@ -151,7 +154,7 @@ func TestCreateTripLowConfidenceNotVerified(t *testing.T) {
 	db := setupTestDB(t)
 	userRepo := repository.NewUserRepository(db)
 	tripRepo := repository.NewTripRepository(db)
-	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard())
+	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard(), config.Config{})
 
 	user := &models.User{Username: "dave", Email: "dave@example.com", Password: "secret"}
 	if err := userRepo.Create(user); err != nil {
@@ -196,3 +199,111 @@ func TestCreateTripLowConfidenceNotVerified(t *testing.T) {
 		t.Fatalf("expected 40 points awarded, got %d", updated.Points)
 	}
 }
+
+func TestCreateTripAppliesAwardLimits(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tripRepo := repository.NewTripRepository(db)
+	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard(), config.Config{PointsDailyCap: 100})
+
+	user := &models.User{Username: "farmer", Email: "farmer@example.com", Password: "secret"}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	expected := []struct {
+		country string
+		awarded int64
+		limits  []string
+	}{
+		{"Japan", 90, nil},
+		{"Japan", 10, []string{LimitRepeatLocation, LimitDailyCap}},
+		{"Korea", 0, []string{LimitDailyCap}},
+	}
+	for i, e := range expected {
+		trip, err := service.CreateTrip(verifiedTripInput(user.ID, e.country, time.Now()))
+		if err != nil {
+			t.Fatalf("trip %d: unexpected error: %v", i, err)
+		}
+		if trip.Award.Base != 90 || trip.Award.Awarded != e.awarded {
+			t.Fatalf("trip %d: expected 90 base and %d awarded, got %+v", i, e.awarded, trip.Award)
+		}
+		if strings.Join(trip.Award.Limits, ",") != strings.Join(e.limits, ",") {
+			t.Fatalf("trip %d: expected limits %v, got %v", i, e.limits, trip.Award.Limits)
+		}
+	}
+
+	updated, err := userRepo.FindByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to load user: %v", err)
+	}
+	if updated.Points != 100 {
+		t.Fatalf("expected points to stop at the daily cap, got %d", updated.Points)
+	}
+}
+
+func TestCreateTripCapsConcurrentPosts(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	userRepo := repository.NewUserRepository(db)
+	tripRepo := repository.NewTripRepository(db)
+	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard(), config.Config{PointsDailyCap: 100})
+
+	user := &models.User{Username: "swarm", Email: "swarm@example.com", Password: "secret"}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	countries := []string{"Japan", "Korea", "Chile", "Peru", "Kenya", "Nepal", "Egypt", "Spain", "Italy", "Ghana"}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(countries))
+	for _, country := range countries {
+		wg.Add(1)
+		go func(country string) {
+			defer wg.Done()
+			if _, err := service.CreateTrip(verifiedTripInput(user.ID, country, time.Now())); err != nil {
+				errs <- err
+			}
+		}(country)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	updated, err := userRepo.FindByID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to load user: %v", err)
+	}
+	if updated.Points != 100 {
+		t.Fatalf("expected concurrent posts to stop at the daily cap, got %d", updated.Points)
+	}
+}
+
+func TestCreateTripCooldown(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	tripRepo := repository.NewTripRepository(db)
+	service := NewTripService(tripRepo, userRepo, NewMemoryLeaderboard(), config.Config{AwardCooldown: time.Hour})
+
+	user := &models.User{Username: "hasty", Email: "hasty@example.com", Password: "secret"}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if _, err := service.CreateTrip(verifiedTripInput(user.ID, "Japan", time.Now())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trip, err := service.CreateTrip(verifiedTripInput(user.ID, "Korea", time.Now()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if trip.Award.Awarded != 0 || len(trip.Award.Limits) != 1 || trip.Award.Limits[0] != LimitCooldown {
+		t.Fatalf("expected cooldown to block the award, got %+v", trip.Award)
+	}
+}
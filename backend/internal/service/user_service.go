@@ -1,16 +1,22 @@
 package service
 
 import (
+	"errors"
 	"math"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/example/solo_journey/internal/models"
 	"github.com/example/solo_journey/internal/repository"
 )
 
 type UserService struct {
-	users   *repository.UserRepository
-	trips   *repository.TripRepository
-	rewards *repository.RewardRepository
+	users    *repository.UserRepository
+	trips    *repository.TripRepository
+	rewards  *repository.RewardRepository
+	badges   *repository.BadgeRepository
+	wishlist *repository.WishlistRepository
 }
 
 type Profile struct {
@@ -25,10 +31,23 @@ type Profile struct {
 	RecentHistory      []models.PointsHistory `json:"recent_history"`
 	RecentRedemptions  []models.Redemption    `json:"recent_redemptions"`
 	RecentTrips        []models.TripPost      `json:"recent_trips"`
+	Goal               *GoalProgress          `json:"goal,omitempty"`
 }
 
-func NewUserService(users *repository.UserRepository, trips *repository.TripRepository, rewards *repository.RewardRepository) *UserService {
-	return &UserService{users: users, trips: trips, rewards: rewards}
+// PublicProfile is the subset of a user's profile that is visible to other
+// users.
+type PublicProfile struct {
+	ID         uint               `json:"id"`
+	Username   string             `json:"username"`
+	Level      int                `json:"level"`
+	Points     int64              `json:"points"`
+	JoinedAt   time.Time          `json:"joined_at"`
+	TotalTrips int64              `json:"total_trips"`
+	Badges     []models.UserBadge `json:"badges"`
+}
+
+func NewUserService(users *repository.UserRepository, trips *repository.TripRepository, rewards *repository.RewardRepository, badges *repository.BadgeRepository, wishlist *repository.WishlistRepository) *UserService {
+	return &UserService{users: users, trips: trips, rewards: rewards, badges: badges, wishlist: wishlist}
 }
 
 func (s *UserService) Profile(userID uint) (*Profile, error) {
@@ -67,6 +86,15 @@ func (s *UserService) Profile(userID uint) (*Profile, error) {
 		return nil, err
 	}
 
+	goalItem, err := s.wishlist.FindGoal(userID)
+	if err != nil {
+		return nil, err
+	}
+	var goal *GoalProgress
+	if goalItem != nil {
+		goal = goalProgress(goalItem, user)
+	}
+
 	current, next, remaining := repository.LevelProgress(user.Points)
 	currentFloor := repository.LevelThreshold(current)
 	nextThreshold := repository.LevelThreshold(next)
@@ -83,9 +111,86 @@ func (s *UserService) Profile(userID uint) (*Profile, error) {
 		RecentHistory:      history,
 		RecentRedemptions:  redemptions,
 		RecentTrips:        recentTrips,
+		Goal:               goal,
+	}, nil
+}
+
+func (s *UserService) PublicProfile(userID uint) (*PublicProfile, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	totalTrips, err := s.trips.CountByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	badges, err := s.badges.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicProfile{
+		ID:         user.ID,
+		Username:   user.Username,
+		Level:      user.Level,
+		Points:     user.Points,
+		JoinedAt:   user.CreatedAt,
+		TotalTrips: totalTrips,
+		Badges:     badges,
 	}, nil
 }
 
+// SettingsInput holds the user settings to change. Nil fields are left as
+// they are.
+type SettingsInput struct {
+	Timezone  *string
+	Region    *string
+	AvatarURL *string
+}
+
+// UpdateSettings validates and stores the user's settings: the IANA timezone
+// used for day boundaries, the region used for reward eligibility and the
+// avatar shown on leaderboards.
+func (s *UserService) UpdateSettings(userID uint, input SettingsInput) (*models.User, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Timezone != nil {
+		if _, err := time.LoadLocation(*input.Timezone); err != nil || *input.Timezone == "" {
+			return nil, errors.New("invalid timezone")
+		}
+		user.Timezone = *input.Timezone
+	}
+	if input.Region != nil {
+		user.Region = strings.ToUpper(strings.TrimSpace(*input.Region))
+	}
+	if input.AvatarURL != nil {
+		avatar := strings.TrimSpace(*input.AvatarURL)
+		if avatar != "" {
+			parsed, err := url.Parse(avatar)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return nil, errors.New("avatar_url must be an http or https URL")
+			}
+		}
+		user.AvatarURL = avatar
+	}
+	if err := s.users.Update(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserService) IsAdmin(userID uint) (bool, error) {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return false, err
+	}
+	return user.Role == models.RoleAdmin, nil
+}
+
 func (s *UserService) PointsHistory(userID uint, limit int) ([]models.PointsHistory, error) {
 	return s.users.PointsHistory(userID, limit)
 }
@@ -13,7 +13,7 @@ func TestUserProfileAggregatesStats(t *testing.T) {
 	userRepo := repository.NewUserRepository(db)
 	tripRepo := repository.NewTripRepository(db)
 	rewardRepo := repository.NewRewardRepository(db)
-	service := NewUserService(userRepo, tripRepo, rewardRepo)
+	service := NewUserService(userRepo, tripRepo, rewardRepo, repository.NewBadgeRepository(db), repository.NewWishlistRepository(db))
 
 	user := &models.User{Username: "eva", Email: "eva@example.com", Password: "secret", Points: 550, Level: 2}
 	if err := userRepo.Create(user); err != nil {
@@ -86,7 +86,7 @@ func TestUserServiceHistoryLimit(t *testing.T) {
 	userRepo := repository.NewUserRepository(db)
 	tripRepo := repository.NewTripRepository(db)
 	rewardRepo := repository.NewRewardRepository(db)
-	service := NewUserService(userRepo, tripRepo, rewardRepo)
+	service := NewUserService(userRepo, tripRepo, rewardRepo, repository.NewBadgeRepository(db), repository.NewWishlistRepository(db))
 
 	user := &models.User{Username: "li", Email: "li@example.com", Password: "secret"}
 	if err := userRepo.Create(user); err != nil {
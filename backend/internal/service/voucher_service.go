@@ -0,0 +1,180 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+const maxVoucherCodeLength = 128
+
+var (
+	ErrNoVoucherCode    = errors.New("redemption has no voucher code")
+	ErrVoucherWithdrawn = errors.New("voucher code is no longer available for this redemption")
+)
+
+// VoucherService manages the encrypted code pools behind digital rewards.
+type VoucherService struct {
+	vouchers *repository.VoucherRepository
+	rewards  *repository.RewardRepository
+	aead     cipher.AEAD
+	hashKey  []byte
+}
+
+type VoucherImportResult struct {
+	Imported   int            `json:"imported"`
+	Duplicates int            `json:"duplicates"`
+	Invalid    int            `json:"invalid"`
+	Reward     *models.Reward `json:"reward"`
+}
+
+// NewVoucherService derives the encryption and hashing keys from
+// cfg.VoucherKey.
+func NewVoucherService(vouchers *repository.VoucherRepository, rewards *repository.RewardRepository, cfg config.Config) *VoucherService {
+	encKey := sha256.Sum256([]byte("voucher-encryption:" + cfg.VoucherKey))
+	hashKey := sha256.Sum256([]byte("voucher-hash:" + cfg.VoucherKey))
+	block, err := aes.NewCipher(encKey[:])
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &VoucherService{vouchers: vouchers, rewards: rewards, aead: aead, hashKey: hashKey[:]}
+}
+
+// ImportCSV reads codes from the first column of a CSV file and adds them to
+// the reward's pool. A leading "code" header row, blank cells and codes that
+// are too long are skipped; codes already in the pool are counted as
+// duplicates.
+func (s *VoucherService) ImportCSV(rewardID uint, src io.Reader) (*VoucherImportResult, error) {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	result := &VoucherImportResult{}
+	seen := make(map[string]bool)
+	var codes []models.VoucherCode
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		code := ""
+		if len(record) > 0 {
+			code = strings.TrimSpace(record[0])
+		}
+		if row == 0 && strings.EqualFold(code, "code") {
+			continue
+		}
+		if code == "" || len(code) > maxVoucherCodeLength {
+			result.Invalid++
+			continue
+		}
+
+		hash := s.hash(code)
+		if seen[hash] {
+			result.Duplicates++
+			continue
+		}
+		seen[hash] = true
+
+		ciphertext, err := s.encrypt(code)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, models.VoucherCode{CodeHash: hash, Ciphertext: ciphertext})
+	}
+
+	imported, reward, err := s.vouchers.Import(rewardID, codes)
+	if err != nil {
+		return nil, err
+	}
+	result.Imported = imported
+	result.Duplicates += len(codes) - imported
+	result.Reward = reward
+	return result, nil
+}
+
+func (s *VoucherService) Stats(rewardID uint) (*repository.VoucherStats, error) {
+	return s.vouchers.Stats(rewardID)
+}
+
+// Reveal decrypts the code assigned to one of the user's redemptions. The
+// first reveal fulfills the redemption.
+func (s *VoucherService) Reveal(userID, redemptionID uint) (string, error) {
+	redemption, err := s.rewards.FindRedemption(redemptionID)
+	if err != nil || redemption.UserID != userID {
+		return "", ErrRedemptionNotFound
+	}
+	if refundedStatuses[redemption.Status] {
+		return "", ErrVoucherWithdrawn
+	}
+
+	voucher, err := s.vouchers.FindByRedemption(redemptionID)
+	if err != nil {
+		return "", err
+	}
+	if voucher == nil {
+		return "", ErrNoVoucherCode
+	}
+
+	code, err := s.decrypt(voucher.Ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if err := s.vouchers.Reveal(voucher, redemption); err != nil {
+		if errors.Is(err, repository.ErrRedemptionChanged) {
+			return "", ErrVoucherWithdrawn
+		}
+		return "", err
+	}
+	return code, nil
+}
+
+func (s *VoucherService) hash(code string) string {
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write([]byte(code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *VoucherService) encrypt(code string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(code), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *VoucherService) decrypt(ciphertext string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	size := s.aead.NonceSize()
+	if len(data) < size {
+		return "", errors.New("voucher ciphertext is too short")
+	}
+	plain, err := s.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
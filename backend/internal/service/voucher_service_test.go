@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestVoucherCodePool(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	voucherRepo := repository.NewVoucherRepository(db)
+	rewards := NewRewardService(rewardRepo, userRepo)
+	vouchers := NewVoucherService(voucherRepo, rewardRepo, config.Config{VoucherKey: "test-key"})
+	catalog := NewCatalogService(rewardRepo, config.Config{UploadDir: t.TempDir()})
+
+	reward := &models.Reward{Name: "Gift Card", PointsCost: 10}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+
+	csv := "code\nAAA-111\n,missing\nBBB-222\nAAA-111\n"
+	result, err := vouchers.ImportCSV(reward.ID, strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if result.Imported != 2 || result.Duplicates != 1 || result.Invalid != 1 {
+		t.Fatalf("unexpected import result: %+v", result)
+	}
+	if !result.Reward.UsesCodes || result.Reward.Inventory != 2 {
+		t.Fatalf("expected code-backed inventory of 2, got %+v", result.Reward)
+	}
+
+	// Re-importing a known code counts as a duplicate across files too.
+	result, err = vouchers.ImportCSV(reward.ID, strings.NewReader("BBB-222\nCCC-333\n"))
+	if err != nil {
+		t.Fatalf("second import failed: %v", err)
+	}
+	if result.Imported != 1 || result.Duplicates != 1 || result.Reward.Inventory != 3 {
+		t.Fatalf("unexpected second import result: %+v", result)
+	}
+
+	var stored []models.VoucherCode
+	db.Where("reward_id = ?", reward.ID).Find(&stored)
+	for _, code := range stored {
+		if strings.Contains(code.Ciphertext, "AAA") || strings.Contains(code.CodeHash, "AAA") {
+			t.Fatalf("voucher code stored in plaintext: %+v", code)
+		}
+	}
+
+	if _, _, err := catalog.Restock(1, reward.ID, 5, "manual"); !errors.Is(err, ErrCodePoolStock) {
+		t.Fatalf("expected restock of code pool to fail, got %v", err)
+	}
+
+	owner := &models.User{Username: "voucher-owner", Email: "voucher-owner@example.com", Password: "secret", Points: 100}
+	other := &models.User{Username: "voucher-other", Email: "voucher-other@example.com", Password: "secret", Points: 100}
+	for _, u := range []*models.User{owner, other} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	first, _, err := rewards.Redeem(owner.ID, reward.ID)
+	if err != nil {
+		t.Fatalf("redeem failed: %v", err)
+	}
+	if _, err := vouchers.Reveal(other.ID, first.ID); !errors.Is(err, ErrRedemptionNotFound) {
+		t.Fatalf("expected other users to be denied, got %v", err)
+	}
+
+	// Cancelling before the code is revealed returns it to the pool.
+	if _, err := rewards.Cancel(owner.ID, first.ID, ""); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	stats, err := vouchers.Stats(reward.ID)
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	if stats.Total != 3 || stats.Available != 3 {
+		t.Fatalf("expected released code back in the pool, got %+v", stats)
+	}
+	if _, err := vouchers.Reveal(owner.ID, first.ID); !errors.Is(err, ErrVoucherWithdrawn) {
+		t.Fatalf("expected cancelled redemption to hide its code, got %v", err)
+	}
+
+	second, _, err := rewards.Redeem(owner.ID, reward.ID)
+	if err != nil {
+		t.Fatalf("second redeem failed: %v", err)
+	}
+	code, err := vouchers.Reveal(owner.ID, second.ID)
+	if err != nil {
+		t.Fatalf("reveal failed: %v", err)
+	}
+	if code != "AAA-111" {
+		t.Fatalf("expected oldest code to be assigned, got %q", code)
+	}
+	if _, err := rewards.Cancel(owner.ID, second.ID, ""); !errors.Is(err, ErrCodeRevealed) {
+		t.Fatalf("expected cancel after reveal to fail, got %v", err)
+	}
+
+	// Revealing fulfills the redemption, so neither expiry nor a rejection
+	// can refund a code the owner already has.
+	revealed, err := rewardRepo.FindRedemption(second.ID)
+	if err != nil || revealed.Status != models.RedemptionFulfilled {
+		t.Fatalf("expected the revealed redemption to be fulfilled, got %+v, %v", revealed, err)
+	}
+	if _, err := rewards.Transition(1, second.ID, models.RedemptionRejected, ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected rejecting a revealed redemption to fail, got %v", err)
+	}
+	before, _ := userRepo.FindByID(owner.ID)
+	if _, err := rewards.ExpireStale(0); err != nil {
+		t.Fatalf("expire failed: %v", err)
+	}
+	after, _ := userRepo.FindByID(owner.ID)
+	revealed, _ = rewardRepo.FindRedemption(second.ID)
+	if revealed.Status != models.RedemptionFulfilled || after.Points != before.Points {
+		t.Fatalf("expected expiry to leave the revealed redemption alone, got %s and %d points", revealed.Status, after.Points)
+	}
+
+	stored2, err := rewardRepo.FindByID(reward.ID)
+	if err != nil {
+		t.Fatalf("failed to load reward: %v", err)
+	}
+	stats, _ = vouchers.Stats(reward.ID)
+	if int64(stored2.Inventory) != stats.Available || stats.Revealed != 1 {
+		t.Fatalf("inventory %d out of sync with stats %+v", stored2.Inventory, stats)
+	}
+}
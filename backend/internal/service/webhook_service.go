@@ -0,0 +1,351 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+const (
+	WebhookEventRedemptionCreated = "redemption.created"
+
+	// Headers carried by webhooks and expected on partner callbacks.
+	WebhookSignatureHeader = "X-Solo-Signature"
+	WebhookTimestampHeader = "X-Solo-Timestamp"
+	WebhookDeliveryHeader  = "X-Solo-Delivery"
+
+	// webhookTolerance bounds the clock skew accepted on callbacks so a
+	// captured request cannot be replayed later.
+	webhookTolerance  = 5 * time.Minute
+	webhookBatchSize  = 50
+	webhookMaxBackoff = 6 * time.Hour
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrWebhookNotDead   = errors.New("only dead-lettered deliveries can be retried")
+	ErrWebhookNotFound  = errors.New("webhook delivery not found")
+	ErrWebhookNoSecret  = errors.New("no webhook secret configured for this endpoint")
+)
+
+// WebhookService notifies partner systems about new redemptions. Deliveries
+// are stored first and sent by Run, so a slow or failing partner never blocks
+// a redemption.
+type WebhookService struct {
+	deliveries  *repository.WebhookRepository
+	rewards     *repository.RewardRepository
+	client      *http.Client
+	url         string
+	secret      string
+	maxAttempts int
+	backoff     time.Duration
+	wake        chan struct{}
+}
+
+type webhookPayload struct {
+	Event      string            `json:"event"`
+	Redemption webhookRedemption `json:"redemption"`
+	Reward     webhookReward     `json:"reward"`
+	User       webhookUser       `json:"user"`
+}
+
+type webhookRedemption struct {
+	ID         uint      `json:"id"`
+	Status     string    `json:"status"`
+	PointsCost int64     `json:"points_cost"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type webhookReward struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type webhookUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+}
+
+func NewWebhookService(deliveries *repository.WebhookRepository, rewards *repository.RewardRepository, cfg config.Config) *WebhookService {
+	maxAttempts := cfg.WebhookMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 6
+	}
+	backoff := cfg.WebhookBackoff
+	if backoff <= 0 {
+		backoff = 30 * time.Second
+	}
+	if cfg.WebhookURL != "" && cfg.WebhookSecret == "" {
+		log.Printf("FULFILLMENT_WEBHOOK_SECRET is not set; webhooks are only sent for rewards with their own secret")
+	}
+	return &WebhookService{
+		deliveries:  deliveries,
+		rewards:     rewards,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		url:         cfg.WebhookURL,
+		secret:      cfg.WebhookSecret,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignCallback returns the hex HMAC-SHA256 a partner sends with a status
+// callback: "<timestamp>.<redemption id>.<body>". The redemption ID is signed
+// so a captured callback cannot be replayed against another redemption.
+func SignCallback(secret, timestamp string, redemptionID uint, body []byte) string {
+	return SignWebhook(secret, timestamp+"."+strconv.FormatUint(uint64(redemptionID), 10), body)
+}
+
+// RedemptionCreated queues a webhook when the reward, or the global
+// configuration, names an endpoint.
+func (s *WebhookService) RedemptionCreated(user *models.User, redemption *models.Redemption) error {
+	reward, err := s.rewards.FindByID(redemption.RewardID)
+	if err != nil {
+		return err
+	}
+	url, _ := s.target(reward)
+	if url == "" {
+		return nil
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		Event: WebhookEventRedemptionCreated,
+		Redemption: webhookRedemption{
+			ID:         redemption.ID,
+			Status:     redemption.Status,
+			PointsCost: redemption.PointsCost,
+			CreatedAt:  redemption.CreatedAt,
+		},
+		Reward: webhookReward{ID: reward.ID, Name: reward.Name},
+		User:   webhookUser{ID: user.ID, Username: user.Username},
+	})
+	if err != nil {
+		return err
+	}
+
+	delivery := &models.WebhookDelivery{
+		RedemptionID:  redemption.ID,
+		RewardID:      reward.ID,
+		Event:         WebhookEventRedemptionCreated,
+		URL:           url,
+		Payload:       string(payload),
+		Status:        models.WebhookPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := s.deliveries.Create(delivery); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Run sends due deliveries every interval and whenever a new one is queued.
+func (s *WebhookService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.DeliverDue(); err != nil {
+			log.Printf("failed to deliver webhooks: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// DeliverDue attempts every delivery whose next attempt is due and returns
+// how many succeeded. Each attempt is claimed before it is sent, so a
+// delivery whose outcome fails to save is retried after its backoff rather
+// than straight away; partners deduplicate such retries by the
+// WebhookDeliveryHeader ID.
+func (s *WebhookService) DeliverDue() (int, error) {
+	due, err := s.deliveries.ListDue(time.Now(), webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for i := range due {
+		claimed, err := s.deliveries.Claim(&due[i], time.Now().Add(s.retryDelay(due[i].Attempts+1)))
+		if err != nil {
+			return delivered, err
+		}
+		if !claimed {
+			continue
+		}
+		if s.attempt(&due[i]) {
+			delivered++
+		}
+		if err := s.deliveries.Save(&due[i]); err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+func (s *WebhookService) DeadLetters(limit int) ([]models.WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.deliveries.ListByStatus(models.WebhookDead, limit)
+}
+
+// Retry puts a dead-lettered delivery back in the queue with a fresh set of
+// attempts.
+func (s *WebhookService) Retry(id uint) (*models.WebhookDelivery, error) {
+	delivery, err := s.deliveries.FindByID(id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	if delivery.Status != models.WebhookDead {
+		return nil, ErrWebhookNotDead
+	}
+	delivery.Status = models.WebhookPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	if err := s.deliveries.Save(delivery); err != nil {
+		return nil, err
+	}
+	s.notify()
+	return delivery, nil
+}
+
+// VerifyCallback checks a partner's status callback for the redemption. The
+// signature must be made with the secret used for the redemption's reward
+// over the redemption ID, the raw body and a timestamp no older than
+// webhookTolerance; see SignCallback.
+func (s *WebhookService) VerifyCallback(redemptionID uint, timestamp, signature string, body []byte) error {
+	redemption, err := s.rewards.FindRedemption(redemptionID)
+	if err != nil {
+		return ErrRedemptionNotFound
+	}
+	_, secret := s.target(&redemption.Reward)
+	if secret == "" {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	skew := time.Since(time.Unix(unix, 0))
+	if skew > webhookTolerance || skew < -webhookTolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := SignCallback(secret, timestamp, redemptionID, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.TrimPrefix(signature, "sha256="))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// target resolves the endpoint and signing secret for a reward.
+func (s *WebhookService) target(reward *models.Reward) (url, secret string) {
+	url, secret = s.url, s.secret
+	if reward.WebhookURL != "" {
+		url = reward.WebhookURL
+	}
+	if reward.WebhookSecret != "" {
+		secret = reward.WebhookSecret
+	}
+	return url, secret
+}
+
+// attempt sends a claimed delivery once and updates its retry state. It
+// reports whether the partner accepted it.
+func (s *WebhookService) attempt(delivery *models.WebhookDelivery) bool {
+	status, err := s.send(delivery)
+	delivery.LastStatusCode = status
+	if err == nil {
+		now := time.Now()
+		delivery.Status = models.WebhookDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		return true
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.maxAttempts {
+		delivery.Status = models.WebhookDead
+		log.Printf("webhook delivery %d dead-lettered after %d attempts: %v", delivery.ID, delivery.Attempts, err)
+	}
+	return false
+}
+
+// retryDelay doubles the base backoff after every failed attempt.
+func (s *WebhookService) retryDelay(attempts int) time.Duration {
+	delay := s.backoff
+	for i := 1; i < attempts && delay < webhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxBackoff {
+		delay = webhookMaxBackoff
+	}
+	return delay
+}
+
+// send posts the delivery. Partners authenticate webhooks by their
+// signature, so deliveries without a secret are never sent; they fail and are
+// retried until one is configured.
+func (s *WebhookService) send(delivery *models.WebhookDelivery) (int, error) {
+	secret := s.secret
+	if reward, err := s.rewards.FindByID(delivery.RewardID); err == nil {
+		_, secret = s.target(reward)
+	}
+	if secret == "" {
+		return 0, ErrWebhookNoSecret
+	}
+
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("partner responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example/solo_journey/internal/config"
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestWebhookDeliveryRetriesAndCallback(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	rewards := NewRewardService(rewardRepo, userRepo)
+
+	var mu sync.Mutex
+	var calls int
+	var received webhookPayload
+	var raw []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != "sha256="+SignWebhook("reward-secret", r.Header.Get(WebhookTimestampHeader), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		raw = body
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	webhooks := NewWebhookService(repository.NewWebhookRepository(db), rewardRepo, config.Config{
+		WebhookURL:     "http://127.0.0.1:1/unused",
+		WebhookSecret:  "global-secret",
+		WebhookBackoff: time.Millisecond,
+	})
+	rewards.AddListener(webhooks)
+
+	reward := &models.Reward{Name: "Partner Tour", PointsCost: 20, Inventory: 5, WebhookURL: receiver.URL, WebhookSecret: "reward-secret"}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+	user := &models.User{Username: "webhook-user", Email: "webhook-user@example.com", Password: "secret", Points: 100}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	redemption, _, err := rewards.Redeem(user.ID, reward.ID)
+	if err != nil {
+		t.Fatalf("redeem failed: %v", err)
+	}
+
+	if n, err := webhooks.DeliverDue(); err != nil || n != 0 {
+		t.Fatalf("expected first attempt to fail, got %d delivered, err %v", n, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if n, err := webhooks.DeliverDue(); err != nil || n != 1 {
+		t.Fatalf("expected retry to succeed, got %d delivered, err %v", n, err)
+	}
+	if received.Event != WebhookEventRedemptionCreated || received.Redemption.ID != redemption.ID || received.User.Username != "webhook-user" {
+		t.Fatalf("unexpected payload: %+v", received)
+	}
+	if bytes.Contains(raw, []byte(user.Email)) {
+		t.Fatalf("expected the payload to leave out the email: %s", raw)
+	}
+
+	body := []byte(`{"status":"fulfilled"}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := webhooks.VerifyCallback(redemption.ID, timestamp, SignCallback("global-secret", timestamp, redemption.ID, body), body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected signature with the wrong secret to fail, got %v", err)
+	}
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if err := webhooks.VerifyCallback(redemption.ID, stale, SignCallback("reward-secret", stale, redemption.ID, body), body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected stale timestamp to fail, got %v", err)
+	}
+	// A callback signed for another redemption cannot be replayed here.
+	other, _, err := rewards.Redeem(user.ID, reward.ID)
+	if err != nil {
+		t.Fatalf("second redeem failed: %v", err)
+	}
+	if err := webhooks.VerifyCallback(other.ID, timestamp, SignCallback("reward-secret", timestamp, redemption.ID, body), body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected a callback signed for another redemption to fail, got %v", err)
+	}
+	if err := webhooks.VerifyCallback(redemption.ID, timestamp, "sha256="+SignCallback("reward-secret", timestamp, redemption.ID, body), body); err != nil {
+		t.Fatalf("expected valid callback, got %v", err)
+	}
+
+	updated, err := rewards.PartnerUpdate(redemption.ID, models.RedemptionFulfilled, "shipped")
+	if err != nil {
+		t.Fatalf("partner update failed: %v", err)
+	}
+	if updated.Status != models.RedemptionFulfilled || len(updated.History) != 3 {
+		t.Fatalf("expected fulfilled redemption with approve step, got %s with %d events", updated.Status, len(updated.History))
+	}
+	if updated.History[2].ActorRole != models.RolePartner {
+		t.Fatalf("expected partner actor, got %s", updated.History[2].ActorRole)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	rewards := NewRewardService(rewardRepo, userRepo)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	webhooks := NewWebhookService(repository.NewWebhookRepository(db), rewardRepo, config.Config{
+		WebhookURL:         failing.URL,
+		WebhookSecret:      "global-secret",
+		WebhookMaxAttempts: 2,
+		WebhookBackoff:     time.Millisecond,
+	})
+	rewards.AddListener(webhooks)
+
+	reward := &models.Reward{Name: "Flaky Partner", PointsCost: 10, Inventory: 5}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+	user := &models.User{Username: "webhook-dead", Email: "webhook-dead@example.com", Password: "secret", Points: 100}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	redemption, _, err := rewards.Redeem(user.ID, reward.ID)
+	if err != nil {
+		t.Fatalf("redeem failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := webhooks.DeliverDue(); err != nil {
+			t.Fatalf("deliver failed: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	dead, err := webhooks.DeadLetters(10)
+	if err != nil {
+		t.Fatalf("dead letters failed: %v", err)
+	}
+	var found *models.WebhookDelivery
+	for i := range dead {
+		if dead[i].RedemptionID == redemption.ID {
+			found = &dead[i]
+		}
+	}
+	if found == nil || found.Attempts != 2 || found.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected dead-lettered delivery after 2 attempts, got %+v", found)
+	}
+
+	retried, err := webhooks.Retry(found.ID)
+	if err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if retried.Status != models.WebhookPending || retried.Attempts != 0 {
+		t.Fatalf("expected delivery to be queued again, got %+v", retried)
+	}
+	if _, err := webhooks.Retry(found.ID); !errors.Is(err, ErrWebhookNotDead) {
+		t.Fatalf("expected retrying a pending delivery to fail, got %v", err)
+	}
+}
+
+func TestWebhookRequiresSecret(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	rewards := NewRewardService(rewardRepo, userRepo)
+
+	var calls int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	deliveries := repository.NewWebhookRepository(db)
+	webhooks := NewWebhookService(deliveries, rewardRepo, config.Config{WebhookBackoff: time.Millisecond})
+	rewards.AddListener(webhooks)
+
+	reward := &models.Reward{Name: "Unsigned Partner", PointsCost: 10, Inventory: 5, WebhookURL: receiver.URL}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+	user := &models.User{Username: "webhook-unsigned", Email: "webhook-unsigned@example.com", Password: "secret", Points: 100}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	redemption, _, err := rewards.Redeem(user.ID, reward.ID)
+	if err != nil {
+		t.Fatalf("redeem failed: %v", err)
+	}
+
+	if _, err := webhooks.DeliverDue(); err != nil {
+		t.Fatalf("deliver failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("expected no unsigned request to be sent, got %d", n)
+	}
+	var delivery models.WebhookDelivery
+	if err := db.Where("redemption_id = ?", redemption.ID).First(&delivery).Error; err != nil {
+		t.Fatalf("failed to load delivery: %v", err)
+	}
+	if delivery.Status != models.WebhookPending || delivery.LastError != ErrWebhookNoSecret.Error() {
+		t.Fatalf("expected the delivery to wait for a secret, got %+v", delivery)
+	}
+
+	// A worker holding a stale copy cannot claim an attempt that was already made.
+	stale := delivery
+	stale.Attempts = 0
+	if claimed, err := deliveries.Claim(&stale, time.Now()); err != nil || claimed {
+		t.Fatalf("expected the stale claim to be refused, got %v, %v", claimed, err)
+	}
+}
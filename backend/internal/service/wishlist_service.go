@@ -0,0 +1,246 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+// lowStockThreshold is the inventory at or below which users watching a
+// reward are warned that it is running out.
+const lowStockThreshold = 5
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// WishlistService keeps each user's wishlist and savings goal and notifies
+// them when the goal becomes affordable or a wished-for reward runs low.
+type WishlistService struct {
+	wishlist      *repository.WishlistRepository
+	notifications *repository.NotificationRepository
+	users         *repository.UserRepository
+	rewards       *repository.RewardRepository
+}
+
+// GoalProgress describes how close a user is to affording their goal. The
+// balance is the user's spendable points.
+type GoalProgress struct {
+	Reward     models.Reward `json:"reward"`
+	Balance    int64         `json:"balance"`
+	Remaining  int64         `json:"remaining"`
+	Percent    int           `json:"percent"`
+	Affordable bool          `json:"affordable"`
+}
+
+func NewWishlistService(wishlist *repository.WishlistRepository, notifications *repository.NotificationRepository, users *repository.UserRepository, rewards *repository.RewardRepository) *WishlistService {
+	return &WishlistService{wishlist: wishlist, notifications: notifications, users: users, rewards: rewards}
+}
+
+func (s *WishlistService) List(userID uint) ([]models.WishlistItem, error) {
+	return s.wishlist.ListByUser(userID)
+}
+
+// Add puts a published reward on the user's wishlist.
+func (s *WishlistService) Add(userID, rewardID uint) error {
+	if err := s.requireListed(rewardID); err != nil {
+		return err
+	}
+	if err := s.wishlist.Add(userID, rewardID); err != nil {
+		return err
+	}
+	return s.CheckUser(userID)
+}
+
+func (s *WishlistService) Remove(userID, rewardID uint) error {
+	return s.wishlist.Remove(userID, rewardID)
+}
+
+// SetGoal makes the reward the user's active goal, replacing any previous
+// one.
+func (s *WishlistService) SetGoal(userID, rewardID uint) (*GoalProgress, error) {
+	if err := s.requireListed(rewardID); err != nil {
+		return nil, err
+	}
+	if err := s.wishlist.SetGoal(userID, rewardID); err != nil {
+		return nil, err
+	}
+	if err := s.CheckUser(userID); err != nil {
+		return nil, err
+	}
+	return s.Goal(userID)
+}
+
+func (s *WishlistService) ClearGoal(userID uint) error {
+	return s.wishlist.ClearGoal(userID)
+}
+
+// Goal returns the progress toward the user's goal, or nil without one.
+func (s *WishlistService) Goal(userID uint) (*GoalProgress, error) {
+	item, err := s.wishlist.FindGoal(userID)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return goalProgress(item, user), nil
+}
+
+func (s *WishlistService) Notifications(userID uint, unreadOnly bool, limit int) ([]models.Notification, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	return s.notifications.ListByUser(userID, unreadOnly, limit)
+}
+
+func (s *WishlistService) MarkRead(userID, id uint) error {
+	found, err := s.notifications.MarkRead(userID, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// CheckUser evaluates every item on the user's wishlist.
+func (s *WishlistService) CheckUser(userID uint) error {
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return err
+	}
+	items, err := s.wishlist.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		if err := s.check(&items[i], user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckAll evaluates every wishlist. It catches balance and stock changes
+// that happen outside the trip and redemption listeners, such as admin
+// adjustments, refunds and restocks. A wishlist that fails to evaluate is
+// logged and skipped so it does not hold up the others.
+func (s *WishlistService) CheckAll() error {
+	ids, err := s.wishlist.UserIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.CheckUser(id); err != nil {
+			log.Printf("failed to check wishlist of user %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// TripCreated re-evaluates the goal after the author earned points.
+func (s *WishlistService) TripCreated(user *models.User, trip *models.TripPost) error {
+	return s.CheckUser(user.ID)
+}
+
+// RedemptionCreated re-evaluates the redeemer's wishlist, whose balance
+// dropped, and warns everyone watching the reward if its stock is now low.
+func (s *WishlistService) RedemptionCreated(user *models.User, redemption *models.Redemption) error {
+	if err := s.CheckUser(user.ID); err != nil {
+		return err
+	}
+	watchers, err := s.wishlist.ListByReward(redemption.RewardID)
+	if err != nil {
+		return err
+	}
+	for i := range watchers {
+		if watchers[i].UserID == user.ID {
+			continue
+		}
+		watcher, err := s.users.FindByID(watchers[i].UserID)
+		if err != nil {
+			log.Printf("failed to load wishlist owner %d: %v", watchers[i].UserID, err)
+			continue
+		}
+		if err := s.check(&watchers[i], watcher); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check notifies the owner of an item about its reward. Rewards the catalog
+// no longer shows cannot be redeemed and are skipped.
+func (s *WishlistService) check(item *models.WishlistItem, user *models.User) error {
+	reward := &item.Reward
+	if reward.Hidden || reward.ArchivedAt != nil {
+		return nil
+	}
+
+	if item.IsGoal {
+		affordable := user.Points >= reward.PointsCost
+		switch {
+		case affordable && !item.AffordableNotified:
+			err := s.wishlist.Notify(item, "affordable_notified", &models.Notification{
+				UserID:   user.ID,
+				Kind:     models.NotificationGoalAffordable,
+				RewardID: reward.ID,
+				Message:  fmt.Sprintf("You have enough points for %s.", reward.Name),
+			})
+			if err != nil {
+				return err
+			}
+		case !affordable && item.AffordableNotified:
+			if err := s.wishlist.ResetFlag(item, "affordable_notified"); err != nil {
+				return err
+			}
+		}
+	}
+
+	low := reward.Inventory > 0 && reward.Inventory <= lowStockThreshold
+	switch {
+	case low && !item.LowStockNotified:
+		return s.wishlist.Notify(item, "low_stock_notified", &models.Notification{
+			UserID:   user.ID,
+			Kind:     models.NotificationLowStock,
+			RewardID: reward.ID,
+			Message:  fmt.Sprintf("Only %d left of %s.", reward.Inventory, reward.Name),
+		})
+	case reward.Inventory > lowStockThreshold && item.LowStockNotified:
+		return s.wishlist.ResetFlag(item, "low_stock_notified")
+	}
+	return nil
+}
+
+func (s *WishlistService) requireListed(rewardID uint) error {
+	reward, err := s.rewards.FindByID(rewardID)
+	if err != nil || reward.Hidden || reward.ArchivedAt != nil {
+		return repository.ErrRewardUnavailable
+	}
+	return nil
+}
+
+func goalProgress(item *models.WishlistItem, user *models.User) *GoalProgress {
+	progress := &GoalProgress{
+		Reward:     item.Reward,
+		Balance:    user.Points,
+		Remaining:  item.Reward.PointsCost - user.Points,
+		Affordable: user.Points >= item.Reward.PointsCost,
+		Percent:    100,
+	}
+	if progress.Remaining < 0 {
+		progress.Remaining = 0
+	}
+	if item.Reward.PointsCost > 0 && !progress.Affordable {
+		progress.Percent = int(user.Points * 100 / item.Reward.PointsCost)
+	}
+	// Adjustments can leave a balance below zero.
+	if progress.Percent < 0 {
+		progress.Percent = 0
+	}
+	return progress
+}
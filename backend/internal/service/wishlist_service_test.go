@@ -0,0 +1,151 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
+)
+
+func TestWishlistGoalProgressAndNotifications(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	wishlistRepo := repository.NewWishlistRepository(db)
+	wishlist := NewWishlistService(wishlistRepo, repository.NewNotificationRepository(db), userRepo, rewardRepo)
+	rewards := NewRewardService(rewardRepo, userRepo)
+	rewards.AddListener(wishlist)
+	users := NewUserService(userRepo, repository.NewTripRepository(db), rewardRepo, repository.NewBadgeRepository(db), wishlistRepo)
+
+	reward := &models.Reward{Name: "Onsen Pass", PointsCost: 100, Inventory: 7}
+	other := &models.Reward{Name: "Tea Set", PointsCost: 10, Inventory: 50}
+	for _, r := range []*models.Reward{reward, other} {
+		if err := rewardRepo.Create(r); err != nil {
+			t.Fatalf("failed to create reward: %v", err)
+		}
+	}
+	saver := &models.User{Username: "saver", Email: "saver@example.com", Password: "secret", Points: 40}
+	buyer := &models.User{Username: "goal-buyer", Email: "goal-buyer@example.com", Password: "secret", Points: 1000}
+	for _, u := range []*models.User{saver, buyer} {
+		if err := userRepo.Create(u); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	if err := wishlist.Add(saver.ID, other.ID); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	goal, err := wishlist.SetGoal(saver.ID, reward.ID)
+	if err != nil {
+		t.Fatalf("set goal failed: %v", err)
+	}
+	if goal.Percent != 40 || goal.Remaining != 60 || goal.Affordable {
+		t.Fatalf("unexpected goal progress: %+v", goal)
+	}
+	items, _ := wishlist.List(saver.ID)
+	if len(items) != 2 || !items[0].IsGoal || items[0].RewardID != reward.ID {
+		t.Fatalf("expected goal first on a two item wishlist, got %+v", items)
+	}
+
+	// Switching the goal leaves exactly one active goal.
+	if _, err := wishlist.SetGoal(saver.ID, other.ID); err != nil {
+		t.Fatalf("set goal failed: %v", err)
+	}
+	if _, err := wishlist.SetGoal(saver.ID, reward.ID); err != nil {
+		t.Fatalf("set goal failed: %v", err)
+	}
+	var goals int64
+	db.Model(&models.WishlistItem{}).Where("user_id = ? AND is_goal = ?", saver.ID, true).Count(&goals)
+	if goals != 1 {
+		t.Fatalf("expected a single goal, got %d", goals)
+	}
+
+	notifications, _ := wishlist.Notifications(saver.ID, false, 10)
+	if len(notifications) != 1 || notifications[0].Kind != models.NotificationGoalAffordable || notifications[0].RewardID != other.ID {
+		t.Fatalf("expected only the affordable tea set notification, got %+v", notifications)
+	}
+
+	if _, err := userRepo.AddPoints(saver.ID, 70, "activity"); err != nil {
+		t.Fatalf("failed to add points: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := wishlist.CheckUser(saver.ID); err != nil {
+			t.Fatalf("check failed: %v", err)
+		}
+	}
+	notifications, _ = wishlist.Notifications(saver.ID, true, 10)
+	if len(notifications) != 2 || notifications[0].RewardID != reward.ID {
+		t.Fatalf("expected one new goal notification, got %+v", notifications)
+	}
+
+	profile, err := users.Profile(saver.ID)
+	if err != nil {
+		t.Fatalf("profile failed: %v", err)
+	}
+	if profile.Goal == nil || !profile.Goal.Affordable || profile.Goal.Percent != 100 || profile.Goal.Reward.ID != reward.ID {
+		t.Fatalf("expected affordable goal in profile, got %+v", profile.Goal)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := rewards.Redeem(buyer.ID, reward.ID); err != nil {
+			t.Fatalf("redeem failed: %v", err)
+		}
+	}
+	notifications, _ = wishlist.Notifications(saver.ID, false, 10)
+	if len(notifications) != 3 || notifications[0].Kind != models.NotificationLowStock {
+		t.Fatalf("expected a low stock notification, got %+v", notifications)
+	}
+
+	if err := wishlist.MarkRead(saver.ID, notifications[0].ID); err != nil {
+		t.Fatalf("mark read failed: %v", err)
+	}
+	if err := wishlist.MarkRead(buyer.ID, notifications[1].ID); err != ErrNotificationNotFound {
+		t.Fatalf("expected other users' notifications to be hidden, got %v", err)
+	}
+	unread, _ := wishlist.Notifications(saver.ID, true, 10)
+	if len(unread) != 2 {
+		t.Fatalf("expected two unread notifications, got %d", len(unread))
+	}
+}
+
+func TestWishlistSkipsUnlistedRewards(t *testing.T) {
+	db := setupTestDB(t)
+	userRepo := repository.NewUserRepository(db)
+	rewardRepo := repository.NewRewardRepository(db)
+	wishlist := NewWishlistService(repository.NewWishlistRepository(db), repository.NewNotificationRepository(db), userRepo, rewardRepo)
+
+	reward := &models.Reward{Name: "Glacier Hike", PointsCost: 100, Inventory: 20}
+	if err := rewardRepo.Create(reward); err != nil {
+		t.Fatalf("failed to create reward: %v", err)
+	}
+	user := &models.User{Username: "glacier-saver", Email: "glacier-saver@example.com", Password: "secret"}
+	if err := userRepo.Create(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := wishlist.SetGoal(user.ID, reward.ID); err != nil {
+		t.Fatalf("set goal failed: %v", err)
+	}
+
+	// A balance taken below zero by an adjustment shows no progress.
+	if _, err := userRepo.AddPoints(user.ID, -30, "adjustment"); err != nil {
+		t.Fatalf("failed to deduct points: %v", err)
+	}
+	goal, err := wishlist.Goal(user.ID)
+	if err != nil || goal.Percent != 0 {
+		t.Fatalf("expected 0%% progress, got %+v, %v", goal, err)
+	}
+
+	// Once the reward is taken off the catalog, nothing is announced for it.
+	if err := db.Model(reward).Updates(map[string]interface{}{"hidden": true, "inventory": 2}).Error; err != nil {
+		t.Fatalf("failed to hide reward: %v", err)
+	}
+	if _, err := userRepo.AddPoints(user.ID, 500, "activity"); err != nil {
+		t.Fatalf("failed to add points: %v", err)
+	}
+	if err := wishlist.CheckAll(); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if notifications, _ := wishlist.Notifications(user.ID, false, 10); len(notifications) != 0 {
+		t.Fatalf("expected no notifications for a hidden reward, got %+v", notifications)
+	}
+}
@@ -1,32 +1,70 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 
 	"github.com/example/solo_journey/internal/models"
+	"github.com/example/solo_journey/internal/repository"
 	"github.com/example/solo_journey/internal/service"
 )
 
 type Router struct {
-	Engine        *gin.Engine
-	authService   *service.AuthService
-	tripService   *service.TripService
-	rewardService *service.RewardService
-	userService   *service.UserService
+	Engine             *gin.Engine
+	authService        *service.AuthService
+	tripService        *service.TripService
+	rewardService      *service.RewardService
+	userService        *service.UserService
+	badgeService       *service.BadgeService
+	streakService      *service.StreakService
+	adjustmentService  *service.AdjustmentService
+	referralService    *service.ReferralService
+	catalogService     *service.CatalogService
+	voucherService     *service.VoucherService
+	idempotencyService *service.IdempotencyService
+	webhookService     *service.WebhookService
+	wishlistService    *service.WishlistService
+	dropService        *service.DropService
+	leaderboardSync    *service.LeaderboardSync
+	periodLeaderboards *service.PeriodLeaderboardService
+	// resilientLeaderboard is nil when the in-memory leaderboard is used.
+	resilientLeaderboard *service.ResilientLeaderboard
+	leaderboardStream    *service.LeaderboardStream
+	followService        *service.FollowService
 }
 
-func NewRouter(auth *service.AuthService, trip *service.TripService, reward *service.RewardService, user *service.UserService) *Router {
+func NewRouter(auth *service.AuthService, trip *service.TripService, reward *service.RewardService, user *service.UserService, badge *service.BadgeService, streak *service.StreakService, adjustments *service.AdjustmentService, referrals *service.ReferralService, catalog *service.CatalogService, vouchers *service.VoucherService, idempotency *service.IdempotencyService, webhooks *service.WebhookService, wishlist *service.WishlistService, drops *service.DropService, leaderboardSync *service.LeaderboardSync, periodLeaderboards *service.PeriodLeaderboardService, resilientLeaderboard *service.ResilientLeaderboard, leaderboardStream *service.LeaderboardStream, follows *service.FollowService) *Router {
 	r := &Router{
-		authService:   auth,
-		tripService:   trip,
-		rewardService: reward,
-		userService:   user,
-		Engine:        gin.Default(),
+		authService:          auth,
+		tripService:          trip,
+		rewardService:        reward,
+		userService:          user,
+		badgeService:         badge,
+		streakService:        streak,
+		adjustmentService:    adjustments,
+		referralService:      referrals,
+		catalogService:       catalog,
+		voucherService:       vouchers,
+		idempotencyService:   idempotency,
+		webhookService:       webhooks,
+		wishlistService:      wishlist,
+		dropService:          drops,
+		leaderboardSync:      leaderboardSync,
+		periodLeaderboards:   periodLeaderboards,
+		resilientLeaderboard: resilientLeaderboard,
+		leaderboardStream:    leaderboardStream,
+		followService:        follows,
+		Engine:               gin.Default(),
 	}
 
 	r.registerRoutes()
@@ -34,36 +72,105 @@ func NewRouter(auth *service.AuthService, trip *service.TripService, reward *ser
 }
 
 func (r *Router) registerRoutes() {
+	r.Engine.Static("/uploads", r.catalogService.UploadDir())
+
 	api := r.Engine.Group("/api/v1")
+	api.GET("/health", r.handleHealth)
 
 	auth := api.Group("/auth")
 	auth.POST("/register", r.handleRegister)
 	auth.POST("/login", r.handleLogin)
+	auth.POST("/refresh", r.handleRefresh)
+	auth.POST("/logout", r.handleLogout)
 
 	trips := api.Group("/trips")
 	trips.GET("", r.handleListTrips)
 	trips.GET("/:id", r.handleGetTrip)
-	trips.POST("", r.requireAuth(), r.handleCreateTrip)
+	trips.POST("", r.requireAuth(), r.idempotent(), r.handleCreateTrip)
 
 	leaderboard := api.Group("/leaderboard")
 	leaderboard.GET("", r.handleLeaderboard)
+	leaderboard.GET("/archive", r.handleLeaderboardArchive)
+	leaderboard.GET("/me", r.requireAuth(), r.handleLeaderboardMe)
+	leaderboard.GET("/stream", r.handleLeaderboardStream)
+	leaderboard.GET("/friends", r.requireAuth(), r.handleFriendsLeaderboard)
 
 	rewards := api.Group("/rewards")
-	rewards.GET("", r.handleListRewards)
-	rewards.POST("/redeem", r.requireAuth(), r.handleRedeemReward)
+	rewards.GET("", r.optionalAuth(), r.handleListRewards)
+	rewards.GET("/categories", r.handleListRewardCategories)
+	rewards.POST("/redeem", r.requireAuth(), r.idempotent(), r.handleRedeemReward)
+
+	drops := api.Group("/drops")
+	drops.GET("", r.handleListDrops)
+	drops.GET("/:id", r.handleGetDrop)
+	drops.GET("/:id/results", r.handleDropResults)
+	drops.POST("/:id/enter", r.requireAuth(), r.handleEnterDrop)
+	drops.GET("/:id/entry", r.requireAuth(), r.handleGetDropEntry)
+
+	partners := api.Group("/partners")
+	partners.POST("/redemptions/:id/status", r.handlePartnerRedemptionStatus)
+
+	users := api.Group("/users")
+	users.GET("/:id", r.handleGetPublicProfile)
+	users.POST("/:id/follow", r.requireAuth(), r.handleFollow)
+	users.DELETE("/:id/follow", r.requireAuth(), r.handleUnfollow)
 
 	me := api.Group("/me")
 	me.Use(r.requireAuth())
 	me.GET("", r.handleGetProfile)
+	me.PATCH("", r.handleUpdateProfile)
 	me.GET("/history", r.handleGetHistory)
 	me.GET("/redemptions", r.handleGetRedemptions)
+	me.POST("/redemptions/:id/cancel", r.handleCancelRedemption)
+	me.GET("/redemptions/:id/code", r.handleRevealVoucherCode)
+	me.GET("/badges", r.handleGetBadges)
+	me.GET("/streak", r.handleGetStreak)
+	me.GET("/activity", r.handleGetActivity)
+	me.GET("/referrals", r.handleGetReferrals)
+	me.GET("/wishlist", r.handleGetWishlist)
+	me.POST("/wishlist", r.handleAddWishlist)
+	me.DELETE("/wishlist/:reward_id", r.handleRemoveWishlist)
+	me.GET("/goal", r.handleGetGoal)
+	me.PUT("/goal", r.handleSetGoal)
+	me.DELETE("/goal", r.handleClearGoal)
+	me.GET("/notifications", r.handleGetNotifications)
+	me.POST("/notifications/:id/read", r.handleReadNotification)
+	me.GET("/following", r.handleGetFollowing)
+	me.GET("/followers", r.handleGetFollowers)
+	me.GET("/sessions", r.handleGetSessions)
+	me.DELETE("/sessions/:id", r.handleRevokeSession)
+
+	admin := api.Group("/admin")
+	admin.Use(r.requireAuth(), r.requireAdmin())
+	admin.POST("/points/adjustments", r.handleAdjustPoints)
+	admin.GET("/points/adjustments", r.handleListAdjustments)
+	admin.GET("/rewards", r.handleAdminListRewards)
+	admin.POST("/rewards", r.handleAdminCreateReward)
+	admin.GET("/rewards/:id", r.handleAdminGetReward)
+	admin.PUT("/rewards/:id", r.handleAdminUpdateReward)
+	admin.DELETE("/rewards/:id", r.handleAdminArchiveReward)
+	admin.POST("/rewards/:id/publish", r.handleAdminPublishReward(true))
+	admin.POST("/rewards/:id/unpublish", r.handleAdminPublishReward(false))
+	admin.POST("/rewards/:id/image", r.handleAdminUploadRewardImage)
+	admin.POST("/rewards/:id/restock", r.handleAdminRestockReward)
+	admin.GET("/rewards/:id/stock", r.handleAdminRewardStock)
+	admin.POST("/rewards/:id/codes", r.handleAdminImportVoucherCodes)
+	admin.GET("/rewards/:id/codes", r.handleAdminVoucherStats)
+	admin.GET("/redemptions", r.handleAdminListRedemptions)
+	admin.POST("/redemptions/:id/transition", r.handleTransitionRedemption)
+	admin.POST("/drops", r.handleAdminCreateDrop)
+	admin.POST("/drops/:id/draw", r.handleAdminDrawDrop)
+	admin.POST("/leaderboard/reconcile", r.handleAdminReconcileLeaderboard)
+	admin.GET("/webhooks/dead", r.handleAdminDeadWebhooks)
+	admin.POST("/webhooks/:id/retry", r.handleAdminRetryWebhook)
 }
 
 func (r *Router) handleRegister(c *gin.Context) {
 	var input struct {
-		Username string `json:"username" binding:"required,min=3"`
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=8"`
+		Username   string `json:"username" binding:"required,min=3"`
+		Email      string `json:"email" binding:"required,email"`
+		Password   string `json:"password" binding:"required,min=8"`
+		InviteCode string `json:"invite_code"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -71,32 +178,109 @@ func (r *Router) handleRegister(c *gin.Context) {
 		return
 	}
 
-	user, err := r.authService.Register(input.Username, input.Email, input.Password)
+	var inviter *models.User
+	if input.InviteCode != "" {
+		var err error
+		if inviter, err = r.referralService.Inviter(input.InviteCode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	user, err := r.authService.Register(service.RegisterInput{
+		Username: input.Username,
+		Email:    input.Email,
+		Password: input.Password,
+		IP:       c.ClientIP(),
+		DeviceID: c.GetHeader("X-Device-ID"),
+	})
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+
+	// The account already exists, so a failed referral must not turn the
+	// response into an error the client would retry with the same email.
+	if inviter != nil {
+		if _, err := r.referralService.Record(inviter, user); err != nil {
+			log.Printf("failed to record referral of user %d by %d: %v", user.ID, inviter.ID, err)
+		}
+	}
 	c.JSON(http.StatusCreated, user)
 }
 
 func (r *Router) handleLogin(c *gin.Context) {
 	var input struct {
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required"`
+		Email      string `json:"email" binding:"required,email"`
+		Password   string `json:"password" binding:"required"`
+		DeviceName string `json:"device_name"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.DeviceName == "" {
+		input.DeviceName = c.GetHeader("X-Device-Name")
+	}
 
-	token, user, err := r.authService.Login(input.Email, input.Password)
+	tokens, user, err := r.authService.Login(service.LoginInput{
+		Email:      input.Email,
+		Password:   input.Password,
+		DeviceName: input.DeviceName,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	})
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token, "user": user})
+	c.JSON(http.StatusOK, gin.H{
+		"token":              tokens.AccessToken,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"user":               user,
+	})
+}
+
+// handleRefresh exchanges a refresh token for a new access and refresh token.
+// The refresh token is accepted once; the response carries its successor.
+func (r *Router) handleRefresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := r.authService.Refresh(input.RefreshToken)
+	if err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// handleLogout signs out the device holding the refresh token. It needs no
+// access token, so a client whose access token already expired can still log
+// out.
+func (r *Router) handleLogout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.authService.Logout(input.RefreshToken); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
 }
 
 func (r *Router) handleCreateTrip(c *gin.Context) {
@@ -105,6 +289,7 @@ func (r *Router) handleCreateTrip(c *gin.Context) {
 		Title       string `json:"title" binding:"required"`
 		Description string `json:"description" binding:"required"`
 		Location    string `json:"location" binding:"required"`
+		Country     string `json:"country"`
 		VisitedAt   string `json:"visited_at" binding:"required"`
 		Media       []struct {
 			Type        string `json:"type" binding:"required"`
@@ -140,6 +325,7 @@ func (r *Router) handleCreateTrip(c *gin.Context) {
 		Title:       input.Title,
 		Description: input.Description,
 		Location:    input.Location,
+		Country:     input.Country,
 		VisitedAt:   visitedAt,
 		Media:       media,
 	})
@@ -176,6 +362,28 @@ func (r *Router) handleGetTrip(c *gin.Context) {
 
 func (r *Router) handleLeaderboard(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if region := c.Query("region"); region != "" {
+		if c.Query("period") != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "period and region cannot be combined"})
+			return
+		}
+		entries, err := r.tripService.RegionalLeaderboard(region, limit)
+		if err != nil {
+			c.JSON(leaderboardErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, entries)
+		return
+	}
+	if period := c.Query("period"); period != "" {
+		standings, err := r.periodLeaderboards.Top(period, limit)
+		if err != nil {
+			c.JSON(leaderboardErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, standings)
+		return
+	}
 	entries, err := r.tripService.Leaderboard(limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -184,15 +392,129 @@ func (r *Router) handleLeaderboard(c *gin.Context) {
 	c.JSON(http.StatusOK, entries)
 }
 
-func (r *Router) handleListRewards(c *gin.Context) {
-	rewards, err := r.rewardService.ListRewards()
+func (r *Router) handleHealth(c *gin.Context) {
+	leaderboard := r.resilientLeaderboard.Health()
+	status := "ok"
+	if leaderboard.Degraded() {
+		status = "degraded"
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status, "leaderboard": leaderboard})
+}
+
+func (r *Router) handleLeaderboardMe(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	window, _ := strconv.Atoi(c.DefaultQuery("window", "5"))
+	position, err := r.tripService.LeaderboardPosition(claims.UserID, window)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, position)
+}
+
+// streamKeepAlive is how often an idle leaderboard stream sends a comment so
+// proxies do not close the connection.
+const streamKeepAlive = 15 * time.Second
+
+func (r *Router) handleLeaderboardStream(c *gin.Context) {
+	// Browsers resend the last ID in the header when reconnecting; the query
+	// parameter lets clients resume on their first connection.
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
+	}
+
+	missed, events, cancel, err := r.leaderboardStream.Subscribe(lastID)
+	if err != nil {
+		c.Header("Retry-After", strconv.Itoa(int(streamKeepAlive.Seconds())))
+		c.JSON(leaderboardErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	for _, event := range missed {
+		renderLeaderboardEvent(c, event)
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event := <-events:
+			renderLeaderboardEvent(c, event)
+		case <-keepAlive.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+		}
+		return true
+	})
+}
+
+func renderLeaderboardEvent(c *gin.Context, event service.LeaderboardEvent) {
+	c.Render(-1, sse.Event{
+		Id:    event.ID,
+		Event: event.Type,
+		Data:  event,
+	})
+}
+
+func (r *Router) handleLeaderboardArchive(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	standings, err := r.periodLeaderboards.Archived(c.Query("period"), c.Query("key"), limit)
 	if err != nil {
+		c.JSON(leaderboardErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, standings)
+}
+
+func (r *Router) handleListRewards(c *gin.Context) {
+	var userID uint
+	if claims, ok := c.Get("claims"); ok {
+		userID = claims.(*service.Claims).UserID
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	query := service.CatalogQuery{
+		Category:   c.Query("category"),
+		Tag:        c.Query("tag"),
+		Search:     c.Query("q"),
+		Sort:       c.Query("sort"),
+		Affordable: c.Query("affordable") == "true",
+		Limit:      limit,
+		Offset:     offset,
+	}
+
+	rewards, total, err := r.rewardService.BrowseRewards(userID, query)
+	switch {
+	case errors.Is(err, service.ErrInvalidSort):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrAffordableNeedsUser):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(http.StatusOK, rewards)
 }
 
+func (r *Router) handleListRewardCategories(c *gin.Context) {
+	categories, err := r.rewardService.Categories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
 func (r *Router) handleRedeemReward(c *gin.Context) {
 	claims := c.MustGet("claims").(*service.Claims)
 	var input struct {
@@ -206,12 +528,28 @@ func (r *Router) handleRedeemReward(c *gin.Context) {
 
 	redemption, user, err := r.rewardService.Redeem(claims.UserID, input.RewardID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, redeemErrorBody(err))
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"redemption": redemption, "user": user})
 }
 
+// redeemErrorBody adds the eligibility code to redemption errors so clients
+// can explain the refusal without parsing the message.
+func redeemErrorBody(err error) gin.H {
+	body := gin.H{"error": err.Error()}
+	var eligibility *service.EligibilityError
+	switch {
+	case errors.As(err, &eligibility):
+		body["code"] = eligibility.Code
+	case errors.Is(err, repository.ErrRewardUnavailable):
+		body["code"] = service.EligibilityOutOfStock
+	case errors.Is(err, repository.ErrInsufficientPoints):
+		body["code"] = service.EligibilityInsufficientPoints
+	}
+	return body
+}
+
 func (r *Router) handleGetProfile(c *gin.Context) {
 	claims := c.MustGet("claims").(*service.Claims)
 	profile, err := r.userService.Profile(claims.UserID)
@@ -222,6 +560,31 @@ func (r *Router) handleGetProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, profile)
 }
 
+func (r *Router) handleUpdateProfile(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	var input struct {
+		Timezone  *string `json:"timezone"`
+		Region    *string `json:"region"`
+		AvatarURL *string `json:"avatar_url"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := r.userService.UpdateSettings(claims.UserID, service.SettingsInput{
+		Timezone:  input.Timezone,
+		Region:    input.Region,
+		AvatarURL: input.AvatarURL,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
 func (r *Router) handleGetHistory(c *gin.Context) {
 	claims := c.MustGet("claims").(*service.Claims)
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
@@ -244,22 +607,1059 @@ func (r *Router) handleGetRedemptions(c *gin.Context) {
 	c.JSON(http.StatusOK, redemptions)
 }
 
-func (r *Router) requireAuth() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
-			return
-		}
+func (r *Router) handleRevealVoucherCode(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redemption id"})
+		return
+	}
 
-		claims, err := r.authService.ParseToken(parts[1])
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	code, err := r.voucherService.Reveal(claims.UserID, uint(id))
+	if err != nil {
+		c.JSON(redemptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"redemption_id": id, "code": code})
+}
+
+func (r *Router) handleCancelRedemption(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redemption id"})
+		return
+	}
+	var input struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+	}
 
-		c.Set("claims", claims)
-		c.Next()
+	redemption, err := r.rewardService.Cancel(claims.UserID, uint(id), input.Note)
+	if err != nil {
+		c.JSON(redemptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, redemption)
+}
+
+func (r *Router) handleGetBadges(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	badges, err := r.badgeService.UserBadges(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, badges)
+}
+
+func (r *Router) handleGetStreak(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	summary, err := r.streakService.Summary(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+func (r *Router) handleGetActivity(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	year, err := strconv.Atoi(c.DefaultQuery("year", "0"))
+	if err != nil || year < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid year"})
+		return
+	}
+	calendar, err := r.streakService.Calendar(claims.UserID, year)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, calendar)
+}
+
+func (r *Router) handleGetReferrals(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	summary, err := r.referralService.Summary(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+func (r *Router) handleGetPublicProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	profile, err := r.userService.PublicProfile(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+func (r *Router) handleFollow(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	if err := r.followService.Follow(claims.UserID, uint(id)); err != nil {
+		c.JSON(followErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (r *Router) handleUnfollow(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+	if err := r.followService.Unfollow(claims.UserID, uint(id)); err != nil {
+		c.JSON(followErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (r *Router) handleGetFollowing(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	users, err := r.followService.Following(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func (r *Router) handleGetFollowers(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	users, err := r.followService.Followers(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// handleGetSessions lists the devices the user is signed in on. The session
+// of the request's own token is marked as current.
+func (r *Router) handleGetSessions(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	sessions, err := r.authService.Sessions(claims.UserID, claims.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// handleRevokeSession signs out one device. Revoking the current session is
+// the same as logging out.
+func (r *Router) handleRevokeSession(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+
+	if err := r.authService.RevokeSession(claims.UserID, uint(id)); err != nil {
+		c.JSON(authErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (r *Router) handleFriendsLeaderboard(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	entries, err := r.followService.FriendsLeaderboard(claims.UserID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+func (r *Router) handleAdjustPoints(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	var input struct {
+		UserID uint   `json:"user_id" binding:"required"`
+		Delta  int64  `json:"delta" binding:"required"`
+		Reason string `json:"reason" binding:"required"`
+		Ticket string `json:"ticket"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adjustment, user, err := r.adjustmentService.Adjust(service.AdjustPointsInput{
+		UserID:  input.UserID,
+		ActorID: claims.UserID,
+		Delta:   input.Delta,
+		Reason:  input.Reason,
+		Ticket:  input.Ticket,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"adjustment": adjustment, "user": user})
+}
+
+func (r *Router) handleListAdjustments(c *gin.Context) {
+	var filter repository.AdjustmentFilter
+	if v := c.Query("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		filter.UserID = uint(id)
+	}
+	if v := c.Query("actor_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor_id"})
+			return
+		}
+		filter.ActorID = uint(id)
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be RFC3339 timestamp"})
+			return
+		}
+		filter.From = from
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be RFC3339 timestamp"})
+			return
+		}
+		filter.To = to
+	}
+	filter.Ticket = c.Query("ticket")
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	adjustments, err := r.adjustmentService.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, adjustments)
+}
+
+type rewardRequest struct {
+	Name        string     `json:"name" binding:"required"`
+	Description string     `json:"description"`
+	PointsCost  int64      `json:"points_cost" binding:"required,gt=0"`
+	Inventory   int        `json:"inventory" binding:"gte=0"`
+	Publish     bool       `json:"publish"`
+	MinLevel    int        `json:"min_level" binding:"gte=0"`
+	MaxPerUser  int        `json:"max_per_user" binding:"gte=0"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	Regions     string     `json:"regions"`
+	Category    string     `json:"category"`
+	Tags        string     `json:"tags"`
+
+	WebhookURL    string `json:"webhook_url"`
+	WebhookSecret string `json:"webhook_secret"`
+}
+
+func (req rewardRequest) input() service.RewardInput {
+	return service.RewardInput{
+		Name:        req.Name,
+		Description: req.Description,
+		PointsCost:  req.PointsCost,
+		Inventory:   req.Inventory,
+		Publish:     req.Publish,
+		MinLevel:    req.MinLevel,
+		MaxPerUser:  req.MaxPerUser,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		Regions:     req.Regions,
+		Category:    req.Category,
+		Tags:        req.Tags,
+
+		WebhookURL:    req.WebhookURL,
+		WebhookSecret: req.WebhookSecret,
+	}
+}
+
+// adminReward is a reward as shown to admins, including the fulfillment
+// webhook URL that public endpoints leave out.
+type adminReward struct {
+	*models.Reward
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+func newAdminReward(reward *models.Reward) adminReward {
+	return adminReward{Reward: reward, WebhookURL: reward.WebhookURL}
+}
+
+func newAdminRewards(rewards []models.Reward) []adminReward {
+	views := make([]adminReward, len(rewards))
+	for i := range rewards {
+		views[i] = newAdminReward(&rewards[i])
+	}
+	return views
+}
+
+func rewardIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reward id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (r *Router) handleAdminListRewards(c *gin.Context) {
+	rewards, err := r.catalogService.List(c.Query("include_archived") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newAdminRewards(rewards))
+}
+
+func (r *Router) handleAdminCreateReward(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	var input rewardRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reward, err := r.catalogService.Create(claims.UserID, input.input())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, newAdminReward(reward))
+}
+
+func (r *Router) handleAdminGetReward(c *gin.Context) {
+	id, ok := rewardIDParam(c)
+	if !ok {
+		return
+	}
+	reward, err := r.catalogService.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newAdminReward(reward))
+}
+
+func (r *Router) handleAdminUpdateReward(c *gin.Context) {
+	id, ok := rewardIDParam(c)
+	if !ok {
+		return
+	}
+	var input rewardRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reward, err := r.catalogService.Update(id, input.input())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newAdminReward(reward))
+}
+
+func (r *Router) handleAdminArchiveReward(c *gin.Context) {
+	id, ok := rewardIDParam(c)
+	if !ok {
+		return
+	}
+	reward, err := r.catalogService.Archive(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newAdminReward(reward))
+}
+
+func (r *Router) handleAdminPublishReward(published bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := rewardIDParam(c)
+		if !ok {
+			return
+		}
+		reward, err := r.catalogService.SetPublished(id, published)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, newAdminReward(reward))
+	}
+}
+
+func (r *Router) handleAdminUploadRewardImage(c *gin.Context) {
+	id, ok := rewardIDParam(c)
+	if !ok {
+		return
+	}
+	header, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	reward, err := r.catalogService.SaveImage(id, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newAdminReward(reward))
+}
+
+func (r *Router) handleAdminRestockReward(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, ok := rewardIDParam(c)
+	if !ok {
+		return
+	}
+	var input struct {
+		Quantity int    `json:"quantity" binding:"required"`
+		Reason   string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reward, event, err := r.catalogService.Restock(claims.UserID, id, input.Quantity, input.Reason)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reward": newAdminReward(reward), "event": event})
+}
+
+func (r *Router) handleAdminRewardStock(c *gin.Context) {
+	id, ok := rewardIDParam(c)
+	if !ok {
+		return
+	}
+	events, err := r.catalogService.StockHistory(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+func (r *Router) handleAdminImportVoucherCodes(c *gin.Context) {
+	id, ok := rewardIDParam(c)
+	if !ok {
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "csv file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	result, err := r.voucherService.ImportCSV(id, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (r *Router) handleAdminVoucherStats(c *gin.Context) {
+	id, ok := rewardIDParam(c)
+	if !ok {
+		return
+	}
+	stats, err := r.voucherService.Stats(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func (r *Router) handleAdminListRedemptions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	redemptions, err := r.rewardService.ListRedemptions(c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, redemptions)
+}
+
+func (r *Router) handleTransitionRedemption(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redemption id"})
+		return
+	}
+	var input struct {
+		Status string `json:"status" binding:"required"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	redemption, err := r.rewardService.Transition(claims.UserID, uint(id), input.Status, input.Note)
+	if err != nil {
+		c.JSON(redemptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, redemption)
+}
+
+// handlePartnerRedemptionStatus lets a fulfillment partner report the outcome
+// of a redemption. The request is authenticated by the webhook signature
+// rather than a user token.
+func (r *Router) handlePartnerRedemptionStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redemption id"})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = r.webhookService.VerifyCallback(uint(id), c.GetHeader(service.WebhookTimestampHeader), c.GetHeader(service.WebhookSignatureHeader), body)
+	if errors.Is(err, service.ErrInvalidSignature) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(redemptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil || input.Status == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status is required"})
+		return
+	}
+
+	redemption, err := r.rewardService.PartnerUpdate(uint(id), input.Status, input.Note)
+	if err != nil {
+		c.JSON(redemptionErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, redemption)
+}
+
+func (r *Router) handleAdminReconcileLeaderboard(c *gin.Context) {
+	report, err := r.leaderboardSync.Reconcile()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (r *Router) handleAdminDeadWebhooks(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	deliveries, err := r.webhookService.DeadLetters(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (r *Router) handleAdminRetryWebhook(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery id"})
+		return
+	}
+	delivery, err := r.webhookService.Retry(uint(id))
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrWebhookNotDead):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+func (r *Router) handleGetWishlist(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	items, err := r.wishlistService.List(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+func (r *Router) handleAddWishlist(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	var input struct {
+		RewardID uint `json:"reward_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := r.wishlistService.Add(claims.UserID, input.RewardID); err != nil {
+		c.JSON(wishlistErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	r.handleGetWishlist(c)
+}
+
+func (r *Router) handleRemoveWishlist(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	rewardID, err := strconv.Atoi(c.Param("reward_id"))
+	if err != nil || rewardID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reward id"})
+		return
+	}
+
+	if err := r.wishlistService.Remove(claims.UserID, uint(rewardID)); err != nil {
+		c.JSON(wishlistErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (r *Router) handleGetGoal(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	goal, err := r.wishlistService.Goal(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"goal": goal})
+}
+
+func (r *Router) handleSetGoal(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	var input struct {
+		RewardID uint `json:"reward_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	goal, err := r.wishlistService.SetGoal(claims.UserID, input.RewardID)
+	if err != nil {
+		c.JSON(wishlistErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"goal": goal})
+}
+
+func (r *Router) handleClearGoal(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	if err := r.wishlistService.ClearGoal(claims.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (r *Router) handleGetNotifications(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	notifications, err := r.wishlistService.Notifications(claims.UserID, c.Query("unread") == "true", limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+func (r *Router) handleReadNotification(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notification id"})
+		return
+	}
+
+	if err := r.wishlistService.MarkRead(claims.UserID, uint(id)); err != nil {
+		c.JSON(wishlistErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func dropIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid drop id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (r *Router) handleListDrops(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	drops, err := r.dropService.List(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, drops)
+}
+
+func (r *Router) handleGetDrop(c *gin.Context) {
+	id, ok := dropIDParam(c)
+	if !ok {
+		return
+	}
+	drop, err := r.dropService.Get(id)
+	if err != nil {
+		c.JSON(dropErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, drop)
+}
+
+func (r *Router) handleDropResults(c *gin.Context) {
+	id, ok := dropIDParam(c)
+	if !ok {
+		return
+	}
+	results, err := r.dropService.Results(id)
+	if err != nil {
+		c.JSON(dropErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+func (r *Router) handleEnterDrop(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, ok := dropIDParam(c)
+	if !ok {
+		return
+	}
+	entry, err := r.dropService.Enter(claims.UserID, id)
+	if err != nil {
+		c.JSON(dropErrorStatus(err), redeemErrorBody(err))
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+func (r *Router) handleGetDropEntry(c *gin.Context) {
+	claims := c.MustGet("claims").(*service.Claims)
+	id, ok := dropIDParam(c)
+	if !ok {
+		return
+	}
+	entry, err := r.dropService.MyEntry(claims.UserID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if entry == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not entered"})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+func (r *Router) handleAdminCreateDrop(c *gin.Context) {
+	var input struct {
+		RewardID uint      `json:"reward_id" binding:"required"`
+		OpensAt  time.Time `json:"opens_at" binding:"required"`
+		ClosesAt time.Time `json:"closes_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	drop, err := r.dropService.Create(service.DropInput{
+		RewardID: input.RewardID,
+		OpensAt:  input.OpensAt,
+		ClosesAt: input.ClosesAt,
+	})
+	if err != nil {
+		c.JSON(dropErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, drop)
+}
+
+func (r *Router) handleAdminDrawDrop(c *gin.Context) {
+	id, ok := dropIDParam(c)
+	if !ok {
+		return
+	}
+	results, err := r.dropService.Draw(id)
+	if err != nil {
+		c.JSON(dropErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+func dropErrorStatus(err error) int {
+	var eligibility *service.EligibilityError
+	switch {
+	case errors.Is(err, service.ErrDropNotFound), errors.Is(err, repository.ErrRewardUnavailable):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrDropNotOpen), errors.Is(err, service.ErrDropStillOpen),
+		errors.Is(err, service.ErrDropNotDrawn), errors.Is(err, repository.ErrDropDrawn),
+		errors.Is(err, repository.ErrDropActive), errors.Is(err, repository.ErrAlreadyEntered):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidDropWindow), errors.Is(err, repository.ErrInsufficientPoints),
+		errors.As(err, &eligibility):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func wishlistErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrRewardUnavailable),
+		errors.Is(err, repository.ErrWishlistItemNotFound),
+		errors.Is(err, service.ErrNotificationNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func redemptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrRedemptionNotFound), errors.Is(err, service.ErrNoVoucherCode):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, repository.ErrRedemptionChanged),
+		errors.Is(err, service.ErrCodeRevealed), errors.Is(err, service.ErrVoucherWithdrawn):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (r *Router) requireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+			return
+		}
+
+		claims, err := r.authService.ParseToken(parts[1])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := r.authService.Touch(claims, c.ClientIP()); err != nil {
+			log.Printf("failed to record session activity: %v", err)
+		}
+
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// idempotent replays the stored response when an authenticated request is
+// retried with the same Idempotency-Key header. Requests without the header
+// are passed through unchanged. Server errors are not stored so the client
+// can retry them.
+func (r *Router) idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		claims := c.MustGet("claims").(*service.Claims)
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := service.RequestHash(c.Request.Method, c.FullPath(), body)
+		record, replay, err := r.idempotencyService.Begin(claims.UserID, key, hash)
+		switch {
+		case errors.Is(err, service.ErrInvalidIdempotencyKey):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, service.ErrIdempotencyMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, service.ErrIdempotencyInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, record.ContentType, record.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		// A panicking handler leaves no response to store; release the claim
+		// so retries are not refused as in progress until the key expires.
+		defer func() {
+			if p := recover(); p != nil {
+				if err := r.idempotencyService.Release(record); err != nil {
+					log.Printf("failed to release idempotency key %q: %v", key, err)
+				}
+				panic(p)
+			}
+		}()
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			err = r.idempotencyService.Release(record)
+		} else {
+			err = r.idempotencyService.Complete(record, status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		}
+		if err != nil {
+			log.Printf("failed to store idempotent response for key %q: %v", key, err)
+		}
+	}
+}
+
+// responseRecorder keeps a copy of the response body written by a handler.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// optionalAuth stores the claims of a valid bearer token like requireAuth but
+// lets anonymous requests through.
+func (r *Router) optionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			if claims, err := r.authService.ParseToken(parts[1]); err == nil {
+				c.Set("claims", claims)
+			}
+		}
+		c.Next()
+	}
+}
+
+// requireAdmin must run after requireAuth and rejects users whose role is not
+// admin.
+func (r *Router) requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := c.MustGet("claims").(*service.Claims)
+		admin, err := r.userService.IsAdmin(claims.UserID)
+		if err != nil || !admin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func leaderboardErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUnknownPeriod), errors.Is(err, service.ErrUnknownCountry):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrStreamFull):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func followErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, repository.ErrNotFollowing):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrCannotFollowSelf):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrFollowLimit):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func authErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidRefreshToken), errors.Is(err, service.ErrRefreshTokenReused):
+		return http.StatusUnauthorized
+	case errors.Is(err, repository.ErrSessionNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
 	}
 }
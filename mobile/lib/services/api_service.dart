@@ -18,8 +18,15 @@ class ApiService {
   final http.Client _client;
   final String baseUrl;
   String? _token;
+  String? _refreshToken;
+  Future<bool>? _refreshing;
 
-  void updateToken(String? token) => _token = token;
+  void updateToken(String? token, {String? refreshToken}) {
+    _token = token;
+    if (refreshToken != null || token == null) {
+      _refreshToken = refreshToken;
+    }
+  }
 
   Map<String, String> _headers({bool authenticated = false}) {
     final headers = <String, String>{'Content-Type': 'application/json'};
@@ -59,10 +66,57 @@ class ApiService {
     final data = jsonDecode(response.body) as Map<String, dynamic>;
     final token = data['token'] as String;
     final user = User.fromJson(data['user'] as Map<String, dynamic>);
-    updateToken(token);
+    updateToken(token, refreshToken: data['refresh_token'] as String?);
     return (token, user);
   }
 
+  Future<void> logout() async {
+    final refreshToken = _refreshToken;
+    updateToken(null);
+    if (refreshToken == null) return;
+    final response = await _client.post(
+      Uri.parse('$baseUrl/auth/logout'),
+      headers: _headers(),
+      body: jsonEncode({'refresh_token': refreshToken}),
+    );
+    _ensureSuccess(response);
+  }
+
+  // Access tokens are short-lived: when one is rejected, exchange the refresh
+  // token once and repeat the request with the new access token.
+  Future<http.Response> _authorized(Future<http.Response> Function() request) async {
+    final token = _token;
+    final response = await request();
+    if (response.statusCode != 401 || _refreshToken == null) {
+      return response;
+    }
+    if (_token == token && !await _refresh()) {
+      return response;
+    }
+    return request();
+  }
+
+  // Concurrent requests share one refresh: a refresh token can only be used
+  // once, and presenting it twice signs the device out.
+  Future<bool> _refresh() {
+    return _refreshing ??= _exchangeRefreshToken().whenComplete(() => _refreshing = null);
+  }
+
+  Future<bool> _exchangeRefreshToken() async {
+    final response = await _client.post(
+      Uri.parse('$baseUrl/auth/refresh'),
+      headers: _headers(),
+      body: jsonEncode({'refresh_token': _refreshToken}),
+    );
+    if (response.statusCode != 200) {
+      updateToken(null);
+      return false;
+    }
+    final data = jsonDecode(response.body) as Map<String, dynamic>;
+    updateToken(data['token'] as String, refreshToken: data['refresh_token'] as String?);
+    return true;
+  }
+
   Future<List<Trip>> fetchTrips({int limit = 20}) async {
     final response = await _client.get(
       Uri.parse('$baseUrl/trips?limit=$limit'),
@@ -80,17 +134,17 @@ class ApiService {
     required DateTime visitedAt,
     required List<Map<String, dynamic>> media,
   }) async {
-    final response = await _client.post(
-      Uri.parse('$baseUrl/trips'),
-      headers: _headers(authenticated: true),
-      body: jsonEncode({
-        'title': title,
-        'description': description,
-        'location': location,
-        'visited_at': visitedAt.toUtc().toIso8601String(),
-        'media': media,
-      }),
-    );
+    final response = await _authorized(() => _client.post(
+          Uri.parse('$baseUrl/trips'),
+          headers: _headers(authenticated: true),
+          body: jsonEncode({
+            'title': title,
+            'description': description,
+            'location': location,
+            'visited_at': visitedAt.toUtc().toIso8601String(),
+            'media': media,
+          }),
+        ));
     _ensureSuccess(response);
     return Trip.fromJson(jsonDecode(response.body) as Map<String, dynamic>);
   }
@@ -118,40 +172,40 @@ class ApiService {
   }
 
   Future<List<Redemption>> fetchRedemptions({int limit = 20}) async {
-    final response = await _client.get(
-      Uri.parse('$baseUrl/me/redemptions?limit=$limit'),
-      headers: _headers(authenticated: true),
-    );
+    final response = await _authorized(() => _client.get(
+          Uri.parse('$baseUrl/me/redemptions?limit=$limit'),
+          headers: _headers(authenticated: true),
+        ));
     _ensureSuccess(response);
     final list = jsonDecode(response.body) as List<dynamic>;
     return list.map((e) => Redemption.fromJson(e as Map<String, dynamic>)).toList();
   }
 
   Future<List<PointsHistory>> fetchPointsHistory({int limit = 20}) async {
-    final response = await _client.get(
-      Uri.parse('$baseUrl/me/history?limit=$limit'),
-      headers: _headers(authenticated: true),
-    );
+    final response = await _authorized(() => _client.get(
+          Uri.parse('$baseUrl/me/history?limit=$limit'),
+          headers: _headers(authenticated: true),
+        ));
     _ensureSuccess(response);
     final list = jsonDecode(response.body) as List<dynamic>;
     return list.map((e) => PointsHistory.fromJson(e as Map<String, dynamic>)).toList();
   }
 
   Future<UserProfile> fetchProfile() async {
-    final response = await _client.get(
-      Uri.parse('$baseUrl/me'),
-      headers: _headers(authenticated: true),
-    );
+    final response = await _authorized(() => _client.get(
+          Uri.parse('$baseUrl/me'),
+          headers: _headers(authenticated: true),
+        ));
     _ensureSuccess(response);
     return UserProfile.fromJson(jsonDecode(response.body) as Map<String, dynamic>);
   }
 
   Future<(Redemption, User)> redeemReward(int rewardId) async {
-    final response = await _client.post(
-      Uri.parse('$baseUrl/rewards/redeem'),
-      headers: _headers(authenticated: true),
-      body: jsonEncode({'reward_id': rewardId}),
-    );
+    final response = await _authorized(() => _client.post(
+          Uri.parse('$baseUrl/rewards/redeem'),
+          headers: _headers(authenticated: true),
+          body: jsonEncode({'reward_id': rewardId}),
+        ));
     _ensureSuccess(response);
     final data = jsonDecode(response.body) as Map<String, dynamic>;
     final redemption = Redemption.fromJson(data['redemption'] as Map<String, dynamic>);